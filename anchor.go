@@ -0,0 +1,26 @@
+package ahocorasick
+
+// anchorFilter wraps fn to drop matches of end-anchored patterns that do
+// not end at the end of input. A match's state is recovered by walking
+// its bytes from the root: the longest suffix of a pattern that is a
+// state is the pattern itself.
+func (tr *Trie) anchorFilter(input []byte, fn WalkFn) WalkFn {
+	last := uint32(len(input) - 1)
+	return func(end, n, pattern uint32) bool {
+		if end != last {
+			s := rootState
+			for _, c := range input[end+1-n : end+1] {
+				s = tr.next(s, c) & stateMask
+			}
+			if tr.endAnchored[s] {
+				return true
+			}
+		}
+		return fn(end, n, pattern)
+	}
+}
+
+// anchored reports whether s is the state of an end-anchored pattern.
+func (tr *Trie) anchored(s uint32) bool {
+	return tr.endAnchored != nil && tr.endAnchored[s]
+}
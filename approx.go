@@ -0,0 +1,213 @@
+package ahocorasick
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// ApproxMatch is a match found by MatchApprox, whose bytes may differ
+// from the pattern's in up to Distance places.
+type ApproxMatch struct {
+	pos      uint32
+	pattern  uint32
+	match    []byte
+	distance int
+}
+
+func (m *ApproxMatch) String() string {
+	return fmt.Sprintf("{%d %d %q %d}", m.pos, m.pattern, m.match, m.distance)
+}
+
+// Pos returns the byte position of the match.
+func (m *ApproxMatch) Pos() uint32 {
+	return m.pos
+}
+
+// Pattern returns the pattern id of the match.
+func (m *ApproxMatch) Pattern() uint32 {
+	return m.pattern
+}
+
+// Match returns the input bytes matched, as long as the pattern.
+func (m *ApproxMatch) Match() []byte {
+	return m.match
+}
+
+// Distance returns the number of bytes in which the match differs from
+// its pattern (the Hamming distance).
+func (m *ApproxMatch) Distance() int {
+	return m.distance
+}
+
+// approxIndex is MatchApprox's index for one mismatch budget k: by the
+// pigeonhole principle, an occurrence of a pattern with at most k
+// mismatches contains at least one of its k+1 pieces exactly, so a
+// trie of the pieces finds every candidate and each is verified in
+// full.
+type approxIndex struct {
+	// rep maps each byte to the smallest byte the automaton treats the
+	// same (identical transition columns), so comparisons follow the
+	// Trie's byte transform and alphabet; patterns are held in rep form.
+	rep [256]byte
+	// patterns are the Trie's patterns, by index.
+	patterns []patternEntry
+	// pieces finds the pieces; its pattern ids index refs.
+	pieces *Trie
+	refs   [][]pieceRef
+	// short lists the patterns no longer than k, which match everywhere
+	// they fit.
+	short []int
+}
+
+// pieceRef places a piece within pattern patterns[pat], at byte off.
+type pieceRef struct {
+	pat int
+	off uint32
+}
+
+// MatchApprox returns the occurrences of patterns in input with at most
+// k substituted bytes, each with its Hamming distance; insertions and
+// deletions are not considered. Byte equality is the Trie's own, so a
+// byte transform such as case folding applies. Matches are ordered by
+// position, then pattern id, and a pattern matching at one position is
+// reported once. Patterns no longer than k match at every position
+// they fit. The whole-word, white space, and anchor settings play no
+// part. A negative k finds nothing.
+//
+// Each call scans input once with an index of the patterns split into
+// k+1 pieces and verifies each candidate. The first call for each k up
+// to maxCachedApproxK builds the index and the Trie keeps it; larger
+// budgets, rarely worth the candidate flood anyway, build it per call,
+// so the Trie's memory stays bounded whatever k callers pass.
+func (tr *Trie) MatchApprox(input []byte, k int) []*ApproxMatch {
+	if k < 0 {
+		return nil
+	}
+	ix := tr.approxIndex(k)
+	type hit struct {
+		start uint32
+		pat   int
+	}
+	seen := make(map[hit]bool)
+	var out []*ApproxMatch
+	add := func(start uint32, pat int) {
+		h := hit{start, pat}
+		if seen[h] {
+			return
+		}
+		seen[h] = true
+		e := ix.patterns[pat]
+		d := 0
+		for i, c := range e.p {
+			if ix.rep[input[int(start)+i]] != c {
+				if d++; d > k {
+					return
+				}
+			}
+		}
+		out = append(out, &ApproxMatch{pos: start, pattern: e.id, match: input[start : int(start)+len(e.p)], distance: d})
+	}
+	ix.pieces.Walk(input, func(end, n, id uint32) bool {
+		for _, r := range ix.refs[id] {
+			start := int(end) + 1 - int(n) - int(r.off)
+			if start >= 0 && start+len(ix.patterns[r.pat].p) <= len(input) {
+				add(uint32(start), r.pat)
+			}
+		}
+		return true
+	})
+	for _, pat := range ix.short {
+		for start := 0; start+len(ix.patterns[pat].p) <= len(input); start++ {
+			add(uint32(start), pat)
+		}
+	}
+	slices.SortFunc(out, func(a, b *ApproxMatch) int {
+		if c := cmp.Compare(a.pos, b.pos); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.pattern, b.pattern); c != 0 {
+			return c
+		}
+		return cmp.Compare(len(a.match), len(b.match))
+	})
+	return out
+}
+
+// maxCachedApproxK is the largest mismatch budget whose MatchApprox
+// index the Trie keeps.
+const maxCachedApproxK = 4
+
+// approxIndex returns the index for k, built on first use and kept when
+// k is at most maxCachedApproxK.
+func (tr *Trie) approxIndex(k int) *approxIndex {
+	if k > maxCachedApproxK {
+		return tr.buildApproxIndex(k)
+	}
+	if ix, ok := tr.approx.Load(k); ok {
+		return ix.(*approxIndex)
+	}
+	actual, _ := tr.approx.LoadOrStore(k, tr.buildApproxIndex(k))
+	return actual.(*approxIndex)
+}
+
+// buildApproxIndex builds MatchApprox's index for k.
+func (tr *Trie) buildApproxIndex(k int) *approxIndex {
+	ix := &approxIndex{rep: tr.byteClasses(), patterns: tr.patternEntries()}
+	tb := NewTrieBuilder().SetByteTransform(func(c byte) byte { return ix.rep[c] })
+	ids := make(map[string]uint32)
+	for i, e := range ix.patterns {
+		if len(e.p) <= k {
+			ix.short = append(ix.short, i)
+			continue
+		}
+		for j := range k + 1 {
+			lo, hi := j*len(e.p)/(k+1), (j+1)*len(e.p)/(k+1)
+			piece := e.p[lo:hi]
+			id, ok := ids[string(piece)]
+			if !ok {
+				id = uint32(len(ix.refs))
+				ids[string(piece)] = id
+				ix.refs = append(ix.refs, nil)
+				tb.AddPatternWithID(piece, id)
+			}
+			ix.refs[id] = append(ix.refs[id], pieceRef{pat: i, off: uint32(lo)})
+		}
+	}
+	ix.pieces = tb.Build()
+	return ix
+}
+
+// byteClasses maps each byte to the smallest byte whose transition
+// column is the same as its own in every state: bytes the automaton
+// cannot tell apart, such as the cases of a letter under case folding,
+// or all bytes outside the alphabet.
+func (tr *Trie) byteClasses() [256]byte {
+	var rep [256]byte
+	var hash [256]uint64
+	for c := range hash {
+		h := uint64(14695981039346656037)
+		for s := range uint32(tr.NumStates()) {
+			h = (h ^ uint64(tr.next(s, byte(c))&stateMask)) * 1099511628211
+		}
+		hash[c] = h
+	}
+	sameColumn := func(a, b int) bool {
+		for s := range uint32(tr.NumStates()) {
+			if (tr.next(s, byte(a))^tr.next(s, byte(b)))&stateMask != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	for c := range rep {
+		rep[c] = byte(c)
+		for b := range c {
+			if rep[b] == byte(b) && hash[b] == hash[c] && sameColumn(b, c) {
+				rep[c] = byte(b)
+				break
+			}
+		}
+	}
+	return rep
+}
@@ -0,0 +1,109 @@
+package ahocorasick
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func approxString(ms []*ApproxMatch) string {
+	s := ""
+	for _, m := range ms {
+		s += fmt.Sprintf("%d:%d:%q:%d ", m.Pos(), m.Pattern(), m.Match(), m.Distance())
+	}
+	return s
+}
+
+func TestMatchApprox(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"abc", "hello", "xy"}).Build()
+	for _, tc := range []struct {
+		input string
+		k     int
+		want  string
+	}{
+		{"abx", 1, `0:0:"abx":1 `},
+		{"abx", 0, ``},
+		{"zbx", 1, ``},
+		{"say hallo, hell0 abc", 1, `1:2:"ay":1 4:1:"hallo":1 11:1:"hell0":1 17:0:"abc":0 `},
+		{"xyz", 0, `0:2:"xy":0 `},
+		{"xyz", 1, `0:2:"xy":0 `},
+		{"xxy", 1, `0:2:"xx":1 1:2:"xy":0 `},
+		// Within distance 2, "xy" matches wherever it fits.
+		{"abc", 2, `0:0:"abc":0 0:2:"ab":2 1:2:"bc":2 `},
+		{"abc", -1, ``},
+	} {
+		if got := approxString(trie.MatchApprox([]byte(tc.input), tc.k)); got != tc.want {
+			t.Errorf("MatchApprox(%q, %d) = %s, want %s", tc.input, tc.k, got, tc.want)
+		}
+	}
+
+	// The Trie's byte transform decides which bytes are equal.
+	folded := NewTrieBuilder().SetByteTransform(foldASCII).AddString("Secret").Build()
+	if got, want := approxString(folded.MatchApprox([]byte("SECRAT"), 1)), `0:0:"SECRAT":1 `; got != want {
+		t.Errorf("case folded: got %s, want %s", got, want)
+	}
+
+	// Budgets past maxCachedApproxK answer alike but are not kept.
+	for range 2 {
+		found := false
+		for _, m := range trie.MatchApprox([]byte("hello"), maxCachedApproxK+1) {
+			found = found || m.Pattern() == 1 && m.Distance() == 0
+		}
+		if !found {
+			t.Error("large k: hello not found")
+		}
+	}
+	kept := 0
+	trie.approx.Range(func(k, _ any) bool {
+		if k.(int) > maxCachedApproxK {
+			t.Errorf("index for k = %d was kept", k)
+		}
+		kept++
+		return true
+	})
+	if kept == 0 {
+		t.Error("no index was kept for small k")
+	}
+}
+
+// TestMatchApproxBruteForce checks MatchApprox against comparing every
+// pattern at every position.
+func TestMatchApproxBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	word := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc"[rng.Intn(3)]
+		}
+		return b
+	}
+	var patterns [][]byte
+	for range 20 {
+		patterns = append(patterns, word(1+rng.Intn(7)))
+	}
+	trie := NewTrieBuilder().AddPatterns(patterns).Build()
+	entries := trie.patternEntries()
+	input := word(300)
+	for k := range 4 {
+		want := ""
+		for start := range input {
+			for _, e := range entries {
+				if start+len(e.p) > len(input) {
+					continue
+				}
+				d := 0
+				for i, c := range e.p {
+					if input[start+i] != c {
+						d++
+					}
+				}
+				if d <= k {
+					want += fmt.Sprintf("%d:%d:%q:%d ", start, e.id, input[start:start+len(e.p)], d)
+				}
+			}
+		}
+		if got := approxString(trie.MatchApprox(input, k)); got != want {
+			t.Errorf("k=%d: MatchApprox differs from brute force", k)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package ahocorasick
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// MatchBatch runs Match on every input concurrently, with at most workers
+// inputs in flight (GOMAXPROCS when workers < 1), and returns the
+// results in input order. Each result may be released with
+// ReleaseMatches.
+func (tr *Trie) MatchBatch(inputs [][]byte, workers int) [][]*Match {
+	results, _ := tr.MatchBatchContext(context.Background(), inputs, workers)
+	return results
+}
+
+// MatchBatchContext is MatchBatch stopping early when ctx is done. An
+// input being scanned when ctx is cancelled is finished, but no further
+// input is started; the partial results are returned along with
+// ctx.Err(). results[i] always belongs to inputs[i] and is nil for an
+// input that was not scanned (as well as for one without matches).
+func (tr *Trie) MatchBatchContext(ctx context.Context, inputs [][]byte, workers int) ([][]*Match, error) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(inputs))
+	results := make([][]*Match, len(inputs))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if i >= len(inputs) {
+					return
+				}
+				results[i] = tr.Match(inputs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	// An input can only go unscanned once ctx is done, so a nil error
+	// here means every result is complete.
+	if int(next.Load()) < len(inputs) {
+		return results, ctx.Err()
+	}
+	return results, nil
+}
+
+// MatchChan sends the matches Match would return on the returned
+// channel, in the same order, from a goroutine that scans input only as
+// fast as they are received; the channel is closed when input is done
+// or ctx is. Each Match is allocated for the receiver, not drawn from
+// the Trie's pool, so it stays valid after the scan and must not be
+// passed to ReleaseMatches; its bytes alias input. A receiver that stops
+// early must cancel ctx, or the goroutine blocks forever.
+func (tr *Trie) MatchChan(ctx context.Context, input []byte) <-chan *Match {
+	ch := make(chan *Match)
+	go func() {
+		defer close(ch)
+		tr.Walk(input, func(end, n, pattern uint32) bool {
+			// A ready receiver would win half the selects below after
+			// cancellation; check first so at most one match follows it.
+			if ctx.Err() != nil {
+				return false
+			}
+			m := &Match{pos: end + 1 - n, pattern: pattern, match: input[end+1-n : end+1], buf: tr.textLink}
+			select {
+			case ch <- m:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return ch
+}
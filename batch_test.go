@@ -0,0 +1,106 @@
+package ahocorasick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// cancelAfter is a context that reports itself cancelled from its nth
+// Err call on, to cancel a batch at a deterministic point.
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestMatchBatch(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build()
+	inputs := make([][]byte, 50)
+	for i := range inputs {
+		inputs[i] = []byte(fmt.Sprintf("%d ushers %d", i, i))
+	}
+	check := func(i int, got []*Match) {
+		t.Helper()
+		want := tr.Match(inputs[i])
+		if len(got) != len(want) {
+			t.Fatalf("input %d: expected %v, got %v", i, want, got)
+		}
+		for j := range got {
+			if !MatchEqual(want[j], got[j]) || &got[j].match[0] != &inputs[i][got[j].pos] {
+				t.Fatalf("input %d: expected %v, got %v", i, want[j], got[j])
+			}
+		}
+	}
+
+	for _, workers := range []int{0, 1, 4, 100} {
+		results := tr.MatchBatch(inputs, workers)
+		if len(results) != len(inputs) {
+			t.Fatalf("workers=%d: expected %d results, got %d", workers, len(inputs), len(results))
+		}
+		for i, ms := range results {
+			check(i, ms)
+			tr.ReleaseMatches(ms)
+		}
+	}
+
+	// One worker checks the context before each input, so cancelling at
+	// the fourth check leaves exactly three inputs scanned.
+	ctx := &cancelAfter{Context: context.Background(), n: 3}
+	results, err := tr.MatchBatchContext(ctx, inputs, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	for i, ms := range results {
+		if i < 3 {
+			check(i, ms)
+		} else if ms != nil {
+			t.Errorf("input %d was scanned after cancellation", i)
+		}
+	}
+
+	ctx2, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := tr.MatchBatchContext(ctx2, inputs, 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("pre-cancelled context: expected context.Canceled, got %v", err)
+	}
+	if results, err := tr.MatchBatchContext(ctx2, nil, 4); err != nil || len(results) != 0 {
+		t.Errorf("empty batch: got %v, %v", results, err)
+	}
+}
+
+func TestMatchChan(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build()
+	input := []byte(strings.Repeat("ushers ", 100))
+	var got []*Match
+	for m := range trie.MatchChan(context.Background(), input) {
+		got = append(got, m)
+	}
+	want := trie.Match(input)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("MatchChan sent %d matches, Match found %d", len(got), len(want))
+	}
+	trie.ReleaseMatches(want)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := trie.MatchChan(ctx, input)
+	<-ch
+	<-ch
+	cancel()
+	n := 0
+	for range ch {
+		n++
+	}
+	// At most one send could have won the race with the cancellation.
+	if n > 1 {
+		t.Errorf("received %d matches after cancelling", n)
+	}
+}
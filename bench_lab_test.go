@@ -92,9 +92,9 @@ func BenchmarkLabSingleStop(b *testing.B) {
 func BenchmarkLabMultiStop(b *testing.B) {
 	patterns, ibsen := labLoad(b)
 	tr := NewTrieBuilder().AddStrings(stride10k(patterns)).Build()
-	if len(tr.rootStopBytes) == 1 || len(tr.failTrans) <= 1<<15 {
+	if len(tr.rootStopBytes) == 1 || tr.NumStates() <= 1<<15 {
 		b.Fatalf("want large multi-stop automaton, got states=%d stops=%d",
-			len(tr.failTrans), countStop(tr))
+			tr.NumStates(), countStop(tr))
 	}
 	b.Run("ibsen-1k", func(b *testing.B) { benchMatch(b, tr, ibsen[:1000]) })
 	b.Run("ibsen-4k", func(b *testing.B) { benchMatch(b, tr, ibsen[:4000]) })
@@ -294,8 +294,8 @@ func BenchmarkLabMultiSmall(b *testing.B) {
 		sel = append(sel, patterns[i])
 	}
 	tr := NewTrieBuilder().AddStrings(sel).Build()
-	if len(tr.failTrans) > 1<<15 || countStop(tr) < 2 {
-		b.Fatalf("want small multi-stop automaton, got states=%d stops=%d", len(tr.failTrans), countStop(tr))
+	if tr.NumStates() > 1<<15 || countStop(tr) < 2 {
+		b.Fatalf("want small multi-stop automaton, got states=%d stops=%d", tr.NumStates(), countStop(tr))
 	}
 	b.Run("ibsen-1k", func(b *testing.B) { benchMatch(b, tr, ibsen[:1000]) })
 	b.Run("ibsen-4k", func(b *testing.B) { benchMatch(b, tr, ibsen[:4000]) })
@@ -2,8 +2,21 @@ package ahocorasick
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"math/bits"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -29,6 +42,88 @@ type state struct {
 type TrieBuilder struct {
 	states      []state // All states; index 0 unused, index 1 is the root
 	numPatterns uint32  // Number of patterns added
+
+	// alphabet, when non-nil, marks the bytes the automaton may move on;
+	// every other byte resets it to the root (see SetAlphabet).
+	alphabet *[256]bool
+
+	// priority maps pattern states to the priority given by
+	// AddPatternWithPriority; nil until one is set.
+	priority map[uint32]int
+
+	// weights maps pattern ids to SetPatternWeights' expected match
+	// frequencies; nil when state ids follow plain BFS order.
+	weights map[int]float64
+
+	// endAnchored marks pattern states added by AddPatternEndAnchored;
+	// nil until one is.
+	endAnchored map[uint32]bool
+
+	// values maps pattern ids to AddPatternWithValue values; nil until
+	// one is set.
+	values map[uint32]any
+
+	// reverse inserts patterns back to front (see SetReverse).
+	reverse bool
+
+	// encoding is the pattern file encoding LoadPatterns expects.
+	encoding PatternEncoding
+
+	// separator ends each record of a pattern file when sepSet is true
+	// (see SetRecordSeparator); otherwise records are lines.
+	separator byte
+	sepSet    bool
+
+	// xlat, when non-nil, is the byte transform applied to patterns as
+	// they are added and baked into the transition table for input (see
+	// SetByteTransform).
+	xlat *[256]byte
+
+	// wholeWord restricts matches to whole words (see SetWholeWord).
+	wholeWord bool
+
+	// collapseSpace collapses white space runs in patterns and input
+	// (see SetCollapseWhitespace).
+	collapseSpace bool
+
+	// maxBytes is Compile's WithMaxDenseBytes budget; 0 means none.
+	maxBytes int
+
+	// compact makes Build keep a compact table whatever bytes the
+	// patterns use (see compactStride); Compile sets it when the full
+	// table would exceed maxBytes.
+	compact bool
+
+	// requireNonEmpty is Compile's WithRequireNonEmpty.
+	requireNonEmpty bool
+
+	// utf8Policy is MatchUTF8's handling of invalid UTF-8 (see
+	// SetInvalidUTF8Policy).
+	utf8Policy InvalidUTF8Policy
+
+	// maxPatternLen is SetMaxPatternLen's limit; 0 means none.
+	maxPatternLen int
+
+	// text holds every pattern as added, back to back, and textRefs
+	// locates each one, in insertion order (see ShortPatterns).
+	text     []byte
+	textRefs []textRef
+
+	// keepText is SetKeepPatternText's setting.
+	keepText bool
+
+	// keepFail is SetKeepFailLinks' setting.
+	keepFail bool
+
+	// err is the first pattern rejection, reported by Err.
+	err error
+
+	// poolDebug is SetPoolDebug's setting.
+	poolDebug bool
+
+	// poolCap is the number of matches each pooled match buffer is
+	// presized for (see SetMatchPoolCapacity).
+	poolCap int
 }
 
 // NewTrieBuilder creates and initializes a new TrieBuilder.
@@ -76,12 +171,108 @@ func (tb *TrieBuilder) addChild(s uint32, c byte) uint32 {
 // AddPattern adds a byte pattern to the Trie under construction.
 // It creates new states as needed while following/creating the path
 // for the pattern in the trie. The final state is marked with the
-// pattern length and assigned a unique pattern number.
+// pattern length and assigned a unique pattern number. Patterns are
+// arbitrary bytes: NUL and every other byte is matched like any letter,
+// by this and every string variant of the Add methods.
 func (tb *TrieBuilder) AddPattern(pattern []byte) *TrieBuilder {
+	return tb.AddPatternWithID(pattern, tb.numPatterns)
+}
+
+// AddPatternWithID adds a byte pattern that matches report under the
+// caller-chosen id instead of its insertion index, so ids can come from
+// an external source such as a database key. Automatic ids handed out
+// by later AddPattern calls keep counting insertions and are not
+// adjusted around explicit ones. Keeping ids unique is the caller's
+// responsibility: the trie reports whatever id each pattern was given.
+// Adding the same pattern twice keeps the id of the last addition.
+func (tb *TrieBuilder) AddPatternWithID(pattern []byte, id uint32) *TrieBuilder {
+	tb.insert(pattern, id)
+	return tb
+}
+
+// AddPatternWithPriority adds a byte pattern with a priority used by
+// MatchByPriority to pick among competing matches; patterns added any
+// other way have priority 0. Adding the same pattern again replaces its
+// priority (with 0, unless the new addition carries one). Priorities
+// are not serialized: a decoded Trie treats every pattern as priority 0.
+func (tb *TrieBuilder) AddPatternWithPriority(pattern []byte, prio int) *TrieBuilder {
+	s := tb.insert(pattern, tb.numPatterns)
+	if s == nilState {
+		return tb
+	}
+	if tb.priority == nil {
+		tb.priority = make(map[uint32]int)
+	}
+	tb.priority[s] = prio
+	return tb
+}
+
+// AddPatternWithValue adds a byte pattern carrying an arbitrary value,
+// such as a route or rule to act on when it matches; look it up with
+// Trie.Value and the match's pattern id. Values that are []byte survive
+// Encode and Decode; values of any other type are not serialized, so a
+// decoded Trie returns nil for them.
+func (tb *TrieBuilder) AddPatternWithValue(pattern []byte, value any) *TrieBuilder {
+	id := tb.numPatterns
+	if tb.insert(pattern, id) == nilState {
+		return tb
+	}
+	if tb.values == nil {
+		tb.values = make(map[uint32]any)
+	}
+	tb.values[id] = value
+	return tb
+}
+
+// AddPatternEndAnchored adds a byte pattern that matches only at the end
+// of the input, like a regular expression ending in $, so suffixes such
+// as file extensions can share a Trie with unanchored patterns: ".log"
+// matches "app.log" but not "app.log.gz". Adding the same pattern again
+// without the anchor removes it. The end is that of the input a method
+// is given: of the stream for the MatchReader family and a Matcher,
+// which reports anchored matches at Flush, and of the range for
+// MatchRange and MatchPrefix. MatchApprox ignores the anchor,
+// MatchTokens lets the pattern match only the last token, and WalkAt,
+// which cannot tell where the stream ends, panics. Encode records the
+// anchor with the Trie.
+func (tb *TrieBuilder) AddPatternEndAnchored(pattern []byte) *TrieBuilder {
+	s := tb.insert(pattern, tb.numPatterns)
+	if s == nilState {
+		return tb
+	}
+	if tb.endAnchored == nil {
+		tb.endAnchored = make(map[uint32]bool)
+	}
+	tb.endAnchored[s] = true
+	return tb
+}
+
+// insert adds pattern under id and returns its final state, or nilState
+// if SetMaxPatternLen rejects it.
+func (tb *TrieBuilder) insert(pattern []byte, id uint32) uint32 {
+	if tb.maxPatternLen > 0 && len(pattern) > tb.maxPatternLen {
+		if tb.err == nil {
+			tb.err = fmt.Errorf("%w: pattern %d is %d bytes, limit %d",
+				ErrPatternTooLong, id, len(pattern), tb.maxPatternLen)
+		}
+		tb.numPatterns++
+		return nilState
+	}
+	tb.textRefs = append(tb.textRefs, textRef{id: id, off: uint32(len(tb.text)), n: uint32(len(pattern))})
+	tb.text = append(tb.text, pattern...)
+	if tb.collapseSpace {
+		pattern = collapseSpace(pattern)
+	}
 	s := rootState
 
 	// Follow/create the path for this pattern.
-	for _, c := range pattern {
+	for i, c := range pattern {
+		if tb.reverse {
+			c = pattern[len(pattern)-1-i]
+		}
+		if tb.xlat != nil {
+			c = tb.xlat[c]
+		}
 		t := tb.child(s, c)
 		if t == 0 {
 			t = tb.addChild(s, c)
@@ -91,10 +282,16 @@ func (tb *TrieBuilder) AddPattern(pattern []byte) *TrieBuilder {
 
 	// Mark the final state with pattern info.
 	tb.states[s].dict = uint32(len(pattern))
-	tb.states[s].pattern = tb.numPatterns
+	tb.states[s].pattern = id
 	tb.numPatterns++
+	if tb.priority != nil {
+		delete(tb.priority, s)
+	}
+	if tb.endAnchored != nil {
+		delete(tb.endAnchored, s)
+	}
 
-	return tb
+	return s
 }
 
 // AddPatterns adds multiple byte patterns to the Trie.
@@ -105,6 +302,17 @@ func (tb *TrieBuilder) AddPatterns(patterns [][]byte) *TrieBuilder {
 	return tb
 }
 
+// AddSeq adds every pattern seq yields, as AddPattern would, drawing
+// them one at a time so a cursor or generator need not be collected
+// into a slice first. A yielded slice may be reused once the next is
+// requested: only the trie's states keep its bytes.
+func (tb *TrieBuilder) AddSeq(seq iter.Seq[[]byte]) *TrieBuilder {
+	for pattern := range seq {
+		tb.AddPattern(pattern)
+	}
+	return tb
+}
+
 // AddString adds a string pattern to the Trie under construction.
 func (tb *TrieBuilder) AddString(pattern string) *TrieBuilder {
 	return tb.AddPattern([]byte(pattern))
@@ -118,57 +326,572 @@ func (tb *TrieBuilder) AddStrings(patterns []string) *TrieBuilder {
 	return tb
 }
 
-// LoadPatterns loads byte patterns from a file. Expects one pattern per line in hexadecimal form.
-// Empty lines are skipped. Returns error if file cannot be opened or if hex decoding fails.
-func (tb *TrieBuilder) LoadPatterns(path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
+// SetAlphabet restricts the automaton to the given byte values. Any
+// input byte outside the alphabet is a hard reset: whatever state the
+// scan is in, the byte sends it back to the root, so no match can span
+// it. Consequently a pattern containing a disallowed byte can never
+// match; it still occupies states and its id, but no input reaches it.
+// Without a restriction, a byte that appears in no pattern already
+// leads to the root from every state, so the alphabet only changes
+// results for bytes that some pattern uses.
+//
+// Disallowed bytes share the transition table's single dead column, so
+// automata large enough to use the byte-class-compressed table get rows
+// sized to the allowed bytes actually used by patterns rather than to
+// every pattern byte. The restriction is baked into the transition
+// table at Build; it needs no check on the scan path and survives
+// Encode/Decode unchanged. An empty or nil alphabet removes any
+// restriction.
+func (tb *TrieBuilder) SetAlphabet(alphabet []byte) *TrieBuilder {
+	if len(alphabet) == 0 {
+		tb.alphabet = nil
+		return tb
 	}
-	defer f.Close()
+	tb.alphabet = new([256]bool)
+	for _, c := range alphabet {
+		tb.alphabet[c] = true
+	}
+	return tb
+}
 
-	s := bufio.NewScanner(f)
+// SetReverse makes the builder store patterns added after the call back
+// to front, producing the automaton MatchReverse needs to find them while
+// scanning input right to left. Forward calls such as Match, Walk, and
+// Patterns on the resulting Trie see the reversed patterns: Match finds
+// "moc." where the pattern was ".com".
+func (tb *TrieBuilder) SetReverse(reverse bool) *TrieBuilder {
+	tb.reverse = reverse
+	return tb
+}
 
-	for s.Scan() {
-		str := strings.TrimSpace(s.Text())
-		if len(str) != 0 {
-			pattern, err := hex.DecodeString(str)
-			if err != nil {
-				return err
+// SetByteTransform normalizes bytes before matching: patterns added after
+// the call are stored transformed, and at match time every input byte is
+// transformed before the transition lookup, so a pattern matches wherever
+// the transformed input equals the transformed pattern. Mapping every
+// digit to '0', for example, lets "A0" match "A7". Reported matches are
+// the original input bytes. A nil transform removes it.
+//
+// The transform need not be idempotent or invertible, but both sides must
+// see the same function, so set it before adding patterns; patterns added
+// earlier are not transformed. It is evaluated once per byte value and
+// baked into the transition table, so it costs nothing while scanning and
+// survives Encode/Decode. Patterns and MatchSkip see the automaton rather
+// than the function: Patterns may report any byte the transform maps to
+// a pattern's byte.
+func (tb *TrieBuilder) SetByteTransform(fn func(byte) byte) *TrieBuilder {
+	tb.xlat = nil
+	if fn == nil {
+		return tb
+	}
+	var xlat [256]byte
+	identity := true
+	for b := range xlat {
+		xlat[b] = fn(byte(b))
+		identity = identity && xlat[b] == byte(b)
+	}
+	if !identity {
+		tb.xlat = &xlat
+	}
+	return tb
+}
+
+// SetWholeWord restricts the built Trie to whole-word matches: a match
+// is reported only when the input has no word byte (ASCII letter, digit,
+// or underscore) immediately before or after it. The check reads the
+// input's own bytes, after any byte transform has decided the match, so
+// the two compose: with case folding, "Error" matches "ERROR," but not
+// "ERRORS". It costs Match the scan loops' fastest paths. The matching
+// methods honor it, with three exceptions: MatchApprox ignores it,
+// MatchTokens matches whole tokens instead, and WalkAt, whose state
+// cannot carry the bytes around a match, panics. Encode records it
+// with the Trie.
+func (tb *TrieBuilder) SetWholeWord(wholeWord bool) *TrieBuilder {
+	tb.wholeWord = wholeWord
+	return tb
+}
+
+// SetCollapseWhitespace treats every run of ASCII white space as a
+// single space, in patterns added after the call and in input, so the
+// pattern "hello world" matches "hello   world" and "hello\n\tworld".
+// Reported positions and matched bytes are those of the original input;
+// a pattern that begins or ends with white space takes in the whole run
+// it matched. Input that needs collapsing is copied before the scan,
+// the fast Match paths are bypassed, and the MatchReader family reads
+// the whole stream first. The matching methods collapse input, with
+// these exceptions: MatchApprox and MatchTokens scan it as is, as does
+// the debugging aid MatchPath, and WalkAt, whose state cannot carry a
+// run across slices, panics. Encode records the setting with the
+// Trie.
+func (tb *TrieBuilder) SetCollapseWhitespace(collapse bool) *TrieBuilder {
+	tb.collapseSpace = collapse
+	return tb
+}
+
+// SetPatternWeights gives the expected relative match frequency of
+// patterns by id, so Build can number states by how often scans pass
+// through them rather than by depth: a state's weight is the total
+// weight of the patterns it is a prefix of, and heavier states get
+// lower ids, clustering the transition rows hot input touches. Patterns
+// missing from weights weigh 0; states of equal weight keep breadth-first
+// order, so without weights, or with all weights equal, the numbering is
+// Build's usual one. Weights must be non-negative. Only state ids and
+// table layout change: every matching method reports the same matches.
+// Like priorities, weights are not serialized, but the layout they
+// produce is.
+func (tb *TrieBuilder) SetPatternWeights(weights map[int]float64) *TrieBuilder {
+	tb.weights = maps.Clone(weights)
+	return tb
+}
+
+// weightIDs renumbers the states after the root by descending subtree
+// weight (see SetPatternWeights), keeping order's breadth-first order
+// among equal weights. order itself is left as is: Build still fills
+// rows breadth first, so each fail state's row is written first.
+func (tb *TrieBuilder) weightIDs(order, newID []uint32) {
+	w := make([]float64, len(tb.states))
+	for i := len(order) - 1; i >= 2; i-- {
+		s := &tb.states[order[i]]
+		if s.dict != 0 {
+			w[order[i]] += tb.weights[int(s.pattern)]
+		}
+		for t := s.firstChild; t != 0; t = tb.states[t].nextSib {
+			w[order[i]] += w[t]
+		}
+	}
+	byWeight := slices.Clone(order[2:])
+	slices.SortStableFunc(byWeight, func(a, b uint32) int {
+		return cmp.Compare(w[b], w[a])
+	})
+	for i, s := range byWeight {
+		newID[s] = uint32(i) + 2
+	}
+}
+
+// SetMatchPoolCapacity presizes every match buffer the built Trie's pool
+// allocates for n matches, so inputs with up to n matches fill a fresh
+// buffer without growing it. Buffers keep whatever capacity they reach
+// either way; a larger n only saves the growth steps of buffers the pool
+// allocates anew, such as after a garbage collection empties it. The
+// default, 0, allocates nothing up front. Decoded tries use the default.
+func (tb *TrieBuilder) SetMatchPoolCapacity(n int) *TrieBuilder {
+	tb.poolCap = max(n, 0)
+	return tb
+}
+
+// SetKeepPatternText makes the built Trie keep the text of every
+// pattern as added, so Match.PatternBytes can return it. The text is a
+// second copy of the patterns, and each Match the Trie reports records
+// where to find it; without the setting, PatternBytes returns nil and
+// neither cost is paid. The text is not serialized.
+func (tb *TrieBuilder) SetKeepPatternText(keep bool) *TrieBuilder {
+	tb.keepText = keep
+	return tb
+}
+
+// SetKeepFailLinks makes the built Trie keep every state's failure
+// link, as Build computes it, for Trie.FailLink, and Encode write them
+// with the Trie. The table costs 4 bytes per state; without the
+// setting, FailLink recovers the links on first use instead.
+func (tb *TrieBuilder) SetKeepFailLinks(keep bool) *TrieBuilder {
+	tb.keepFail = keep
+	return tb
+}
+
+// SetPoolDebug makes the built Trie check its use of pooled match
+// buffers, for tests hunting ReleaseMatches bugs: releasing a result a
+// second time, through any slice or copy sharing its first Match, panics
+// instead of corrupting a later result, and so does reading a released
+// Match through its accessors. Released buffers are never reused, so
+// the pool saves nothing; leave it off in production. Decoded tries
+// have it off.
+func (tb *TrieBuilder) SetPoolDebug(on bool) *TrieBuilder {
+	tb.poolDebug = on
+	return tb
+}
+
+// SetMaxPatternLen rejects patterns longer than n bytes, so a single
+// oversized entry from an untrusted source cannot blow up build memory.
+// A rejected pattern is left out of the Trie but still uses up its id,
+// keeping later ids equal to insertion indexes; the first rejection is
+// reported by Err, naming the pattern. n <= 0, the default, removes the
+// limit. The limit applies to patterns added after the call.
+func (tb *TrieBuilder) SetMaxPatternLen(n int) *TrieBuilder {
+	tb.maxPatternLen = max(n, 0)
+	return tb
+}
+
+// Err returns the first pattern rejection, wrapping ErrPatternTooLong,
+// or nil if every pattern was added. Build ignores rejections and
+// produces a Trie of the patterns that were accepted.
+func (tb *TrieBuilder) Err() error {
+	return tb.err
+}
+
+// ShortPatterns returns copies of the patterns added so far that are
+// shorter than minLen bytes, in insertion order, for reviewing a
+// dictionary before Build: a 1- or 2-byte pattern matches almost any
+// input, flooding callers with matches. Lengths are of the patterns as
+// added, before any byte transform or whitespace collapsing; a pattern
+// added twice is returned twice, and an empty one is returned too,
+// although it never matches. Patterns rejected by SetMaxPatternLen are
+// not returned.
+func (tb *TrieBuilder) ShortPatterns(minLen int) [][]byte {
+	var short [][]byte
+	for _, r := range tb.textRefs {
+		if int(r.n) < minLen {
+			short = append(short, bytes.Clone(tb.text[r.off:r.off+r.n]))
+		}
+	}
+	return short
+}
+
+// SubstringPatterns maps the id of each pattern found inside another
+// pattern to the sorted ids of the patterns containing it, for pruning
+// redundant dictionary entries: with "cat", "category", and "dog" added
+// in that order, it returns {0: [1]}. Patterns contained in no other are
+// left out, as are patterns sharing an id with the one they are found
+// in. Containment is judged on the patterns as the automaton holds them,
+// after any byte transform or whitespace collapsing.
+//
+// It reads every pattern's outputs off the partially built automaton,
+// computing the failure links Build would, so it costs time
+// proportional to the states plus the containments found.
+func (tb *TrieBuilder) SubstringPatterns() map[int][]int {
+	tb.computeFailLinks()
+	tb.computeDictLinks()
+
+	// A depth-first walk of the goto tree keeps in ends the pattern
+	// states that end somewhere along the current path: the outputs of
+	// every state on it. A pattern state's path is its pattern, so ends
+	// then lists the patterns inside it.
+	type frame struct {
+		s    uint32
+		mark int // length of ends at the parent
+	}
+	found := make(map[int][]int)
+	var ends []uint32
+	stack := []frame{{s: rootState}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		ends = ends[:f.mark]
+		if tb.states[f.s].dict != 0 {
+			ends = append(ends, f.s)
+		}
+		for u := tb.states[f.s].dictLink; u != nilState; u = tb.states[u].dictLink {
+			ends = append(ends, u)
+		}
+		if tb.states[f.s].dict != 0 {
+			p := int(tb.states[f.s].pattern)
+			for _, u := range ends {
+				if q := int(tb.states[u].pattern); q != p {
+					found[q] = append(found[q], p)
+				}
 			}
-			tb.AddPattern(pattern)
+		}
+		for t := tb.states[f.s].firstChild; t != 0; t = tb.states[t].nextSib {
+			stack = append(stack, frame{s: t, mark: len(ends)})
 		}
 	}
+	for q, ps := range found {
+		slices.Sort(ps)
+		found[q] = slices.Compact(ps)
+	}
+	return found
+}
 
-	return s.Err()
+// allowed reports whether the automaton may move on byte c.
+func (tb *TrieBuilder) allowed(c byte) bool {
+	return tb.alphabet == nil || tb.alphabet[c]
+}
+
+// PatternEncoding selects how LoadPatterns decodes each line of a
+// pattern file.
+type PatternEncoding int
+
+const (
+	// PatternHex reads each line as hexadecimal. It is the default.
+	PatternHex PatternEncoding = iota
+	// PatternBase64 reads each line as standard, padded base64.
+	PatternBase64
+	// PatternRaw takes each line's bytes verbatim, surrounding
+	// whitespace included.
+	PatternRaw
+)
+
+// SetPatternEncoding sets the encoding LoadPatterns expects.
+func (tb *TrieBuilder) SetPatternEncoding(enc PatternEncoding) *TrieBuilder {
+	tb.encoding = enc
+	return tb
+}
+
+// SetRecordSeparator makes the Load functions split pattern files on sep
+// instead of on lines, so a file separating records with NUL bytes can
+// hold patterns containing newlines. A final record need not end in
+// sep. The default, '\n', also drops a carriage return ending a record,
+// so CRLF files load like LF ones; other separators take records as
+// they are, before each loader's own trimming.
+func (tb *TrieBuilder) SetRecordSeparator(sep byte) *TrieBuilder {
+	tb.separator, tb.sepSet = sep, sep != '\n'
+	return tb
 }
 
-// LoadStrings loads string patterns from a file. Expects one pattern per line.
-// Empty lines are skipped. Returns error if file cannot be opened.
+// LoadPatterns loads byte patterns from a file. Expects one pattern per line, in hexadecimal form
+// unless SetPatternEncoding chose another encoding. Empty lines are skipped. Returns error if file
+// cannot be opened or if a line fails to decode; decode errors name the file and line. A gzip
+// compressed file is decompressed as it is read, whatever its name.
+func (tb *TrieBuilder) LoadPatterns(path string) error {
+	switch tb.encoding {
+	case PatternBase64:
+		return tb.loadLines(path, true, tb.addDecoded(base64.StdEncoding.DecodeString))
+	case PatternRaw:
+		return tb.loadLines(path, false, tb.addDecoded(func(line string) ([]byte, error) {
+			return []byte(line), nil
+		}))
+	}
+	return tb.loadLines(path, true, tb.addDecoded(hex.DecodeString))
+}
+
+// LoadStrings loads string patterns from a file. Expects one pattern per
+// line, or per record under SetRecordSeparator. Empty lines are skipped.
+// Returns error if file cannot be opened. A gzip compressed file is
+// decompressed as it is read, whatever its name.
+//
+// Lines are kept byte for byte, NULs included, apart from the trimmed
+// white space around them, so a pattern cannot hold a newline or begin
+// or end in white space. Binary patterns are safer written in hex for
+// LoadPatterns.
 func (tb *TrieBuilder) LoadStrings(path string) error {
+	return tb.loadLines(path, true, tb.addDecoded(func(line string) ([]byte, error) {
+		return []byte(line), nil
+	}))
+}
+
+// LoadTSVWithIDs loads string patterns with external ids, as rule
+// databases often ship them: one "pattern<TAB>id" line per pattern, each
+// added with AddPatternWithID. The id is the decimal number after the
+// last tab, so patterns may themselves contain tabs; the pattern is
+// taken verbatim, while white space around the id is ignored. Empty
+// lines are skipped. A line with no tab, an empty pattern, or an id that
+// is not a uint32 fails the load with an error naming the file and line;
+// the lines before it are already added. A gzip compressed file is
+// decompressed as it is read.
+func (tb *TrieBuilder) LoadTSVWithIDs(path string) error {
+	return tb.loadLines(path, false, func(line string) error {
+		i := strings.LastIndexByte(line, '\t')
+		if i < 0 {
+			return errors.New("missing tab before the id")
+		}
+		if i == 0 {
+			return errors.New("empty pattern")
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(line[i+1:]), 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad id: %w", err)
+		}
+		tb.AddPatternWithID([]byte(line[:i]), uint32(id))
+		return nil
+	})
+}
+
+// LoadStringsGlob runs LoadStrings on every file matching the
+// filepath.Glob pattern, in lexical order, and returns how many files it
+// loaded; directories that match are skipped. A pattern appearing in
+// several files is stored once, under the id of its last occurrence, as
+// when it is added twice. It stops at the first file that fails, with
+// the files before it already loaded. A malformed pattern reports
+// filepath.ErrBadPattern; matching nothing is not an error.
+func (tb *TrieBuilder) LoadStringsGlob(pattern string) (filesLoaded int, err error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return 0, err
+	}
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			continue
+		}
+		if err := tb.LoadStrings(path); err != nil {
+			return filesLoaded, err
+		}
+		filesLoaded++
+	}
+	return filesLoaded, nil
+}
+
+// gzipMagic opens every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// splitOn is a bufio.SplitFunc for records ending in sep.
+func splitOn(sep byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// addDecoded returns a loadLines callback adding the pattern decode
+// returns for each line.
+func (tb *TrieBuilder) addDecoded(decode func(string) ([]byte, error)) func(string) error {
+	return func(line string) error {
+		pattern, err := decode(line)
+		if err != nil {
+			return err
+		}
+		tb.AddPattern(pattern)
+		return nil
+	}
+}
+
+// loadLines calls add for each non-empty line of the file at path, or
+// record under SetRecordSeparator, trimming surrounding whitespace first
+// if trim is set, and names the file and line (record) in add's errors.
+// A file starting with the gzip magic bytes is decompressed first.
+func (tb *TrieBuilder) loadLines(path string, trim bool, add func(string) error) error {
 	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	s := bufio.NewScanner(f)
+	var r io.Reader = bufio.NewReader(f)
+	if magic, _ := r.(*bufio.Reader).Peek(2); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	s := bufio.NewScanner(r)
+	if tb.sepSet {
+		s.Split(splitOn(tb.separator))
+	}
 
-	for s.Scan() {
-		str := strings.TrimSpace(s.Text())
+	for line := 1; s.Scan(); line++ {
+		str := s.Text()
+		if trim {
+			str = strings.TrimSpace(str)
+		}
 		if len(str) != 0 {
-			tb.AddString(str)
+			if err := add(str); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, line, err)
+			}
 		}
 	}
 
 	return s.Err()
 }
 
+// EstimateBuildBytes returns the bytes of tables Build would allocate for
+// the patterns added so far, without building anything: the per-state
+// pattern arrays and the transition tables. A compact Trie (see
+// Trie.IsCompact) has only the half-width table for up to 32768 states,
+// otherwise the byte-class table; any other has the full table (1 KiB
+// per state) and the half-width or possibly the byte-class table on top.
+// The builder's own states, already allocated, stay live until Build
+// returns and come on top. Services can compare the estimate against a
+// memory budget before calling Build.
+func (tb *TrieBuilder) EstimateBuildBytes() int {
+	n := len(tb.states)
+	size := n * (3*4 + 8) // dict, pattern, dictLink; dictPat
+	if len(tb.priority) != 0 {
+		size += n * 8
+	}
+	if len(tb.endAnchored) != 0 {
+		size += n
+	}
+	if tb.keepText {
+		size += len(tb.text) + len(tb.textRefs)*12
+	}
+	if tb.keepFail {
+		size += n * 4
+	}
+	live := tb.liveBytes()
+	stride, compact := tb.compactStride(&live)
+	if !compact {
+		size += n * 256 * 4
+	}
+	if n <= failTrans16MaxStates {
+		return size + n*256*2
+	}
+	if compact {
+		return size + n*stride*4
+	}
+	// The class table needs a scan path that reads it: one with several
+	// root stop bytes (see classTableUsable).
+	var rootChild [256]bool
+	for t := tb.states[rootState].firstChild; t != 0; t = tb.states[t].nextSib {
+		rootChild[tb.states[t].value] = tb.allowed(tb.states[t].value)
+	}
+	stops := 0
+	for b := range rootChild {
+		c := byte(b)
+		if tb.xlat != nil {
+			c = tb.xlat[b]
+		}
+		if rootChild[c] {
+			stops++
+		}
+	}
+	if stops != 1 {
+		size += n * classTableStride(&live) * 4
+	}
+	return size
+}
+
+// liveBytes returns the input bytes some state moves on. Every state
+// except 0 and the root is some state's child, and value is the byte on
+// its incoming edge, so indexing the flat state slice yields the bytes
+// the patterns use, less any the alphabet excludes; an input byte is
+// live when the byte it transforms to is.
+func (tb *TrieBuilder) liveBytes() [256]bool {
+	var live [256]bool
+	for i := range tb.states {
+		if i != 0 && uint32(i) != rootState && tb.allowed(tb.states[i].value) {
+			live[tb.states[i].value] = true
+		}
+	}
+	if tb.xlat != nil {
+		byValue := live
+		for b := range live {
+			live[b] = byValue[tb.xlat[b]]
+		}
+	}
+	return live
+}
+
+// compactStride reports whether Build makes the Trie compact (see
+// Trie.IsCompact), given its live bytes, and the class row stride it
+// uses then, 0 when failTrans16 holds the rows. A Trie is compact when
+// no byte of 0x80 or above is live, or tb.compact is set, and, past
+// failTrans16's reach, the class row is at most half a full row.
+func (tb *TrieBuilder) compactStride(live *[256]bool) (int, bool) {
+	if !tb.compact && slices.Contains(live[0x80:], true) {
+		return 0, false
+	}
+	n := len(tb.states)
+	if n <= failTrans16MaxStates {
+		return 0, true
+	}
+	stride := classTableStride(live)
+	// Premultiplied offsets must fit 31 bits with the flag in bit 0.
+	if stride == 0 || uint64(n)*uint64(stride) >= 1<<31 {
+		return 0, false
+	}
+	return stride, true
+}
+
 // Build constructs the final Trie structure.
 // This involves:
 //  1. Computing failure and dictionary links.
-//  2. Renumbering states in BFS order so frequently visited (shallow)
-//     states are packed together for cache and TLB locality.
+//  2. Renumbering states in BFS order (or by weight, see
+//     SetPatternWeights) so frequently visited states are packed
+//     together for cache and TLB locality.
 //  3. Converting the state graph into array-based representation,
 //     pre-computing all transitions and output flags in one DP pass.
 //  4. Setting up object pools for match results.
@@ -202,22 +925,81 @@ func (tb *TrieBuilder) Build() *Trie {
 			order = append(order, t)
 		}
 	}
+	if len(tb.weights) != 0 {
+		tb.weightIDs(order, newID)
+	}
 
-	// Initialize the array-based trie structure.
+	// Initialize the array-based trie structure. A compact Trie gets no
+	// full table; its rows go to failTrans16 or failTransC alone.
+	live := tb.liveBytes()
+	stride, compact := tb.compactStride(&live)
 	trie := &Trie{
-		failTrans: make([][256]uint32, numStates),
-		dictLink:  make([]uint32, numStates),
-		dict:      make([]uint32, numStates),
-		pattern:   make([]uint32, numStates),
+		dictLink: make([]uint32, numStates),
+		dict:     make([]uint32, numStates),
+		pattern:  make([]uint32, numStates),
+	}
+	if !compact {
+		trie.failTrans = make([][256]uint32, numStates)
 	}
 
 	// Set up object pool for match buffer reuse.
-	trie.bufPool = newBufPool()
+	trie.bufPool = newBufPool(trie, tb.poolCap)
+	trie.poolDebug = tb.poolDebug
+
+	if len(tb.priority) != 0 {
+		trie.priority = make([]int, numStates)
+		for s, prio := range tb.priority {
+			trie.priority[newID[s]] = prio
+		}
+	}
+	if len(tb.endAnchored) != 0 {
+		trie.endAnchored = make([]bool, numStates)
+		for s := range tb.endAnchored {
+			trie.endAnchored[newID[s]] = true
+		}
+	}
+	if tb.keepFail {
+		trie.keepFail = true
+		trie.failLink = make([]uint32, numStates)
+		for sid := range tb.states {
+			trie.failLink[newID[sid]] = newID[tb.states[sid].failLink]
+		}
+	}
 
 	half := numStates <= failTrans16MaxStates
 	if half {
 		trie.failTrans16 = make([]uint16, numStates*256)
 	}
+	// The class rows of a compact Trie too large for failTrans16 are
+	// built by the same DP, one class per byte value the patterns use;
+	// classOf then sends each input byte to its transformed value's
+	// class, so the byte transform needs no pass over them.
+	var valueClass [256]uint8
+	var shift uint32
+	if compact && !half {
+		shift = uint32(bits.TrailingZeros(uint(stride)))
+		numClasses := 1
+		for i := range tb.states {
+			if v := tb.states[i].value; i != 0 && uint32(i) != rootState && tb.allowed(v) && valueClass[v] == 0 {
+				valueClass[v] = 1
+			}
+		}
+		for v := range valueClass {
+			if valueClass[v] != 0 {
+				valueClass[v] = uint8(numClasses)
+				numClasses++
+			}
+		}
+		for b := range trie.classOf {
+			c := byte(b)
+			if tb.xlat != nil {
+				c = tb.xlat[b]
+			}
+			trie.classOf[b] = valueClass[c]
+		}
+		trie.classShift = shift
+		trie.failTransC = make([]uint32, numStates<<shift)
+	}
 
 	// Convert the state graph into arrays using the BFS numbering.
 	// Transition rows are built by the classic goto/fail dynamic
@@ -229,25 +1011,41 @@ func (tb *TrieBuilder) Build() *Trie {
 	// flags (same targets), and each own-child entry takes its flag
 	// straight from the child's dict/dictLink, so no separate flag
 	// pass over the table is needed. The half-width table is built by
-	// the same DP.
-	for i, sid := range order {
+	// the same DP. Own children on bytes outside the alphabet are never
+	// written, so those columns keep the root's entry in every row.
+	for _, sid := range order {
+		i := newID[sid]
 		s := &tb.states[sid]
 		trie.dict[i] = s.dict
 		trie.pattern[i] = s.pattern
 		if s.dictLink != 0 {
 			trie.dictLink[i] = newID[s.dictLink]
 		}
-		row := &trie.failTrans[i]
-		if sid == 0 || sid == rootState {
-			// State 0 (unused) and the root: every unclaimed byte
-			// goes to the root, which never emits.
-			for b := range row {
-				row[b] = rootState
+		var row *[256]uint32
+		if !compact {
+			row = &trie.failTrans[i]
+			if sid == 0 || sid == rootState {
+				// State 0 (unused) and the root: every unclaimed byte
+				// goes to the root, which never emits.
+				for b := range row {
+					row[b] = rootState
+				}
+			} else {
+				// copy (memmove) beats a struct assignment (duffcopy)
+				// for the 1KB row on amd64.
+				copy(row[:], trie.failTrans[newID[s.failLink]][:])
+			}
+		}
+		var crow []uint32
+		if trie.failTransC != nil {
+			crow = trie.failTransC[i<<shift : i<<shift+uint32(stride)]
+			if sid == 0 || sid == rootState {
+				for c := range crow {
+					crow[c] = rootState << shift
+				}
+			} else {
+				copy(crow, trie.failTransC[newID[s.failLink]<<shift:])
 			}
-		} else {
-			// copy (memmove) beats a struct assignment (duffcopy)
-			// for the 1KB row on amd64.
-			copy(row[:], trie.failTrans[newID[s.failLink]][:])
 		}
 		var row16 []uint16
 		if half {
@@ -262,46 +1060,67 @@ func (tb *TrieBuilder) Build() *Trie {
 		}
 		for t := s.firstChild; t != 0; t = tb.states[t].nextSib {
 			ts := &tb.states[t]
+			if !tb.allowed(ts.value) {
+				continue
+			}
 			v := newID[t]
 			if ts.dict != 0 || ts.dictLink != 0 {
 				v |= outputFlag
 			}
-			row[ts.value] = v
+			if row != nil {
+				row[ts.value] = v
+			}
 			if half {
 				row16[ts.value] = packState16(v)
 			}
+			if crow != nil {
+				crow[valueClass[ts.value]] = (v&stateMask)<<shift | v>>31
+			}
 		}
 	}
 
+	if tb.xlat != nil {
+		trie.applyByteTransform(tb.xlat)
+	}
+
 	trie.buildDictPat()
 	trie.buildRootSkip()
-	// Compute the live-byte set only when a scan path exists to read the
-	// class table; single-stop and failTrans16 tries never load it, and
-	// building it anyway would retain up to 512B/state of dead weight.
-	// Every state except 0 and the root is some state's child, and value
-	// is the byte on its incoming edge, so indexing the flat state slice
-	// yields the same set the child walk did.
-	if trie.classTableUsable() {
-		var live [256]bool
-		for i := range tb.states {
-			if i != 0 && uint32(i) != rootState {
-				live[tb.states[i].value] = true
-			}
-		}
+	// Build the class table only when a scan path exists to read it;
+	// single-stop and failTrans16 tries never load it, and building it
+	// anyway would retain up to 512B/state of dead weight. A compact
+	// Trie already has its table.
+	if !compact && trie.classTableUsable() {
 		trie.buildClassTable(&live)
 	}
 	trie.setStopEntry()
 	trie.buildSinglePattern()
+	trie.wholeWord = tb.wholeWord
+	trie.collapseSpace = tb.collapseSpace
+	trie.utf8Policy = tb.utf8Policy
+	if len(tb.values) != 0 {
+		trie.values = maps.Clone(tb.values)
+	}
+	if tb.keepText {
+		// Later additions append past the end of text, so the Trie can
+		// share it; the refs are sorted, so they are copied.
+		trie.text = tb.text[:len(tb.text):len(tb.text)]
+		trie.textRefs = slices.Clone(tb.textRefs)
+		slices.SortStableFunc(trie.textRefs, func(a, b textRef) int { return cmp.Compare(a.id, b.id) })
+		trie.textLink = &matchBuf{tr: trie}
+	}
+	trie.frozen = true
 
 	return trie
 }
 
 // computeFailTransition determines the next state for a given state and input byte.
-// It follows failure links until it finds a valid transition or reaches the root.
+// It follows failure links until it finds a valid transition or passes the
+// root, whose failure link is nilState; a byte no state on the chain has
+// an edge for leads to the root (the root's self-loop).
 // Kept as the reference definition of the transition function; Build derives
 // the same values with the row DP, and TestDPEquivalence cross-checks them.
 func (tb *TrieBuilder) computeFailTransition(s uint32, c byte) uint32 {
-	for t := s; t != 0; t = tb.states[t].failLink {
+	for t := s; t != nilState; t = tb.states[t].failLink {
 		if next := tb.child(t, c); next != 0 {
 			return next
 		}
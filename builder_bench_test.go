@@ -0,0 +1,160 @@
+package ahocorasick
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// BenchmarkBuildTiny measures building many tiny, short-lived tries; its
+// allocations are the tables alone, since Build leaves the match buffer
+// pool empty until the first Match.
+func BenchmarkBuildTiny(b *testing.B) {
+	patterns := []string{"he", "she", "his", "hers"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewTrieBuilder().AddStrings(patterns).Build()
+	}
+}
+
+// BenchmarkMatchPoolCapacity matches an input with about 3,000 matches
+// from a cold pool, as after a garbage collection empties it, with and
+// without SetMatchPoolCapacity presizing the new buffer.
+func BenchmarkMatchPoolCapacity(b *testing.B) {
+	input := []byte(strings.Repeat("ushers ", 1000))
+	for _, n := range []int{0, 4096} {
+		b.Run(fmt.Sprintf("cap=%d", n), func(b *testing.B) {
+			trie := NewTrieBuilder().
+				AddStrings([]string{"he", "she", "his", "hers"}).
+				SetMatchPoolCapacity(n).
+				Build()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				trie.bufPool = newBufPool(trie, n)
+				trie.ReleaseMatches(trie.Match(input))
+			}
+		})
+	}
+}
+
+// BenchmarkASCIICompact builds ASCII dictionaries on either side of the
+// half-width table's limit and reports, per state, the bytes the Trie
+// retains against the bytes it would retain with the full table as well.
+// The small Trie keeps only the half-width table and the large one only
+// the byte-class rows, in which high bytes share the dead class.
+func BenchmarkASCIICompact(b *testing.B) {
+	var ascii []string
+	for _, p := range benchReadLines(b, "./test_data/NSF-ordlisten.cleaned.txt", 0) {
+		if !strings.ContainsFunc(p, func(r rune) bool { return r >= 0x80 }) {
+			ascii = append(ascii, p)
+		}
+	}
+	for _, bc := range []struct {
+		name string
+		n    int
+	}{
+		{"small", 3000},
+		{"large", 30000},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var trie *Trie
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				trie = NewTrieBuilder().AddStrings(ascii[:bc.n]).Build()
+			}
+			if !trie.IsCompact() {
+				b.Fatal("dictionary did not build compact")
+			}
+			full := fullTable(NewTrieBuilder().AddStrings(ascii[:bc.n]).Build())
+			b.ReportMetric(float64(trie.tableBytes())/float64(trie.NumStates()), "retainedB/state")
+			b.ReportMetric(float64(full.tableBytes())/float64(full.NumStates()), "fullB/state")
+		})
+	}
+}
+
+// BenchmarkPatternWeights scans a skewed workload, text made of a few
+// hundred words drawn from across a large dictionary, with the plain
+// breadth-first numbering and with the hot words weighted, which packs
+// their rows at the front of the table.
+func BenchmarkPatternWeights(b *testing.B) {
+	words := benchReadLines(b, "./test_data/NSF-ordlisten.cleaned.txt", 0)
+	var hot []string
+	weights := make(map[int]float64)
+	for i := 0; i < len(words); i += len(words) / 300 {
+		hot = append(hot, words[i])
+		weights[i] = 1
+	}
+	var sb strings.Builder
+	for i := 0; sb.Len() < 1<<20; i++ {
+		sb.WriteString(hot[i*7919%len(hot)])
+		sb.WriteByte(' ')
+	}
+	input := []byte(sb.String())
+	for _, weighted := range []bool{false, true} {
+		tb := NewTrieBuilder().AddStrings(words)
+		if weighted {
+			tb.SetPatternWeights(weights)
+		}
+		trie := tb.Build()
+		b.Run(fmt.Sprintf("weighted=%v", weighted), func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				trie.Count(input)
+			}
+		})
+	}
+}
+
+// BenchmarkCaseInsensitive scans English text for a few hundred
+// keywords case-sensitively, with WithCaseInsensitive, and by folding
+// the input through a [256]byte table before a case-sensitive scan. The
+// byte transform is baked into the transition table at Build, so the
+// case-insensitive scan does the same work per byte as the sensitive
+// one, while folding the input first adds a pass and a copy.
+func BenchmarkCaseInsensitive(b *testing.B) {
+	input, err := os.ReadFile("./test_data/gpl.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var keywords [][]byte
+	for _, w := range strings.Fields(strings.ToLower(string(input[:8192]))) {
+		if len(w) > 3 {
+			keywords = append(keywords, []byte(w))
+		}
+	}
+	var fold [256]byte
+	for c := range fold {
+		fold[c] = foldASCII(byte(c))
+	}
+	sensitive, err := Compile(keywords)
+	if err != nil {
+		b.Fatal(err)
+	}
+	folded, err := Compile(keywords, WithCaseInsensitive())
+	if err != nil {
+		b.Fatal(err)
+	}
+	scratch := make([]byte, len(input))
+
+	for _, bc := range []struct {
+		name string
+		run  func() int
+	}{
+		{"sensitive", func() int { return sensitive.Count(input) }},
+		{"transform", func() int { return folded.Count(input) }},
+		{"fold-input", func() int {
+			for i, c := range input {
+				scratch[i] = fold[c]
+			}
+			return sensitive.Count(scratch)
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				bc.run()
+			}
+		})
+	}
+}
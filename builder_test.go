@@ -1,8 +1,17 @@
 package ahocorasick
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -54,3 +63,653 @@ func TestLoadPatterns(t *testing.T) {
 		t.Errorf("expected %d matches, got %d\n", expected, len(ms))
 	}
 }
+
+func TestPatternEncodings(t *testing.T) {
+	hexLines, err := ioutil.ReadFile("./test_data/patterns.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patterns [][]byte
+	for _, line := range strings.Fields(string(hexLines)) {
+		p, err := hex.DecodeString(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, p)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, encode func([]byte) string) string {
+		var buf bytes.Buffer
+		for _, p := range patterns {
+			buf.WriteString(encode(p) + "\n")
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	files := map[PatternEncoding]string{
+		PatternHex:    "./test_data/patterns.txt",
+		PatternBase64: write("base64.txt", base64.StdEncoding.EncodeToString),
+		PatternRaw:    write("raw.txt", func(p []byte) string { return string(p) }),
+	}
+
+	var want bytes.Buffer
+	if err := Encode(&want, NewTrieBuilder().AddPatterns(patterns).Build()); err != nil {
+		t.Fatal(err)
+	}
+	for enc, path := range files {
+		tb := NewTrieBuilder().SetPatternEncoding(enc)
+		if err := tb.LoadPatterns(path); err != nil {
+			t.Fatalf("encoding %d: %v", enc, err)
+		}
+		var got bytes.Buffer
+		if err := Encode(&got, tb.Build()); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("encoding %d: trie differs from the one built from the patterns", enc)
+		}
+	}
+
+	// Raw lines keep their whitespace; decode errors name the line.
+	path := filepath.Join(dir, "mixed.txt")
+	if err := os.WriteFile(path, []byte("6869\n\n!!\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = NewTrieBuilder().SetPatternEncoding(PatternBase64).LoadPatterns(path)
+	if err == nil || !strings.Contains(err.Error(), "mixed.txt:3:") {
+		t.Errorf("base64: expected an error at line 3, got %v", err)
+	}
+	err = NewTrieBuilder().LoadPatterns(path)
+	if err == nil || !strings.Contains(err.Error(), "mixed.txt:3:") {
+		t.Errorf("hex: expected an error at line 3, got %v", err)
+	}
+	if err := os.WriteFile(path, []byte(" a \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tb := NewTrieBuilder().SetPatternEncoding(PatternRaw)
+	if err := tb.LoadPatterns(path); err != nil {
+		t.Fatal(err)
+	}
+	if ms := tb.Build().MatchString("a  a "); len(ms) != 1 || ms[0].Pos() != 2 {
+		t.Errorf("raw: expected \" a \" at 2, got %v", ms)
+	}
+}
+
+func TestAddPatternWithID(t *testing.T) {
+	tr := NewTrieBuilder().
+		AddPatternWithID([]byte("or"), 7001).
+		AddPatternWithID([]byte("amet"), 42).
+		AddPatternWithID([]byte("sit"), 1<<31+5).
+		Build()
+
+	matches := tr.MatchString("Lorem ipsum dolor sit amet, consectetur adipiscing elit.")
+	expected := []*Match{
+		newMatchString(1, 7001, "or"),
+		newMatchString(15, 7001, "or"),
+		newMatchString(18, 1<<31+5, "sit"),
+		newMatchString(22, 42, "amet"),
+	}
+	if len(matches) != len(expected) {
+		t.Fatalf("expected %d matches, got %d", len(expected), len(matches))
+	}
+	for i := range matches {
+		if !MatchEqual(expected[i], matches[i]) {
+			t.Errorf("expected %v, got %v", expected[i], matches[i])
+		}
+	}
+
+	// Explicit ids survive the round trip through the wire format.
+	var buf bytes.Buffer
+	if err := Encode(&buf, tr); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := decoded.MatchFirstString("amet"); m == nil || m.Pattern() != 42 {
+		t.Errorf("decoded trie: expected pattern 42, got %v", m)
+	}
+}
+
+func TestSetAlphabet(t *testing.T) {
+	dns := []byte("abcdefghijklmnopqrstuvwxyz0123456789-.")
+	patterns := []string{"example.com", "bad_host", "ample"}
+	tr := NewTrieBuilder().SetAlphabet(dns).AddStrings(patterns).Build()
+
+	// "bad_host" contains '_' and can never match.
+	input := []byte("www.example.com bad_host x.example.com")
+	want := [][3]uint32{{6, 2, 5}, {4, 0, 11}, {29, 2, 5}, {27, 0, 11}}
+	if got := triplesFromMatches(tr.Match(input)); diffTriples(got, want) != -1 {
+		t.Errorf("Match: expected %v, got %v", want, got)
+	}
+	if got := tr.triplesFromWalk(input); diffTriples(got, want) != -1 {
+		t.Errorf("Walk: expected %v, got %v", want, got)
+	}
+
+	// An out-of-alphabet byte resets a partial match.
+	if m := tr.MatchString("ex\xffample.com"); len(m) != 1 || m[0].MatchString() != "ample" {
+		t.Errorf("expected only %q after the reset, got %v", "ample", m)
+	}
+
+	// Pattern recovery reports only the patterns that can match.
+	if got := tr.Patterns(); !equalBytesList(got, bytesList("example.com", "ample")) {
+		t.Errorf("Patterns: expected the two reachable patterns, got %q", got)
+	}
+
+	// Without the alphabet the same patterns all match.
+	if m := NewTrieBuilder().AddStrings(patterns).Build().MatchString("bad_host"); len(m) != 1 {
+		t.Errorf("unrestricted trie: expected 1 match, got %v", m)
+	}
+
+	// The restriction is part of the transition table and survives a
+	// round trip.
+	var buf bytes.Buffer
+	if err := Encode(&buf, tr); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := decoded.MatchString("bad_host example.com"); len(m) != 2 {
+		t.Errorf("decoded: expected 2 matches, got %v", m)
+	}
+}
+
+func TestSetAlphabetClassTable(t *testing.T) {
+	// Binary strings over {a, b} with an "xyz" suffix: enough states to
+	// need the class-compressed table. Excluding x, y and z must drop
+	// their columns, halving the stride from 8 (dead + 5 live classes)
+	// to 4 (dead + a + b).
+	build := func(alphabet []byte) *Trie {
+		tb := NewTrieBuilder().SetAlphabet(alphabet)
+		for i := 0; i < 40000; i++ {
+			p := []byte(fmt.Sprintf("%016b", i))
+			for k := range p {
+				p[k] += 'a' - '0'
+			}
+			tb.AddPattern(append(p, "xyz"...))
+		}
+		return tb.Build()
+	}
+	for _, tt := range []struct {
+		alphabet []byte
+		shift    uint32
+	}{{nil, 3}, {[]byte("ab"), 2}} {
+		tr := build(tt.alphabet)
+		if tr.failTransC == nil || tr.classShift != tt.shift {
+			t.Errorf("alphabet %q: expected class shift %d, got %d (table built: %v)",
+				tt.alphabet, tt.shift, tr.classShift, tr.failTransC != nil)
+		}
+	}
+}
+
+func TestSetByteTransform(t *testing.T) {
+	digits := func(c byte) byte {
+		if c >= '0' && c <= '9' {
+			return '0'
+		}
+		return c
+	}
+	tr := NewTrieBuilder().SetByteTransform(digits).AddString("A0").Build()
+	if ms := tr.MatchString("xA7y A99"); len(ms) != 2 ||
+		!MatchEqual(ms[0], newMatchString(1, 0, "A7")) || !MatchEqual(ms[1], newMatchString(5, 0, "A9")) {
+		t.Errorf("digits: expected A7 at 1 and A9 at 5, got %v", ms)
+	}
+
+	// Every scan path must agree with matching the transformed patterns
+	// against the transformed input: the half-width table (small), the
+	// class-compressed table (large), and MatchSkip.
+	fold := func(c byte) byte {
+		if c >= 'A' && c <= 'Z' {
+			return c + 'a' - 'A'
+		}
+		return c
+	}
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen, err := ioutil.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen = ibsen[:100<<10]
+	folded := make([]byte, len(ibsen))
+	for i, c := range ibsen {
+		folded[i] = fold(c)
+	}
+	for _, n := range []int{500, 20000} {
+		upper := make([]string, n)
+		for i, p := range patterns[:n] {
+			if c := p[0]; c >= 'a' && c <= 'z' {
+				p = string(c-'a'+'A') + p[1:]
+			}
+			upper[i] = p
+		}
+		tr := NewTrieBuilder().SetByteTransform(fold).AddStrings(upper).Build()
+		ref := NewTrieBuilder().AddStrings(patterns[:n]).Build()
+		want := ref.triplesFromWalk(folded)
+		if len(want) == 0 {
+			t.Fatalf("%d patterns: no reference matches", n)
+		}
+		if i := diffTriples(triplesFromMatches(tr.Match(ibsen)), want); i >= 0 {
+			t.Errorf("%d patterns: Match differs at %d", n, i)
+		}
+		if i := diffTriples(tr.triplesFromWalk(ibsen), want); i >= 0 {
+			t.Errorf("%d patterns: Walk differs at %d", n, i)
+		}
+		got := triplesFromMatches(tr.MatchSkip(ibsen))
+		sortTriples(got)
+		sortTriples(want)
+		if i := diffTriples(got, want); i >= 0 {
+			t.Errorf("%d patterns: MatchSkip differs at %d", n, i)
+		}
+	}
+}
+
+func TestEstimateBuildBytes(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alpha := func(c byte) byte {
+		if c >= 'A' && c <= 'Z' {
+			return c + 'a' - 'A'
+		}
+		return c
+	}
+	for name, tb := range map[string]*TrieBuilder{
+		"half-width": NewTrieBuilder().AddStrings(patterns[:1000]),
+		"class":      NewTrieBuilder().AddStrings(patterns[:20000]),
+		"transform":  NewTrieBuilder().SetByteTransform(alpha).AddStrings(patterns[:20000]),
+		"priority":   NewTrieBuilder().AddPatternWithPriority([]byte("x"), 1).AddStrings(patterns[:100]),
+		"anchored":   NewTrieBuilder().AddPatternEndAnchored([]byte("x")).AddStrings(patterns[:100]),
+		"empty":      NewTrieBuilder(),
+	} {
+		est := tb.EstimateBuildBytes()
+		if got := tb.Build().tableBytes(); got != est {
+			t.Errorf("%s: estimated %d bytes, built %d", name, est, got)
+		}
+	}
+}
+
+func TestSetMatchPoolCapacity(t *testing.T) {
+	trie := NewTrieBuilder().
+		AddStrings([]string{"he", "she", "hers"}).
+		SetMatchPoolCapacity(64).
+		Build()
+	buf := trie.bufPool.Get().(*matchBuf)
+	if cap(buf.raw) != 128 || cap(buf.ptrs) != 64 || cap(buf.arena) != 64 {
+		t.Errorf("buffer capacities = %d, %d, %d; want 128, 64, 64",
+			cap(buf.raw), cap(buf.ptrs), cap(buf.arena))
+	}
+	trie.bufPool.Put(buf)
+	matches := trie.MatchString("ushers")
+	if len(matches) != 3 {
+		t.Errorf("got %d matches, want 3", len(matches))
+	}
+	trie.ReleaseMatches(matches)
+}
+
+func TestLoadStringsGlob(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"animals.txt": "cat\ndog\n",
+		"colors.txt":  "red\ncat\n",
+		"notes.md":    "ignored\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub.txt"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tb := NewTrieBuilder()
+	n, err := tb.LoadStringsGlob(filepath.Join(dir, "*.txt"))
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 files, got %d, %v", n, err)
+	}
+	// "cat" appears in both files and keeps the id of its last occurrence.
+	checkMatches(t, "glob", tb.Build().MatchString("red dog cat notes"), []*Match{
+		newMatchString(0, 2, "red"),
+		newMatchString(4, 1, "dog"),
+		newMatchString(8, 3, "cat"),
+	})
+
+	if n, err := NewTrieBuilder().LoadStringsGlob(filepath.Join(dir, "[")); !errors.Is(err, filepath.ErrBadPattern) || n != 0 {
+		t.Errorf("bad pattern: expected ErrBadPattern, got %d, %v", n, err)
+	}
+	if n, err := NewTrieBuilder().LoadStringsGlob(filepath.Join(dir, "*.none")); err != nil || n != 0 {
+		t.Errorf("no matches: expected 0, nil, got %d, %v", n, err)
+	}
+}
+
+func TestAddPatternEndAnchored(t *testing.T) {
+	trie := NewTrieBuilder().
+		AddPatternEndAnchored([]byte(".log")).
+		AddString("app").
+		Build()
+	for _, tc := range []struct {
+		input string
+		want  []string
+	}{
+		{"app.log", []string{"app", ".log"}},
+		{"app.log.gz", []string{"app"}},
+		{".log.log", []string{".log"}},
+		{"", nil},
+	} {
+		var got []string
+		for _, m := range trie.MatchString(tc.input) {
+			got = append(got, string(m.Match()))
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Match(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+		if n := trie.Count([]byte(tc.input)); n != len(tc.want) {
+			t.Errorf("Count(%q) = %d, want %d", tc.input, n, len(tc.want))
+		}
+	}
+
+	// Adding the pattern again unanchored lifts the anchor, also in a
+	// minimized trie.
+	tb := NewTrieBuilder().AddPatternEndAnchored([]byte(".log")).AddString(".log")
+	for _, trie := range []*Trie{tb.Build(), tb.BuildMinimized()} {
+		if n := len(trie.MatchString("a.log.gz")); n != 1 {
+			t.Errorf("re-added pattern: got %d matches, want 1", n)
+		}
+	}
+}
+
+func TestEndAnchoredEntryPoints(t *testing.T) {
+	build := func(reverse bool) *Trie {
+		return NewTrieBuilder().SetReverse(reverse).
+			AddPatternEndAnchored([]byte(".log")).
+			AddStrings([]string{"app", "log"}).
+			Build()
+	}
+	tr := build(false)
+	for _, input := range []string{"app.log.gz app.log", "app.log.gz", "log.log"} {
+		checkEntryPoints(t, tr, build(true), input)
+	}
+	if n := tr.Count([]byte("app.log.gz app.log")); n != 5 {
+		t.Errorf("Walk found %d matches, want 5", n)
+	}
+}
+
+func TestSetPatternWeights(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns = patterns[:5000]
+	weights := map[int]float64{4999: 10, 2500: 5, 17: 1}
+	plain := NewTrieBuilder().AddStrings(patterns).Build()
+	weighted := NewTrieBuilder().AddStrings(patterns).SetPatternWeights(weights).Build()
+
+	// The heaviest pattern's states come right after the root.
+	s, ok := weighted.Descend([]byte(patterns[4999]))
+	if !ok || s != uint32(len(patterns[4999]))+rootState {
+		t.Errorf("heaviest pattern ends in state %d, want %d", s, len(patterns[4999])+1)
+	}
+	if plain.Equal(weighted) {
+		t.Error("weights left the numbering unchanged")
+	}
+	if err := weighted.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	input := []byte(strings.Join(patterns[2400:2600], " ") + patterns[4999] + patterns[17])
+	want, got := plain.Match(input), weighted.Match(input)
+	if len(got) != len(want) {
+		t.Fatalf("weighted trie found %d matches, plain %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].String() != want[i].String() {
+			t.Fatalf("match %d: weighted %v, plain %v", i, got[i], want[i])
+		}
+	}
+	if !slices.EqualFunc(weighted.Patterns(), plain.Patterns(), bytes.Equal) {
+		t.Error("weighted trie recovers different patterns")
+	}
+}
+
+func TestLoadGzip(t *testing.T) {
+	dir := t.TempDir()
+	gzipFile := func(src string) string {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		dst := filepath.Join(dir, filepath.Base(src)) // no .gz: detection is by content
+		if err := os.WriteFile(dst, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return dst
+	}
+
+	load := func(fn func(*TrieBuilder, string) error, path string) *Trie {
+		tb := NewTrieBuilder()
+		if err := fn(tb, path); err != nil {
+			t.Fatal(err)
+		}
+		return tb.Build()
+	}
+	for src, fn := range map[string]func(*TrieBuilder, string) error{
+		"./test_data/strings.txt":  (*TrieBuilder).LoadStrings,
+		"./test_data/patterns.txt": (*TrieBuilder).LoadPatterns,
+	} {
+		if !load(fn, gzipFile(src)).Equal(load(fn, src)) {
+			t.Errorf("%s: gzipped file loads differently", src)
+		}
+	}
+
+	corrupt := filepath.Join(dir, "corrupt")
+	if err := os.WriteFile(corrupt, []byte{0x1f, 0x8b, 0, 0}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewTrieBuilder().LoadStrings(corrupt); err == nil {
+		t.Error("corrupt gzip file loaded without error")
+	}
+}
+
+func TestAddSeq(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns = patterns[:2000]
+	// The generator reuses one buffer, as a database cursor might.
+	seq := func(yield func([]byte) bool) {
+		var buf []byte
+		for _, p := range patterns {
+			buf = append(buf[:0], p...)
+			if !yield(buf) {
+				return
+			}
+		}
+	}
+	var bs [][]byte
+	for _, p := range patterns {
+		bs = append(bs, []byte(p))
+	}
+	if !NewTrieBuilder().AddSeq(seq).Build().Equal(NewTrieBuilder().AddPatterns(bs).Build()) {
+		t.Error("AddSeq built a different trie than AddPatterns")
+	}
+}
+
+func TestSetMaxPatternLen(t *testing.T) {
+	tb := NewTrieBuilder().SetMaxPatternLen(4)
+	tr := tb.AddStrings([]string{"abc", "toolong", "abcd", "waytoolong"}).Build()
+	err := tb.Err()
+	if !errors.Is(err, ErrPatternTooLong) {
+		t.Fatalf("expected ErrPatternTooLong, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "pattern 1 ") {
+		t.Errorf("error should name the first rejected pattern: %v", err)
+	}
+	checkMatches(t, "accepted", tr.MatchString("abcd toolong"), []*Match{
+		newMatchString(0, 0, "abc"),
+		newMatchString(0, 2, "abcd"),
+	})
+
+	tb = NewTrieBuilder().SetMaxPatternLen(4).AddString("abcd")
+	if err := tb.Err(); err != nil {
+		t.Errorf("within the limit: %v", err)
+	}
+
+	_, err = Compile([][]byte{[]byte("ok"), []byte("too long")}, WithMaxPatternLen(4))
+	if !errors.Is(err, ErrPatternTooLong) {
+		t.Errorf("Compile: expected ErrPatternTooLong, got %v", err)
+	}
+}
+
+func TestShortPatterns(t *testing.T) {
+	tb := NewTrieBuilder().AddStrings([]string{"password", "a", "ok", "token"})
+	if got := tb.ShortPatterns(2); len(got) != 1 || string(got[0]) != "a" {
+		t.Errorf("minLen 2: expected [a], got %q", got)
+	}
+	if got := tb.ShortPatterns(3); len(got) != 2 || string(got[0]) != "a" || string(got[1]) != "ok" {
+		t.Errorf("minLen 3: expected [a ok], got %q", got)
+	}
+	if got := tb.ShortPatterns(1); got != nil {
+		t.Errorf("minLen 1: expected none, got %q", got)
+	}
+}
+
+func TestLoadTSVWithIDs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.tsv")
+	if err := os.WriteFile(path, []byte("password\t1001\n\nsecret key\t42\r\nAKIA\t7\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tb := NewTrieBuilder()
+	if err := tb.LoadTSVWithIDs(path); err != nil {
+		t.Fatal(err)
+	}
+	checkMatches(t, "tsv", tb.Build().MatchString("AKIA password secret key"), []*Match{
+		newMatchString(0, 7, "AKIA"),
+		newMatchString(5, 1001, "password"),
+		newMatchString(14, 42, "secret key"),
+	})
+
+	for _, tc := range []struct{ content, want string }{
+		{"ok\t1\nno id here\n", ":2: missing tab"},
+		{"ok\t1\n\t5\n", ":2: empty pattern"},
+		{"bad\tx1\n", ":1: bad id"},
+		{"big\t4294967296\n", ":1: bad id"},
+	} {
+		if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := NewTrieBuilder().LoadTSVWithIDs(path)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got %v, want an error containing %q", tc.content, err, tc.want)
+		}
+	}
+}
+
+func TestSetRecordSeparator(t *testing.T) {
+	dir := t.TempDir()
+	nul := filepath.Join(dir, "nul")
+	if err := os.WriteFile(nul, []byte("line one\nline two\x00plain\x00\x00last"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tb := NewTrieBuilder().SetRecordSeparator(0)
+	if err := tb.LoadStrings(nul); err != nil {
+		t.Fatal(err)
+	}
+	checkMatches(t, "nul", tb.Build().MatchString("line one\nline two, plain, last"), []*Match{
+		newMatchString(0, 0, "line one\nline two"),
+		newMatchString(19, 1, "plain"),
+		newMatchString(26, 2, "last"),
+	})
+
+	crlf := filepath.Join(dir, "crlf")
+	if err := os.WriteFile(crlf, []byte("a b\r\nc\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tb = NewTrieBuilder().SetPatternEncoding(PatternRaw)
+	if err := tb.LoadPatterns(crlf); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tb.Build().MatchString("a b\rc")); got != `[{0 0 "a b"} {4 1 "c"}]` {
+		t.Errorf("CRLF: got %s", got)
+	}
+}
+
+func TestNULPatterns(t *testing.T) {
+	input := []byte("\x00\x00a\x00b\x00zz\x00")
+	want := `[{0 1 "\x00"} {1 1 "\x00"} {3 1 "\x00"} {2 0 "a\x00b"} {5 1 "\x00"} {8 1 "\x00"}]`
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nul.txt")
+	if err := os.WriteFile(path, []byte("a\x00b\n\x00\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewTrieBuilder()
+	if err := loaded.LoadStrings(path); err != nil {
+		t.Fatal(err)
+	}
+	for name, trie := range map[string]*Trie{
+		"AddPattern":  NewTrieBuilder().AddPattern([]byte("a\x00b")).AddPattern([]byte{0}).Build(),
+		"AddString":   NewTrieBuilder().AddStrings([]string{"a\x00b", "\x00"}).Build(),
+		"LoadStrings": loaded.Build(),
+	} {
+		matches := trie.Match(input)
+		if got := fmt.Sprint(matches); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+		trie.ReleaseMatches(matches)
+		if got := trie.Count(input); got != 6 {
+			t.Errorf("%s: Count: expected 6, got %d", name, got)
+		}
+	}
+
+	// A lone pattern takes the single-pattern path.
+	trie := NewTrieBuilder().AddPattern([]byte("a\x00b")).Build()
+	if got := trie.Count([]byte("a\x00ba\x00b\x00a\x00")); got != 2 {
+		t.Errorf("single pattern: expected 2 matches, got %d", got)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, trie); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(decoded.Patterns()); got != "[[97 0 98]]" {
+		t.Errorf("decoded patterns: got %s", got)
+	}
+}
+
+func TestSubstringPatterns(t *testing.T) {
+	tb := NewTrieBuilder().AddStrings([]string{"cat", "category", "dog"})
+	if got, want := fmt.Sprint(tb.SubstringPatterns()), "map[0:[1]]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// Containment anywhere, counted once per containing pattern.
+	tb.AddStrings([]string{"go", "a", "dogma"})
+	if got, want := fmt.Sprint(tb.SubstringPatterns()), "map[0:[1] 2:[5] 3:[1] 4:[0 1 5]]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// Build is unaffected by the links computed early.
+	trie := tb.Build()
+	if n := trie.Count([]byte("the dogma of categories")); n != 6 {
+		t.Errorf("expected 6 matches, got %d", n)
+	}
+}
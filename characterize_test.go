@@ -21,7 +21,7 @@ func TestCharacterize(t *testing.T) {
 	for _, n := range []int{100, 1000, 10000, 100000} {
 		tr := NewTrieBuilder().AddStrings(patterns[:n]).Build()
 		fmt.Printf("patterns=%d states=%d failTrans16=%v stopBytes=%d maxLen=%d\n",
-			n, len(tr.failTrans), tr.failTrans16 != nil, countStop(tr), tr.maxLen)
+			n, tr.NumStates(), tr.failTrans16 != nil, countStop(tr), tr.maxLen)
 	}
 
 	// Which scan path does BenchmarkMatchIbsen take?
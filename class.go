@@ -0,0 +1,125 @@
+package ahocorasick
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxClassExpansion is the most literal patterns AddClassPattern expands
+// one pattern into.
+const MaxClassExpansion = 4096
+
+// ErrClassTooLarge reports a class pattern expanding to more than
+// MaxClassExpansion literals.
+var ErrClassTooLarge = errors.New("ahocorasick: class pattern expands too far")
+
+// AddClassPattern adds every literal a pattern with bracket classes
+// stands for, all under one pattern id, so "gr[ae]y" matches "gray" and
+// "grey" as one pattern while the matcher stays a plain automaton. A
+// class lists bytes and byte ranges, as in "[a-fx]"; a backslash takes
+// the next byte literally, inside a class or out, so "\[" is a bracket.
+// Classes match single bytes, not runes, and cannot be negated.
+//
+// The id is the one AddPattern would hand out, and the expansion counts
+// as one pattern toward later ids. A pattern expanding to more than
+// MaxClassExpansion literals fails with ErrClassTooLarge; a malformed
+// one, such as an unterminated class, fails naming the byte offset. On
+// error nothing is added.
+func (tb *TrieBuilder) AddClassPattern(pattern string) error {
+	sets, err := parseClassPattern(pattern)
+	if err != nil {
+		return err
+	}
+	total := 1
+	for _, set := range sets {
+		if total *= len(set); total > MaxClassExpansion {
+			return fmt.Errorf("%w: %q exceeds %d literals", ErrClassTooLarge, pattern, MaxClassExpansion)
+		}
+	}
+
+	id := tb.numPatterns
+	literal := make([]byte, len(sets))
+	pick := make([]int, len(sets)) // odometer over the sets
+	for {
+		for i, set := range sets {
+			literal[i] = set[pick[i]]
+		}
+		tb.insert(literal, id)
+		i := len(sets) - 1
+		for ; i >= 0; i-- {
+			if pick[i]++; pick[i] < len(sets[i]) {
+				break
+			}
+			pick[i] = 0
+		}
+		if i < 0 {
+			break
+		}
+	}
+	tb.numPatterns = id + 1
+	return nil
+}
+
+// parseClassPattern splits pattern into the bytes each position may be.
+func parseClassPattern(pattern string) ([][]byte, error) {
+	var sets [][]byte
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '\\':
+			if i++; i == len(pattern) {
+				return nil, fmt.Errorf("ahocorasick: class pattern %q: trailing backslash", pattern)
+			}
+			sets = append(sets, []byte{pattern[i]})
+		case '[':
+			open := i
+			var seen [256]bool
+			var set []byte
+			add := func(b byte) {
+				if !seen[b] {
+					seen[b] = true
+					set = append(set, b)
+				}
+			}
+			for i++; ; i++ {
+				if i == len(pattern) {
+					return nil, fmt.Errorf("ahocorasick: class pattern %q: unterminated class at byte %d", pattern, open)
+				}
+				b := pattern[i]
+				if b == ']' {
+					break
+				}
+				if b == '^' && i == open+1 {
+					return nil, fmt.Errorf("ahocorasick: class pattern %q: negated class at byte %d", pattern, open)
+				}
+				if b == '\\' {
+					if i++; i == len(pattern) {
+						return nil, fmt.Errorf("ahocorasick: class pattern %q: trailing backslash", pattern)
+					}
+					b = pattern[i]
+				}
+				if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+					hi := pattern[i+2]
+					if hi < b {
+						return nil, fmt.Errorf("ahocorasick: class pattern %q: reversed range at byte %d", pattern, i)
+					}
+					for r := int(b); r <= int(hi); r++ {
+						add(byte(r))
+					}
+					i += 2
+					continue
+				}
+				add(b)
+			}
+			if len(set) == 0 {
+				return nil, fmt.Errorf("ahocorasick: class pattern %q: empty class at byte %d", pattern, open)
+			}
+			sets = append(sets, set)
+		default:
+			sets = append(sets, []byte{c})
+		}
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("%w: class pattern %q", ErrEmptyPattern, pattern)
+	}
+	return sets, nil
+}
@@ -0,0 +1,49 @@
+package ahocorasick
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAddClassPattern(t *testing.T) {
+	tb := NewTrieBuilder()
+	for _, p := range []string{"gr[ae]y", `\[x[0-2]\]`} {
+		if err := tb.AddClassPattern(p); err != nil {
+			t.Fatalf("%q: %v", p, err)
+		}
+	}
+	tb.AddString("tail")
+	trie := tb.Build()
+	got := fmt.Sprint(trie.MatchString("gray grey griy [x1] [x3] tail"))
+	want := `[{0 0 "gray"} {5 0 "grey"} {15 1 "[x1]"} {25 2 "tail"}]`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	for _, tc := range []struct{ pattern, want string }{
+		{"gr[ae", "unterminated class at byte 2"},
+		{"a[]", "empty class at byte 1"},
+		{"a[^b]", "negated class"},
+		{"a[z-a]", "reversed range"},
+		{`a\`, "trailing backslash"},
+	} {
+		err := NewTrieBuilder().AddClassPattern(tc.pattern)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got %v, want an error containing %q", tc.pattern, err, tc.want)
+		}
+	}
+	if err := NewTrieBuilder().AddClassPattern(""); !errors.Is(err, ErrEmptyPattern) {
+		t.Errorf("empty: got %v, want ErrEmptyPattern", err)
+	}
+
+	tb = NewTrieBuilder()
+	err := tb.AddClassPattern(strings.Repeat("[0-9]", 4) + "[a-z]")
+	if !errors.Is(err, ErrClassTooLarge) {
+		t.Errorf("10^4*26 literals: got %v, want ErrClassTooLarge", err)
+	}
+	if tb.numPatterns != 0 || len(tb.states) != 2 {
+		t.Errorf("a failed pattern added %d patterns, %d states", tb.numPatterns, len(tb.states))
+	}
+}
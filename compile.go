@@ -0,0 +1,178 @@
+package ahocorasick
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Errors returned by Compile, wrapped with details; test for them with
+// errors.Is.
+var (
+	// ErrEmptyPattern reports an empty pattern, which can never match.
+	ErrEmptyPattern = errors.New("ahocorasick: empty pattern")
+	// ErrTooManyPatterns reports a pattern set too large to number with
+	// uint32 ids or to fit the automaton's 2^31 states.
+	ErrTooManyPatterns = errors.New("ahocorasick: too many patterns")
+	// ErrTooLarge reports a pattern set whose tables would exceed the
+	// WithMaxDenseBytes budget.
+	ErrTooLarge = errors.New("ahocorasick: trie exceeds memory budget")
+	// ErrNoPatterns reports an empty pattern set under
+	// WithRequireNonEmpty.
+	ErrNoPatterns = errors.New("ahocorasick: no patterns")
+	// ErrPatternTooLong reports a pattern over the SetMaxPatternLen or
+	// WithMaxPatternLen limit.
+	ErrPatternTooLong = errors.New("ahocorasick: pattern too long")
+)
+
+// Option configures the Trie built by Compile.
+type Option func(*TrieBuilder)
+
+// WithAlphabet restricts the automaton to the given bytes; see
+// TrieBuilder.SetAlphabet.
+func WithAlphabet(alphabet []byte) Option {
+	return func(tb *TrieBuilder) {
+		tb.SetAlphabet(alphabet)
+	}
+}
+
+// WithReverse builds the Trie for MatchReverse; see
+// TrieBuilder.SetReverse.
+func WithReverse() Option {
+	return func(tb *TrieBuilder) {
+		tb.SetReverse(true)
+	}
+}
+
+// WithByteTransform normalizes bytes before matching; see
+// TrieBuilder.SetByteTransform.
+func WithByteTransform(fn func(byte) byte) Option {
+	return func(tb *TrieBuilder) {
+		tb.SetByteTransform(fn)
+	}
+}
+
+// WithCaseInsensitive matches ASCII letters regardless of case: a byte
+// transform (see TrieBuilder.SetByteTransform) folding A-Z to a-z.
+// Other bytes, including non-ASCII letters, match exactly. The fold is
+// built into the transition table, so matching does no per-byte folding
+// and runs as fast as a case-sensitive Trie of the same size.
+func WithCaseInsensitive() Option {
+	return WithByteTransform(foldASCII)
+}
+
+// WithWholeWord reports only matches that are whole words; see
+// TrieBuilder.SetWholeWord.
+func WithWholeWord() Option {
+	return func(tb *TrieBuilder) {
+		tb.SetWholeWord(true)
+	}
+}
+
+// WithMaxDenseBytes caps the tables Compile builds at n bytes (see
+// TrieBuilder.EstimateBuildBytes). When the full transition table would
+// exceed n, Compile builds a compact Trie instead (see Trie.IsCompact),
+// which matches the same; it fails with ErrTooLarge, before building
+// anything, only when the compact tables exceed n as well, or the
+// patterns tell apart so many bytes that past 32768 states the class
+// rows would be no narrower than the full ones. Services compiling
+// untrusted pattern sets use it to refuse inputs that would exhaust
+// memory. Compile also checks the budget as patterns are added, so an
+// oversized set is rejected before the builder's own states grow far
+// past it.
+func WithMaxDenseBytes(n int) Option {
+	return func(tb *TrieBuilder) {
+		tb.maxBytes = n
+	}
+}
+
+// WithRequireNonEmpty makes Compile fail with ErrNoPatterns when given
+// no patterns, instead of building a Trie that never matches. Pattern
+// lists read from configuration come out empty when a path or key is
+// wrong, and the option surfaces that at startup.
+func WithRequireNonEmpty() Option {
+	return func(tb *TrieBuilder) {
+		tb.requireNonEmpty = true
+	}
+}
+
+// WithMaxPatternLen makes Compile fail with ErrPatternTooLong on a
+// pattern longer than n bytes; see TrieBuilder.SetMaxPatternLen.
+func WithMaxPatternLen(n int) Option {
+	return func(tb *TrieBuilder) {
+		tb.SetMaxPatternLen(n)
+	}
+}
+
+// Compile builds a Trie matching patterns, pattern i under id i, with the
+// given options applied. Unlike chaining TrieBuilder calls, it validates
+// the input and reports problems the builder would ignore or panic on:
+// an empty pattern (ErrEmptyPattern), a set too large for the automaton
+// (ErrTooManyPatterns), one over the WithMaxDenseBytes budget
+// (ErrTooLarge), one over the WithMaxPatternLen limit
+// (ErrPatternTooLong), or, with WithRequireNonEmpty, no patterns at all
+// (ErrNoPatterns).
+func Compile(patterns [][]byte, opts ...Option) (*Trie, error) {
+	if uint64(len(patterns)) > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: %d patterns", ErrTooManyPatterns, len(patterns))
+	}
+	tb := NewTrieBuilder()
+	for _, opt := range opts {
+		opt(tb)
+	}
+	if tb.requireNonEmpty && len(patterns) == 0 {
+		return nil, ErrNoPatterns
+	}
+	for i, pattern := range patterns {
+		if len(pattern) == 0 {
+			return nil, fmt.Errorf("%w: pattern %d", ErrEmptyPattern, i)
+		}
+		tb.AddPattern(pattern)
+		if tb.err != nil {
+			return nil, tb.err
+		}
+		if uint64(len(tb.states)) > uint64(stateMask)+1 {
+			return nil, fmt.Errorf("%w: pattern %d exceeds %d states", ErrTooManyPatterns, i, uint64(stateMask)+1)
+		}
+		// A cheap lower bound on the estimate: the per-state arrays and,
+		// up to 32768 states, the half-width table every Trie then has,
+		// compact or not.
+		if n := len(tb.states); tb.maxBytes > 0 {
+			low := n * (3*4 + 8)
+			if n <= failTrans16MaxStates {
+				low += n * 256 * 2
+			}
+			if low > tb.maxBytes {
+				return nil, fmt.Errorf("%w: pattern %d exceeds %d bytes", ErrTooLarge, i, tb.maxBytes)
+			}
+		}
+	}
+	if tb.maxBytes > 0 && tb.EstimateBuildBytes() > tb.maxBytes {
+		tb.compact = true
+		if n := tb.EstimateBuildBytes(); n > tb.maxBytes {
+			return nil, fmt.Errorf("%w: %d bytes exceeds %d", ErrTooLarge, n, tb.maxBytes)
+		}
+	}
+	return tb.Build(), nil
+}
+
+// MustCompile is like Compile but panics if the patterns cannot be
+// compiled. It simplifies initializing package-level Tries from
+// dictionaries written out in source:
+//
+//	var stopWords = ahocorasick.MustCompile("a", "an", "the")
+//
+// Pattern i gets id i. MustCompile is strict: it compiles under
+// WithRequireNonEmpty, so an empty pattern list panics along with an
+// empty pattern. Call Compile for options.
+func MustCompile(patterns ...string) *Trie {
+	bs := make([][]byte, len(patterns))
+	for i, p := range patterns {
+		bs[i] = []byte(p)
+	}
+	tr, err := Compile(bs, WithRequireNonEmpty())
+	if err != nil {
+		panic(err)
+	}
+	return tr
+}
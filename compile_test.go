@@ -0,0 +1,299 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tr, err := Compile([][]byte{[]byte("he"), []byte("she"), []byte("hers")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMatches(t, "valid", tr.MatchString("ushers"), []*Match{
+		newMatchString(1, 1, "she"),
+		newMatchString(2, 0, "he"),
+		newMatchString(2, 2, "hers"),
+	})
+
+	// Options are applied before patterns are added.
+	tr, err = Compile([][]byte{[]byte("ab")}, WithAlphabet([]byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms := tr.MatchString("ab"); len(ms) != 0 {
+		t.Errorf("alphabet option: expected no matches, got %v", ms)
+	}
+
+	if _, err := Compile([][]byte{[]byte("a"), nil}); !errors.Is(err, ErrEmptyPattern) {
+		t.Errorf("empty pattern: expected ErrEmptyPattern, got %v", err)
+	}
+	if _, err := Compile([][]byte{{}}); !errors.Is(err, ErrEmptyPattern) {
+		t.Errorf("zero-length pattern: expected ErrEmptyPattern, got %v", err)
+	}
+
+	tr, err = Compile(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms := tr.MatchString("anything"); len(ms) != 0 {
+		t.Errorf("no patterns: expected no matches, got %v", ms)
+	}
+}
+
+// mustCompile is Compile failing the test on error.
+func mustCompile(t testing.TB, patterns [][]byte, opts ...Option) *Trie {
+	t.Helper()
+	tr, err := Compile(patterns, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestCompileMaxDenseBytes(t *testing.T) {
+	patterns := [][]byte{[]byte("he"), []byte("she"), []byte("hers")}
+	size := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).EstimateBuildBytes()
+
+	tr, err := Compile(patterns, WithMaxDenseBytes(size))
+	if err != nil {
+		t.Fatalf("budget equal to the estimate: %v", err)
+	}
+	checkMatches(t, "within budget", tr.MatchString("ushers"), mustCompile(t, patterns).MatchString("ushers"))
+
+	// Just under the estimate fails only at the final check; far under
+	// fails while patterns are being added.
+	for _, n := range []int{size - 1, 2048} {
+		if _, err := Compile(patterns, WithMaxDenseBytes(n)); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("budget %d of %d: expected ErrTooLarge, got %v", n, size, err)
+		}
+	}
+}
+
+// TestCompileMaxDenseBytesCompact checks that a budget the full table
+// would exceed gets a compact Trie, which matches as the full one does,
+// on either side of failTrans16's reach, and ErrTooLarge only under the
+// compact estimate.
+func TestCompileMaxDenseBytesCompact(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	words := func(n int) [][]byte {
+		ws := make([][]byte, n)
+		for i := range ws {
+			for len(ws[i]) < 6 {
+				if rng.Intn(5) == 0 {
+					ws[i] = append(ws[i], "\u00e9"...)
+				} else {
+					ws[i] = append(ws[i], 'a'+byte(rng.Intn(16)))
+				}
+			}
+		}
+		return ws
+	}
+	for _, tc := range []struct {
+		name     string
+		patterns [][]byte
+		half     bool
+	}{
+		{"half-width", words(200), true},
+		{"class", words(12000), false},
+	} {
+		full := mustCompile(t, tc.patterns)
+		if full.IsCompact() {
+			t.Fatalf("%s: expected the full table without a budget", tc.name)
+		}
+		tb := NewTrieBuilder()
+		for _, p := range tc.patterns {
+			tb.AddPattern(p)
+		}
+		fullSize := tb.EstimateBuildBytes()
+		tb.compact = true
+		size := tb.EstimateBuildBytes()
+		if size >= fullSize {
+			t.Fatalf("%s: compact estimate %d, full %d", tc.name, size, fullSize)
+		}
+
+		tr, err := Compile(tc.patterns, WithMaxDenseBytes(fullSize-1))
+		if err != nil {
+			t.Fatalf("%s: budget under the full table: %v", tc.name, err)
+		}
+		if !tr.IsCompact() || (tr.failTrans16 != nil) != tc.half {
+			t.Fatalf("%s: IsCompact = %v, half-width = %v", tc.name, tr.IsCompact(), tr.failTrans16 != nil)
+		}
+		if tr.tableBytes() >= full.tableBytes() {
+			t.Errorf("%s: compact trie retains %d bytes, the full one %d", tc.name, tr.tableBytes(), full.tableBytes())
+		}
+		if !tr.Equal(full) {
+			t.Errorf("%s: compact trie differs from the full one", tc.name)
+		}
+
+		var input []byte
+		for len(input) < 100000 {
+			w := tc.patterns[rng.Intn(len(tc.patterns))]
+			input = append(input, w[:1+rng.Intn(len(w))]...)
+			input = append(input, " \xc3"[rng.Intn(2)])
+		}
+		want := full.Match(input)
+		if len(want) == 0 {
+			t.Fatalf("%s: input has no matches", tc.name)
+		}
+		checkMatches(t, tc.name, tr.Match(input), want)
+		var walked, fullWalked [][3]uint32
+		tr.Walk(input, func(end, n, pattern uint32) bool {
+			walked = append(walked, [3]uint32{end, n, pattern})
+			return true
+		})
+		full.Walk(input, func(end, n, pattern uint32) bool {
+			fullWalked = append(fullWalked, [3]uint32{end, n, pattern})
+			return true
+		})
+		if i := diffTriples(walked, fullWalked); i >= 0 {
+			t.Errorf("%s: Walk differs from the full table at %d", tc.name, i)
+		}
+
+		// Decode keeps the full table for tries that are not ASCII.
+		data, err := EncodeBytes(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.IsCompact() || !decoded.Equal(tr) {
+			t.Errorf("%s: decoded IsCompact = %v, Equal = %v", tc.name, decoded.IsCompact(), decoded.Equal(tr))
+		}
+
+		if _, err := Compile(tc.patterns, WithMaxDenseBytes(size-1)); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: budget under the compact estimate: expected ErrTooLarge, got %v", tc.name, err)
+		}
+	}
+
+	// Past failTrans16's reach, a set using more than 127 distinct bytes
+	// has no class rows narrower than half the full ones.
+	var wide [][]byte
+	for len(wide) < 12000 {
+		w := make([]byte, 5)
+		for i := range w {
+			w[i] = byte(rng.Intn(256))
+		}
+		wide = append(wide, w)
+	}
+	tb := NewTrieBuilder()
+	for _, p := range wide {
+		tb.AddPattern(p)
+	}
+	if _, err := Compile(wide, WithMaxDenseBytes(tb.EstimateBuildBytes()-1)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("every byte: expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestCompileRequireNonEmpty(t *testing.T) {
+	for _, patterns := range [][][]byte{nil, {}} {
+		if _, err := Compile(patterns, WithRequireNonEmpty()); !errors.Is(err, ErrNoPatterns) {
+			t.Errorf("%d patterns: expected ErrNoPatterns, got %v", len(patterns), err)
+		}
+	}
+	if _, err := Compile(nil); err != nil {
+		t.Errorf("without the option, no patterns: %v", err)
+	}
+	if _, err := Compile([][]byte{[]byte("x")}, WithRequireNonEmpty()); err != nil {
+		t.Errorf("one pattern: %v", err)
+	}
+}
+
+func TestCompileCaseInsensitiveWholeWord(t *testing.T) {
+	tr, err := Compile([][]byte{[]byte("Error")}, WithCaseInsensitive(), WithWholeWord())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMatches(t, "word", tr.MatchString("An ERROR, occurred"), []*Match{
+		newMatchString(3, 0, "ERROR"),
+	})
+	if ms := tr.MatchString("Errors"); len(ms) != 0 {
+		t.Errorf("suffixed: expected no matches, got %v", ms)
+	}
+	if ms := tr.MatchString("error_code 9error"); len(ms) != 0 {
+		t.Errorf("word bytes: expected no matches, got %v", ms)
+	}
+
+	// Each option alone keeps its own behavior.
+	tr = mustCompile(t, [][]byte{[]byte("Error")}, WithCaseInsensitive())
+	if ms := tr.MatchString("Errors"); len(ms) != 1 {
+		t.Errorf("case-insensitive only: expected 1 match, got %v", ms)
+	}
+	tr = mustCompile(t, [][]byte{[]byte("Error")}, WithWholeWord())
+	if ms := tr.MatchString("An ERROR, occurred"); len(ms) != 0 {
+		t.Errorf("whole-word only: expected no matches, got %v", ms)
+	}
+}
+
+// TestWholeWordEntryPoints verifies every matching method agrees with
+// filtering the unrestricted trie's matches to whole words.
+func TestWholeWordEntryPoints(t *testing.T) {
+	ibsen, err := os.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns := [][]byte{[]byte("og"), []byte("Hjalmar"), []byte("han"), []byte("i"), []byte("Hjalmar Ekdal")}
+	all := mustCompile(t, patterns)
+	tr := mustCompile(t, patterns, WithWholeWord())
+
+	var want [][3]uint32
+	for _, m := range all.Match(ibsen) {
+		if isWord(ibsen, m.Start(), m.End()) {
+			want = append(want, [3]uint32{m.Pos(), m.Pattern(), m.Len()})
+		}
+	}
+	if len(want) == 0 {
+		t.Fatal("no whole-word matches")
+	}
+	check := func(name string, got [][3]uint32) {
+		t.Helper()
+		if i := diffTriples(got, want); i >= 0 {
+			t.Errorf("%s: differs at %d", name, i)
+		}
+	}
+	check("Match", triplesFromMatches(tr.Match(ibsen)))
+	check("Walk", tr.triplesFromWalk(ibsen))
+	for _, n := range []int{1, 7, 4096} {
+		ms, err := tr.MatchReaderAll(&chunkReader{bytes.NewReader(ibsen), n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(fmt.Sprintf("MatchReaderAll/%d", n), triplesFromMatches(ms))
+	}
+	got := triplesFromMatches(tr.MatchSkip(ibsen))
+	sortTriples(got)
+	sorted := slices.Clone(want)
+	sortTriples(sorted)
+	if i := diffTriples(got, sorted); i >= 0 {
+		t.Errorf("MatchSkip: differs at %d", i)
+	}
+	if got, n := tr.Count(ibsen), len(want); got != n {
+		t.Errorf("Count: expected %d, got %d", n, got)
+	}
+}
+
+func TestMustCompile(t *testing.T) {
+	tr := MustCompile("he", "she")
+	checkMatches(t, "strings", tr.MatchString("she"), []*Match{
+		newMatchString(0, 1, "she"),
+		newMatchString(1, 0, "he"),
+	})
+
+	for _, patterns := range [][]string{{"ok", ""}, nil} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: expected a panic", patterns)
+				}
+			}()
+			MustCompile(patterns...)
+		}()
+	}
+}
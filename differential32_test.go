@@ -128,7 +128,7 @@ func TestDifferential32BitPaths(t *testing.T) {
 
 	for _, c := range cases {
 		for _, classed := range []bool{false, true} {
-			trie := NewTrieBuilder().AddStrings(c.patterns).Build()
+			trie := fullTable(NewTrieBuilder().AddStrings(c.patterns).Build())
 			trie.failTrans16 = nil // force 32-bit scan paths
 			trie.setStopEntry()
 			if classed {
@@ -168,3 +168,22 @@ func TestDifferential32BitPaths(t *testing.T) {
 		}
 	}
 }
+
+// fullTable gives a compact tr back the full transition table, and the
+// tables derived from it, that a Trie of its size would keep if some
+// pattern held a byte of 0x80 or above. Whitebox tests use it to drive
+// the full-table scan loops with ASCII patterns.
+func fullTable(tr *Trie) *Trie {
+	if tr.failTrans != nil {
+		return tr
+	}
+	failTrans := make([][256]uint32, tr.NumStates())
+	for s := range failTrans {
+		tr.row(uint32(s), &failTrans[s])
+	}
+	tr.failTrans, tr.failTrans16, tr.failTransC = failTrans, nil, nil
+	tr.buildFailTrans16()
+	tr.buildClassTable(tr.derivedLiveBytes())
+	tr.setStopEntry()
+	return tr
+}
@@ -11,6 +11,8 @@ import (
 // (state, byte), failTrans states must equal the fail-chain walk
 // (computeFailTransition), output flags must equal the target's
 // dict/dictLink emit condition, and failTrans16 must mirror failTrans.
+// Odd trials add a pattern with a high byte, so both the compact tries
+// of ASCII patterns and the full tables of others are checked.
 func TestDPEquivalence(t *testing.T) {
 	rng := rand.New(rand.NewSource(7))
 	for trial := 0; trial < 50; trial++ {
@@ -25,8 +27,14 @@ func TestDPEquivalence(t *testing.T) {
 			}
 			pats = append(pats, string(b))
 		}
+		if trial%2 == 1 {
+			pats = append(pats, "a\x80")
+		}
 		tb := NewTrieBuilder().AddStrings(pats)
 		trie := tb.Build()
+		if trie.IsCompact() == (trial%2 == 1) {
+			t.Fatalf("trial %d: IsCompact = %v", trial, trie.IsCompact())
+		}
 
 		// Recompute the BFS numbering the same way Build does.
 		numStates := len(tb.states)
@@ -63,7 +71,7 @@ func TestDPEquivalence(t *testing.T) {
 					trial, i, trie.dictLink[i], wantDictLink)
 			}
 			for b := 0; b < 256; b++ {
-				v := trie.failTrans[i][b]
+				v := trie.next(uint32(i), byte(b))
 				want := newID[tb.computeFailTransition(sid, byte(b))]
 				if got := v & stateMask; got != want {
 					t.Fatalf("trial %d state %d byte %d: got %d want %d", trial, i, b, got, want)
@@ -71,7 +79,7 @@ func TestDPEquivalence(t *testing.T) {
 				if got, want := v&outputFlag != 0, emits[v&stateMask]; got != want {
 					t.Fatalf("trial %d state %d byte %d: flag %v want %v", trial, i, b, got, want)
 				}
-				if trie.failTrans16 != nil {
+				if trie.failTrans != nil {
 					w := trie.failTrans16[i<<8+b]
 					if uint32(w&(1<<15-1)) != v&stateMask || (w&(1<<15) != 0) != (v&outputFlag != 0) {
 						t.Fatalf("trial %d state %d byte %d: failTrans16 %#x disagrees with failTrans %#x", trial, i, b, w, v)
@@ -103,7 +111,7 @@ func buildBoundaryTrie(t *testing.T, numStates int) *Trie {
 		pats = append(pats, []byte{byte(i >> 8), byte(i)})
 	}
 	tr := NewTrieBuilder().AddPatterns(pats).Build()
-	if got := len(tr.failTrans); got != numStates {
+	if got := tr.NumStates(); got != numStates {
 		t.Fatalf("fixture built %d states, want %d", got, numStates)
 	}
 	return tr
@@ -129,7 +137,7 @@ func TestFailTrans16Cutoff(t *testing.T) {
 		// capacity, this catches the truncation at the new boundary.
 		maxState := uint32(failTrans16MaxStates - 1)
 		var found bool
-		for s := 0; s < len(tr.failTrans) && !found; s++ {
+		for s := 0; s < tr.NumStates() && !found; s++ {
 			for b := 0; b < 256; b++ {
 				v := tr.failTrans[s][b]
 				if v&stateMask != maxState {
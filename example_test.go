@@ -0,0 +1,10 @@
+package ahocorasick
+
+import "fmt"
+
+func ExampleMustCompile() {
+	trie := MustCompile("a", "an", "the")
+	fmt.Println(trie.Count([]byte("the cat ate an apple")))
+	// Output:
+	// 6
+}
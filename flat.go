@@ -0,0 +1,66 @@
+package ahocorasick
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// flatMagic opens an ExportFlat file; its last byte is the layout
+// version.
+var flatMagic = [8]byte{'A', 'C', 'F', 'L', 'A', 'T', 0, 1}
+
+// ExportFlat writes the automaton in a flat, uncompressed layout meant
+// for other languages, which can read it directly or mmap it. Unlike
+// Encode's gzip stream it is neither compressed nor versioned with the
+// Go format; only the tables below are written, so byte transforms and
+// alphabets come along (they are baked into the transitions) but values,
+// priorities, and the whole-word and white space settings do not.
+//
+// Every integer is a little-endian uint32 except the magic, and every
+// array starts at a multiple of 4 bytes. With N the number of states:
+//
+//	offset          size      contents
+//	0               8         magic "ACFLAT\x00\x01" (last byte: layout version 1)
+//	8               4         N, the number of states
+//	12              4         reserved, zero
+//	16              N*1024    transitions: N rows of 256 entries
+//	16 + N*1024     N*4       length of the pattern ending at each state
+//	16 + N*1028     N*4       id of the pattern ending at each state
+//	16 + N*1032     N*4       output link of each state
+//
+// State 0 is unused and state 1 is the root. Entry b of row s is the
+// state reached from s on byte b; failures are already folded in, so a
+// scan is one lookup per byte. A state s has a pattern ending at it if
+// its length is non-zero; the output link names the next shorter such
+// state whose pattern is a suffix of s's string, 0 ending the chain. To
+// match, start at state 1 and, after each byte at offset i, move to the
+// next state s, then report s (if its length is non-zero) and every
+// state along its output links: a state t reports its pattern id with
+// the match spanning input[i+1-length(t) : i+1].
+func ExportFlat(w io.Writer, trie *Trie) error {
+	bw := bufio.NewWriter(w)
+	n := uint32(trie.NumStates())
+	var header [16]byte
+	copy(header[:], flatMagic[:])
+	binary.LittleEndian.PutUint32(header[8:], n)
+	bw.Write(header[:])
+
+	buf := make([]byte, 0, 256*4)
+	var row [256]uint32
+	for s := range n {
+		buf = buf[:0]
+		for _, v := range trie.row(s, &row) {
+			buf = binary.LittleEndian.AppendUint32(buf, v&stateMask)
+		}
+		bw.Write(buf)
+	}
+	for _, table := range [][]uint32{trie.dict, trie.pattern, trie.dictLink} {
+		for _, v := range table {
+			buf = binary.LittleEndian.AppendUint32(buf[:0], v)
+			bw.Write(buf)
+		}
+	}
+	// bufio.Writer keeps its first error and returns it from Flush.
+	return bw.Flush()
+}
@@ -0,0 +1,78 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"os"
+	"slices"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files")
+
+func TestExportFlatGolden(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).Build()
+	var buf bytes.Buffer
+	if err := ExportFlat(&buf, trie); err != nil {
+		t.Fatal(err)
+	}
+	const golden = "test_data/flat.golden"
+	if *updateGolden {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("ExportFlat output differs from %s (run with -update if the change is intended)", golden)
+	}
+}
+
+// TestExportFlatSpec matches with a reader written from ExportFlat's
+// layout description alone.
+func TestExportFlatSpec(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen, err := os.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trie := NewTrieBuilder().SetByteTransform(foldASCII).AddStrings(patterns[:5000]).Build()
+	var buf bytes.Buffer
+	if err := ExportFlat(&buf, trie); err != nil {
+		t.Fatal(err)
+	}
+	flat := buf.Bytes()
+
+	if string(flat[:8]) != "ACFLAT\x00\x01" {
+		t.Fatalf("bad magic %q", flat[:8])
+	}
+	n := int(binary.LittleEndian.Uint32(flat[8:]))
+	if len(flat) != 16+n*1036 {
+		t.Fatalf("%d bytes for %d states", len(flat), n)
+	}
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(flat[off:]) }
+	length := func(s uint32) uint32 { return u32(16 + n*1024 + int(s)*4) }
+	id := func(s uint32) uint32 { return u32(16 + n*1028 + int(s)*4) }
+	link := func(s uint32) uint32 { return u32(16 + n*1032 + int(s)*4) }
+
+	var got [][3]uint32
+	s := uint32(1)
+	for i, c := range ibsen {
+		s = u32(16 + int(s)*1024 + int(c)*4)
+		for u := s; u != 0; u = link(u) {
+			if l := length(u); l != 0 {
+				got = append(got, [3]uint32{uint32(i) + 1 - l, uint32(i) + 1, id(u)})
+			}
+		}
+	}
+	if want := trie.MatchIndices(ibsen); !slices.Equal(got, want) {
+		t.Errorf("flat matching found %d matches, Match found %d", len(got), len(want))
+	}
+}
@@ -0,0 +1,111 @@
+package ahocorasick
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// PatternsHash returns a 64-bit FNV-1a hash of what Build would produce
+// from the builder as it stands: every stored pattern with its id, taken
+// in bytewise order rather than the insertion-dependent state order,
+// plus the alphabet and byte transform. It is stable across runs, so it
+// can key a cache of built or serialized tries and let callers skip
+// rebuilding an unchanged pattern set.
+//
+// The hash depends on insertion order only through ids. AddPattern
+// numbers patterns as they are added, so the same patterns added in
+// another order report other ids and hash differently, as a cached Trie
+// built from them would answer differently; patterns added with
+// AddPatternWithID hash the same in any order. Patterns are hashed as
+// stored, after any transform, reversal, or white space collapsing;
+// priorities, values, and the whole-word setting are not included. It
+// walks the builder's states once and allocates only its working stack.
+func (tb *TrieBuilder) PatternsHash() uint64 {
+	h := fnv.New64a()
+	var buf []byte
+
+	// A depth-first walk over the sorted sibling lists visits patterns
+	// in bytewise order.
+	type frame struct {
+		s     uint32
+		depth int
+	}
+	var path []byte
+	stack := []frame{{rootState, 0}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		st := &tb.states[f.s]
+		path = path[:f.depth]
+		if f.s != rootState {
+			path = append(path, st.value)
+		}
+		if st.dict != 0 {
+			buf = binary.AppendUvarint(buf[:0], uint64(len(path)))
+			buf = append(buf, path...)
+			buf = binary.AppendUvarint(buf, uint64(st.pattern))
+			h.Write(buf)
+		}
+		// Push children last to first so the smallest byte pops first.
+		mark := len(stack)
+		for t := st.firstChild; t != 0; t = tb.states[t].nextSib {
+			stack = append(stack, frame{t, len(path)})
+		}
+		for i, j := mark, len(stack)-1; i < j; i, j = i+1, j-1 {
+			stack[i], stack[j] = stack[j], stack[i]
+		}
+	}
+
+	// A zero length separates the patterns from the settings, which no
+	// pattern (all non-empty) can imitate.
+	buf = append(buf[:0], 0)
+	if tb.alphabet != nil {
+		buf = append(buf, 'a')
+		for _, ok := range tb.alphabet {
+			if ok {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		}
+	}
+	if tb.xlat != nil {
+		buf = append(buf, 'x')
+		buf = append(buf, tb.xlat[:]...)
+	}
+	h.Write(buf)
+	return h.Sum64()
+}
+
+// Fingerprint returns a 64-bit FNV-1a hash of the automaton's tables,
+// the ones Equal compares: tries that are Equal have the same
+// fingerprint, including a Trie and its Encode/Decode round trip, and
+// different tries almost surely do not. Like Equal, it ignores values,
+// priorities, and the whole-word and white space settings. It reads the
+// whole transition table, so cache it rather than calling it per use.
+func (tr *Trie) Fingerprint() uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 0, 256*4)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(tr.NumStates()))
+	h.Write(buf)
+	var row [256]uint32
+	for s := range uint32(tr.NumStates()) {
+		buf = buf[:0]
+		for _, v := range tr.row(s, &row) {
+			buf = binary.LittleEndian.AppendUint32(buf, v)
+		}
+		h.Write(buf)
+	}
+	for _, table := range [][]uint32{tr.dict, tr.pattern, tr.dictLink} {
+		buf = buf[:0]
+		for _, v := range table {
+			buf = binary.LittleEndian.AppendUint32(buf, v)
+			if len(buf) == cap(buf) {
+				h.Write(buf)
+				buf = buf[:0]
+			}
+		}
+		h.Write(buf)
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,65 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPatternsHash(t *testing.T) {
+	build := func(patterns ...string) *TrieBuilder {
+		tb := NewTrieBuilder()
+		for _, p := range patterns {
+			// Explicit ids make the set, not the insertion order, decide.
+			tb.AddPatternWithID([]byte(p), uint32(len(p)*1000+int(p[0])))
+		}
+		return tb
+	}
+	a := build("he", "she", "his", "hers")
+	b := build("hers", "his", "she", "he")
+	if a.PatternsHash() != b.PatternsHash() {
+		t.Error("same pattern set in another order hashes differently")
+	}
+	if a.PatternsHash() != a.PatternsHash() {
+		t.Error("hash is not deterministic")
+	}
+
+	// Automatic ids follow insertion order, and so does the hash.
+	c := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"})
+	d := NewTrieBuilder().AddStrings([]string{"hers", "his", "she", "he"})
+	if c.PatternsHash() == d.PatternsHash() {
+		t.Error("automatic ids in another order hash the same")
+	}
+
+	base := a.PatternsHash()
+	for name, tb := range map[string]*TrieBuilder{
+		"extra pattern": build("he", "she", "his", "hers", "x"),
+		"fewer":         build("he", "she", "his"),
+		"split":         build("h", "ehe", "she", "his", "hers"),
+		"other id":      NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}),
+		"alphabet":      build("he", "she", "his", "hers").SetAlphabet([]byte("ehirs")),
+		"transform":     build("he", "she", "his", "hers").SetByteTransform(foldASCII),
+	} {
+		if tb.PatternsHash() == base {
+			t.Errorf("%s: hash did not change", name)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).Build()
+	var buf bytes.Buffer
+	if err := Encode(&buf, trie); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trie.Fingerprint() != decoded.Fingerprint() {
+		t.Error("round trip changed the fingerprint")
+	}
+	other := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "her"}).Build()
+	if trie.Fingerprint() == other.Fingerprint() {
+		t.Error("different tries share a fingerprint")
+	}
+}
@@ -11,8 +11,10 @@ type Match struct {
 	pattern uint32
 	match   []byte
 
-	// buf, set only on the first match of a batch, lets ReleaseMatches
-	// recycle the whole batch with a single pool operation.
+	// buf, set on the first match of a batch, lets ReleaseMatches
+	// recycle the whole batch with a single pool operation. Every match
+	// carries it when the Trie keeps pattern text (see PatternBytes) or
+	// the batch was released under SetPoolDebug.
 	buf *matchBuf
 }
 
@@ -20,30 +22,76 @@ func newMatchString(pos, pattern uint32, match string) *Match {
 	return &Match{pos: pos, pattern: pattern, match: []byte(match)}
 }
 
+// live panics if m was released under TrieBuilder.SetPoolDebug.
+func (m *Match) live() {
+	if m.buf != nil && m.buf.released {
+		panic("ahocorasick: Match used after ReleaseMatches")
+	}
+}
+
 func (m *Match) String() string {
+	m.live()
 	return fmt.Sprintf("{%d %d %q}", m.pos, m.pattern, m.match)
 }
 
 // Pos returns the byte position of the match.
 func (m *Match) Pos() uint32 {
+	m.live()
 	return m.pos
 }
 
 // Pattern returns the pattern id of the match.
 func (m *Match) Pattern() uint32 {
+	m.live()
 	return m.pattern
 }
 
+// Start returns the byte position where the match begins; it is the same
+// as Pos.
+func (m *Match) Start() uint32 {
+	m.live()
+	return m.pos
+}
+
+// End returns the byte position just past the match, so the matched
+// bytes are input[Start():End()].
+func (m *Match) End() uint32 {
+	return m.pos + m.Len()
+}
+
+// Len returns the length of the match in bytes.
+func (m *Match) Len() uint32 {
+	m.live()
+	return uint32(len(m.match))
+}
+
 // Match returns the pattern matched.
 func (m *Match) Match() []byte {
+	m.live()
 	return m.match
 }
 
 // MatchString returns the pattern matched as a string.
 func (m *Match) MatchString() string {
+	m.live()
 	return string(m.match)
 }
 
+// PatternBytes returns the pattern as it was added, such as "Error"
+// where a case-insensitive Trie matched "ERROR", or nil when the Trie
+// does not hold the text: one built without
+// TrieBuilder.SetKeepPatternText or decoded, or a Match not made by a
+// Trie. Where several patterns share the id, it returns the one equal
+// to the matched bytes, or else the first added of the same length, or
+// else the first added. The result must not be modified.
+func (m *Match) PatternBytes() []byte {
+	m.live()
+	if m.buf == nil || m.buf.tr == nil {
+		return nil
+	}
+	return m.buf.tr.patternText(m.pattern, m.match)
+}
+
 // MatchEqual reports whether a and b have the same position, pattern id,
 // and matched bytes.
 func MatchEqual(a, b *Match) bool {
@@ -0,0 +1,135 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestMatchAccessors(t *testing.T) {
+	input := []byte("ushers and hers")
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build()
+	ms := tr.Match(input)
+	if len(ms) == 0 {
+		t.Fatal("expected matches")
+	}
+	for _, m := range ms {
+		if m.Len() != m.End()-m.Start() {
+			t.Errorf("%v: Len %d, End-Start %d", m, m.Len(), m.End()-m.Start())
+		}
+		if m.Start() != m.Pos() || m.Len() != uint32(len(m.Match())) {
+			t.Errorf("%v: Start %d, Len %d", m, m.Start(), m.Len())
+		}
+		if !bytes.Equal(input[m.Start():m.End()], m.Match()) {
+			t.Errorf("%v: input[Start:End] is %q", m, input[m.Start():m.End()])
+		}
+	}
+	tr.ReleaseMatches(ms)
+}
+
+func TestMatchPatternBytes(t *testing.T) {
+	tb := NewTrieBuilder().SetByteTransform(foldASCII).AddStrings([]string{"Error", "WARN"})
+	if m := tb.Build().MatchFirst([]byte("error")); m.PatternBytes() != nil {
+		t.Errorf("without SetKeepPatternText: PatternBytes = %q", m.PatternBytes())
+	}
+	tr := tb.SetKeepPatternText(true).Build()
+	ms := tr.MatchString("ERROR then warn")
+	if len(ms) != 2 {
+		t.Fatalf("expected 2 matches, got %v", ms)
+	}
+	for i, want := range []struct{ text, pattern string }{{"ERROR", "Error"}, {"warn", "WARN"}} {
+		if got := string(ms[i].Match()); got != want.text {
+			t.Errorf("match %d: Match = %q, want %q", i, got, want.text)
+		}
+		if got := string(ms[i].PatternBytes()); got != want.pattern {
+			t.Errorf("match %d: PatternBytes = %q, want %q", i, got, want.pattern)
+		}
+	}
+	if first := tr.MatchFirst([]byte("error")); string(first.PatternBytes()) != "Error" {
+		t.Errorf("MatchFirst: PatternBytes = %q", first.PatternBytes())
+	}
+	// Every Match links to the buffer, but only the first releases it.
+	tr.ReleaseMatches(ms[1:])
+	if ms[0].buf == nil {
+		t.Error("releasing a tail released the batch")
+	}
+	tr.ReleaseMatches(ms)
+
+	// Patterns sharing an id resolve by the matched bytes.
+	tr = NewTrieBuilder().
+		AddPatternWithID([]byte("cat"), 7).
+		AddPatternWithID([]byte("dog"), 7).
+		SetKeepPatternText(true).
+		Build()
+	for _, m := range tr.MatchString("dog cat") {
+		if !bytes.Equal(m.PatternBytes(), m.Match()) {
+			t.Errorf("%v: PatternBytes = %q", m, m.PatternBytes())
+		}
+	}
+
+	if p := newMatchString(0, 0, "x").PatternBytes(); p != nil {
+		t.Errorf("Match without a Trie: PatternBytes = %q", p)
+	}
+}
+
+func TestWithMatches(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).Build()
+	var seen []*Match
+	var got []string
+	tr.WithMatches([]byte("ushers"), func(ms []*Match) {
+		seen = ms
+		for _, m := range ms {
+			got = append(got, m.MatchString())
+		}
+	})
+	if want := []string{"she", "he", "hers"}; !slices.Equal(got, want) {
+		t.Errorf("expected %q inside the callback, got %q", want, got)
+	}
+	if len(seen) == 0 || seen[0].buf != nil {
+		t.Error("expected the matches to be released after the callback")
+	}
+
+	func() {
+		defer func() { recover() }()
+		tr.WithMatches([]byte("his"), func(ms []*Match) {
+			seen = ms
+			panic("callback")
+		})
+	}()
+	if len(seen) == 0 || seen[0].buf != nil {
+		t.Error("expected the matches to be released after a panicking callback")
+	}
+}
+
+func TestSetPoolDebug(t *testing.T) {
+	mustPanic := func(name string, fn func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s: expected a panic", name)
+			}
+		}()
+		fn()
+	}
+
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).SetPoolDebug(true).Build()
+	ms := tr.Match([]byte("ushers"))
+	alias := ms[:1]
+	tr.ReleaseMatches(ms)
+	mustPanic("double release", func() { tr.ReleaseMatches(ms) })
+	mustPanic("release through a sub-slice", func() { tr.ReleaseMatches(alias) })
+	mustPanic("use after release", func() { _ = ms[1].Pos() })
+
+	// A live result is unaffected by another's release.
+	other := tr.Match([]byte("his"))
+	if len(other) != 1 || other[0].MatchString() != "his" {
+		t.Errorf("expected [his], got %v", other)
+	}
+	tr.ReleaseMatches(other)
+
+	// Without debug mode a second release is a no-op.
+	tr = NewTrieBuilder().AddStrings([]string{"he", "she"}).Build()
+	ms = tr.Match([]byte("she"))
+	tr.ReleaseMatches(ms)
+	tr.ReleaseMatches(ms)
+}
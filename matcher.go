@@ -0,0 +1,216 @@
+package ahocorasick
+
+// IsAtRoot reports whether state, as returned by WalkAt or
+// Matcher.State, is the root: no byte consumed so far begins a match
+// that more input could complete, so a streaming consumer can drop
+// everything it has buffered and checkpoint there. The zero state, which
+// WalkAt reads as the root, counts as the root too.
+func (tr *Trie) IsAtRoot(state uint32) bool {
+	return state == rootState || state == nilState
+}
+
+// Matcher matches a stream fed to it in pieces, keeping the automaton
+// state and the running byte offset between calls, so matches spanning
+// pieces are found and positions count from the start of the stream.
+// Fed a stream in any pieces and then flushed, it reports exactly what
+// one Walk over the whole stream would. A Matcher is not safe for
+// concurrent use; any number may share one Trie.
+//
+// Whole-word matching, white space collapsing, and end anchors depend on
+// the bytes around a match, so for a Trie with those settings the
+// Matcher keeps the last few bytes it consumed and holds back the
+// matches ending at the end of a piece until the next piece, or Flush,
+// shows what follows them.
+type Matcher struct {
+	tr     *Trie
+	state  uint32
+	offset uint32
+
+	// hist holds the last maxLen bytes the automaton consumed, collapsed
+	// under SetCollapseWhitespace, and histPos their stream offsets, so
+	// a match begun in an earlier piece finds its start and the byte
+	// before it. Both are kept only for the settings that need them.
+	hist    []byte
+	histPos []uint32
+
+	// held are the matches ending at the last byte consumed.
+	held []heldStart
+
+	// inSpace is set under SetCollapseWhitespace when the last byte fed
+	// was white space, whose run white space starting the next piece
+	// continues.
+	inSpace bool
+}
+
+// heldStart is a match a Matcher holds back: its start and pattern, and
+// whether it is end-anchored. Where it ends depends on what follows.
+type heldStart struct {
+	start, pattern uint32
+	anchored       bool
+}
+
+// NewMatcher returns a Matcher at the start of a stream.
+func (tr *Trie) NewMatcher() *Matcher {
+	return &Matcher{tr: tr, state: rootState}
+}
+
+// Feed matches input as the next piece of the stream, calling fn as
+// Walk does, with end positions counted from the start of the stream.
+// It returns false if fn stopped the walk, in which case the Matcher is
+// left as it was before the call. For a Trie with whole-word matching,
+// white space collapsing, or end anchors, matches ending at the end of
+// input are reported by the next Feed or by Flush.
+func (m *Matcher) Feed(input []byte, fn WalkFn) bool {
+	tr := m.tr
+	if !tr.wholeWord && !tr.collapseSpace && tr.endAnchored == nil {
+		s, cont := tr.walkState(input, m.state, m.offset, fn)
+		if !cont {
+			return false
+		}
+		m.state = s
+		m.offset += uint32(len(input))
+		return true
+	}
+
+	// White space starting input continues the run ending the piece
+	// before, so it is skipped, and the rest is collapsed on its own.
+	skip := 0
+	if tr.collapseSpace && m.inSpace {
+		for skip < len(input) && isSpaceByte(input[skip]) {
+			skip++
+		}
+	}
+	scan, orig := input[skip:], []uint32(nil)
+	if tr.collapseSpace {
+		scan, orig = collapseInput(scan)
+	}
+	base := m.offset + uint32(skip)
+	// pos returns the stream offset of byte i of scan; negative i count
+	// back into hist.
+	pos := func(i int) uint32 {
+		switch {
+		case i < 0 && tr.collapseSpace:
+			return m.histPos[len(m.histPos)+i]
+		case orig != nil:
+			return base + orig[i]
+		}
+		return base + uint32(i)
+	}
+	// wordBefore reports whether a word byte precedes byte i of scan.
+	// The collapsed bytes stand in for the input's own: white space
+	// collapses to ' ', which is not a word byte either.
+	wordBefore := func(i int) bool {
+		if i > 0 {
+			return isWordByte(scan[i-1])
+		}
+		k := len(m.hist) + i - 1
+		return k >= 0 && isWordByte(m.hist[k])
+	}
+
+	held := m.held
+	if len(scan) != 0 {
+		// The first byte of scan decides the held matches.
+		for _, h := range m.held {
+			if h.anchored || tr.wholeWord && isWordByte(scan[0]) {
+				continue
+			}
+			if stop := pos(0); !fn(stop-1, stop-h.start, h.pattern) {
+				return false
+			}
+		}
+		held = nil
+	}
+	s, cont := tr.walkEmit(scan, m.state, 0, func(end, u uint32) bool {
+		first := int(end) + 1 - int(tr.dict[u])
+		if tr.wholeWord && wordBefore(first) {
+			return true
+		}
+		start := pos(first)
+		if int(end) == len(scan)-1 {
+			held = append(held, heldStart{start, tr.pattern[u], tr.anchored(u)})
+			return true
+		}
+		if tr.anchored(u) || tr.wholeWord && isWordByte(scan[end+1]) {
+			return true
+		}
+		stop := pos(int(end) + 1)
+		return fn(stop-1, stop-start, tr.pattern[u])
+	})
+	if !cont {
+		return false
+	}
+
+	if tr.wholeWord || tr.collapseSpace {
+		m.hist = append(m.hist, scan...)
+		if tr.collapseSpace {
+			for i := range scan {
+				m.histPos = append(m.histPos, pos(i))
+			}
+		}
+		if over := len(m.hist) - int(tr.maxLen); over > 0 {
+			m.hist = m.hist[:copy(m.hist, m.hist[over:])]
+			if tr.collapseSpace {
+				m.histPos = m.histPos[:copy(m.histPos, m.histPos[over:])]
+			}
+		}
+	}
+	if len(input) != 0 {
+		m.inSpace = tr.collapseSpace && isSpaceByte(input[len(input)-1])
+	}
+	m.held = held
+	m.state = s
+	m.offset += uint32(len(input))
+	return true
+}
+
+// Flush ends the stream, reporting the matches Feed held back because
+// they end at the last byte fed. It returns false if fn stopped, in
+// which case the Matcher is left as it was. Call Reset or ResetState
+// before feeding more. Flush reports nothing for a Trie without whole-word
+// matching, white space collapsing, or end anchors, whose matches Feed
+// reports at once.
+func (m *Matcher) Flush(fn WalkFn) bool {
+	for _, h := range m.held {
+		if !fn(m.offset-1, m.offset-h.start, h.pattern) {
+			return false
+		}
+	}
+	m.held = m.held[:0]
+	return true
+}
+
+// State returns the automaton state after the input fed so far, for
+// IsAtRoot or, on a Trie WalkAt accepts, to continue the stream with
+// WalkAt.
+func (m *Matcher) State() uint32 {
+	return m.state
+}
+
+// AtRoot is IsAtRoot for the Matcher's state: true when no partial
+// match is pending, so input fed so far need not be kept.
+func (m *Matcher) AtRoot() bool {
+	return m.tr.IsAtRoot(m.state)
+}
+
+// Offset returns the number of bytes fed so far.
+func (m *Matcher) Offset() uint32 {
+	return m.offset
+}
+
+// Reset returns the Matcher to the start of a stream.
+func (m *Matcher) Reset() {
+	m.ResetState()
+	m.offset = 0
+}
+
+// ResetState starts a new record but keeps the offset, so a stream of
+// independent records can be matched with no match spanning a record
+// boundary while positions still count from the start of the stream.
+// Each record is matched as a stream of its own, from its whole-word
+// boundaries to its end anchors; call Flush at the end of each, then
+// ResetState.
+func (m *Matcher) ResetState() {
+	m.state = rootState
+	m.hist, m.histPos, m.held = m.hist[:0], m.histPos[:0], m.held[:0]
+	m.inSpace = false
+}
@@ -0,0 +1,158 @@
+package ahocorasick
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"hers", "she"}).Build()
+	m := trie.NewMatcher()
+	var got []uint32
+	collect := func(end, n, pattern uint32) bool {
+		got = append(got, end, pattern)
+		return true
+	}
+	for _, piece := range []string{"us", "he", "rs"} {
+		if !m.Feed([]byte(piece), collect) {
+			t.Fatal("Feed stopped")
+		}
+		if m.AtRoot() {
+			t.Errorf("at root after %q, with a match pending", piece)
+		}
+	}
+	if want := []uint32{3, 1, 5, 0}; !slices.Equal(got, want) {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+
+	// A tail that begins no pattern leaves the matcher at the root.
+	m.Feed([]byte(" xyz "), collect)
+	if !m.AtRoot() || !trie.IsAtRoot(m.State()) {
+		t.Errorf("state %d after a non-matching tail, want the root", m.State())
+	}
+	if m.Offset() != 11 {
+		t.Errorf("Offset = %d, want 11", m.Offset())
+	}
+
+	// Stopping leaves the state as it was.
+	before := m.State()
+	if m.Feed([]byte("she"), func(end, n, pattern uint32) bool { return false }) {
+		t.Error("Feed did not report the stop")
+	}
+	if m.State() != before || m.Offset() != 11 {
+		t.Errorf("after a stop: state %d, offset %d", m.State(), m.Offset())
+	}
+
+	m.Reset()
+	if !m.AtRoot() || m.Offset() != 0 {
+		t.Errorf("after Reset: state %d, offset %d", m.State(), m.Offset())
+	}
+	if !trie.IsAtRoot(0) {
+		t.Error("state 0 is not reported as the root")
+	}
+}
+
+func TestMatcherResetState(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"she", "rec"}).Build()
+	m := trie.NewMatcher()
+	var got []uint32
+	collect := func(end, n, pattern uint32) bool {
+		got = append(got, end, pattern)
+		return true
+	}
+	for _, record := range []string{"a rec sh", "e", "rec"} {
+		m.Feed([]byte(record), collect)
+		m.ResetState()
+		if !m.AtRoot() {
+			t.Errorf("state %d after ResetState, want the root", m.State())
+		}
+	}
+	// "sh" and "e" are separate records, so "she" does not match.
+	if want := []uint32{4, 1, 11, 1}; !slices.Equal(got, want) {
+		t.Errorf("matches = %v, want %v", got, want)
+	}
+	if m.Offset() != 12 {
+		t.Errorf("Offset = %d, want 12", m.Offset())
+	}
+}
+
+// TestMatcherSettings feeds tries whose matches depend on the bytes
+// around them in pieces of every size up to the whole input, and checks
+// Feed then Flush report what one Walk does.
+func TestMatcherSettings(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		tr    *Trie
+		input string
+	}{
+		{"whole word", NewTrieBuilder().AddStrings([]string{"cat", "at"}).SetWholeWord(true).Build(),
+			"the cat sat. concat cats; at cat"},
+		{"end anchored", NewTrieBuilder().AddPatternEndAnchored([]byte("cat")).AddString("at").Build(),
+			"the cat sat. concat cats; at cat"},
+		{"collapse", NewTrieBuilder().AddStrings([]string{"a b", "b c ", " "}).SetCollapseWhitespace(true).Build(),
+			"  a \t b   c\n\na b\tc  "},
+		{"all", NewTrieBuilder().AddStrings([]string{"new york", "york"}).AddPatternEndAnchored([]byte("york  ")).
+			SetWholeWord(true).SetCollapseWhitespace(true).Build(),
+			"new   york newyork new\tyorkshire  new york \n"},
+	} {
+		input := []byte(tc.input)
+		var want [][3]uint32
+		tc.tr.Walk(input, func(end, n, pattern uint32) bool {
+			want = append(want, [3]uint32{end, n, pattern})
+			return true
+		})
+		if len(want) == 0 {
+			t.Fatalf("%s: no matches", tc.name)
+		}
+		for size := 1; size <= len(input); size++ {
+			var got [][3]uint32
+			collect := func(end, n, pattern uint32) bool {
+				got = append(got, [3]uint32{end, n, pattern})
+				return true
+			}
+			m := tc.tr.NewMatcher()
+			for i := 0; i < len(input); i += size {
+				m.Feed(input[i:min(i+size, len(input))], collect)
+			}
+			m.Flush(collect)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s, pieces of %d: got %v, want %v", tc.name, size, got, want)
+			}
+		}
+	}
+}
+
+func TestMatcherFlush(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"cat"}).SetWholeWord(true).Build()
+	m := trie.NewMatcher()
+	var got []uint32
+	collect := func(end, n, pattern uint32) bool {
+		got = append(got, end, pattern)
+		return true
+	}
+	m.Feed([]byte("a cat"), collect)
+	if len(got) != 0 {
+		t.Fatalf("match at the end of a piece reported before what follows: %v", got)
+	}
+
+	// Stopping leaves the held match for the next call.
+	if m.Flush(func(end, n, pattern uint32) bool { return false }) {
+		t.Error("Flush did not report the stop")
+	}
+	if !m.Flush(collect) || !slices.Equal(got, []uint32{4, 0}) {
+		t.Errorf("after Flush: %v", got)
+	}
+
+	// A record ends at ResetState: "cat" at its end is a whole word even
+	// though the next record begins with a word byte.
+	got = nil
+	m.Reset()
+	m.Feed([]byte("cat"), collect)
+	m.Flush(collect)
+	m.ResetState()
+	m.Feed([]byte("s cat"), collect)
+	m.Flush(collect)
+	if want := []uint32{2, 0, 7, 0}; !slices.Equal(got, want) {
+		t.Errorf("records: got %v, want %v", got, want)
+	}
+}
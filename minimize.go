@@ -0,0 +1,233 @@
+package ahocorasick
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+)
+
+// errMinimized is Encode's error for a minimized Trie.
+var errMinimized = errors.New("ahocorasick: cannot encode a minimized trie")
+
+// BuildMinimized is Build followed by DFA minimization: states that
+// report the same matches on every continuation of the input are merged
+// into one, as in DAWG construction. The result reports exactly the
+// matches Build's would, through every matching method.
+//
+// Merging needs patterns that share ids. When every pattern has its own
+// id, an Aho-Corasick automaton is already minimal: each state is the
+// only one that reports the pattern it is a prefix of after reading the
+// rest of it. Dictionaries that map many patterns to a few ids with
+// AddPatternWithID, such as k-mers labeled by organism or keywords by
+// category, can shrink a lot, above all where patterns sharing an id
+// share long tails.
+//
+// Merging makes the automaton a graph rather than a tree of patterns.
+// Patterns (and Diff) answer from a list recovered before merging, and
+// MatchSkip, whose shift scan follows tree edges, finds its matches by
+// a plain walk instead, in its usual order. Encode rejects a minimized
+// Trie, since a decoded one could not know it was merged; ExportFlat
+// writes it like any other. Minimizing costs time proportional to the
+// transition table per refinement round, up to one round per byte of
+// the longest pattern, on top of Build.
+func (tb *TrieBuilder) BuildMinimized() *Trie {
+	tr := tb.Build()
+	tr.minimize()
+	return tr
+}
+
+// minimize merges equivalent states in place (Moore's partition
+// refinement). States start out grouped by what they emit — pattern
+// length, id, anchor, priority, and the emissions of their output link —
+// and groups split until every member of a group moves to the same
+// groups on every byte.
+// Unreachable states are dropped and the groups renumbered breadth
+// first, so the root stays state 1 and, as in a built trie, output links
+// point to shallower states: each group takes its tables from its
+// shallowest member.
+func (tr *Trie) minimize() {
+	n := tr.NumStates()
+	reach := make([]uint32, 0, n) // reachable states, breadth first
+	seen := make([]bool, n)
+	seen[rootState] = true
+	reach = append(reach, rootState)
+	var row [256]uint32
+	for qi := 0; qi < len(reach); qi++ {
+		for _, v := range tr.row(reach[qi], &row) {
+			if t := v & stateMask; !seen[t] {
+				seen[t] = true
+				reach = append(reach, t)
+			}
+		}
+	}
+	// Breadth first, reach lists states by depth, so output links point
+	// to states earlier in it.
+
+	// Initial groups: equal emissions, anchors, and priorities.
+	type emission struct {
+		dict, pattern, link uint32
+		anchored            bool
+		priority            int
+	}
+	group := make([]uint32, n)
+	ids := make(map[emission]uint32)
+	for _, s := range reach {
+		key := emission{dict: tr.dict[s]}
+		if tr.dict[s] != 0 {
+			key.pattern = tr.pattern[s]
+			key.anchored = tr.endAnchored != nil && tr.endAnchored[s]
+			if tr.priority != nil {
+				key.priority = tr.priority[s]
+			}
+		}
+		if u := tr.dictLink[s]; u != nilState {
+			key.link = group[u] + 1
+		}
+		g, ok := ids[key]
+		if !ok {
+			g = uint32(len(ids))
+			ids[key] = g
+		}
+		group[s] = g
+	}
+	count := len(ids)
+
+	// Refine until no group splits. A state's signature is its group and
+	// the groups of its 256 successors, hashed; a hash already taken by a
+	// different signature probes on to the next value.
+	next := make([]uint32, n)
+	var reps []uint32 // first state of each new group
+	byHash := make(map[uint64]uint32, count)
+	for {
+		reps = reps[:0]
+		clear(byHash)
+		for _, s := range reach {
+			h := uint64(group[s])*0x9e3779b97f4a7c15 + 1
+			for _, v := range tr.row(s, &row) {
+				h = (h ^ uint64(group[v&stateMask])) * 0x100000001b3
+			}
+			for {
+				g, ok := byHash[h]
+				if !ok {
+					g = uint32(len(reps))
+					byHash[h] = g
+					reps = append(reps, s)
+				} else if !tr.sameSignature(group, s, reps[g]) {
+					h++
+					continue
+				}
+				next[s] = g
+				break
+			}
+		}
+		group, next = next, group
+		if len(reps) == count {
+			break
+		}
+		count = len(reps)
+	}
+
+	// Renumber groups breadth first from the root, each represented by
+	// its shallowest member (the first in reach).
+	rep := make([]uint32, count)
+	for i := len(reach) - 1; i >= 0; i-- {
+		rep[group[reach[i]]] = reach[i]
+	}
+	newID := make([]uint32, count)
+	order := make([]uint32, 0, count) // groups by new id, from the root
+	order = append(order, group[rootState])
+	newID[group[rootState]] = rootState
+	assigned := make([]bool, count)
+	assigned[group[rootState]] = true
+	for qi := 0; qi < len(order); qi++ {
+		for _, v := range tr.row(rep[order[qi]], &row) {
+			if g := group[v&stateMask]; !assigned[g] {
+				assigned[g] = true
+				newID[g] = uint32(len(order)) + rootState
+				order = append(order, g)
+			}
+		}
+	}
+
+	m := len(order) + int(rootState)
+	failTrans := make([][256]uint32, m)
+	dict := make([]uint32, m)
+	pattern := make([]uint32, m)
+	dictLink := make([]uint32, m)
+	var priority []int
+	if tr.priority != nil {
+		priority = make([]int, m)
+	}
+	var endAnchored []bool
+	if tr.endAnchored != nil {
+		endAnchored = make([]bool, m)
+	}
+	for b := range failTrans[nilState] {
+		failTrans[nilState][b] = rootState
+	}
+	for i, g := range order {
+		s, t := rep[g], uint32(i)+rootState
+		for b, v := range tr.row(s, &row) {
+			failTrans[t][b] = newID[group[v&stateMask]]
+		}
+		dict[t], pattern[t] = tr.dict[s], tr.pattern[s]
+		if u := tr.dictLink[s]; u != nilState {
+			dictLink[t] = newID[group[u]]
+		}
+		if priority != nil {
+			priority[t] = tr.priority[s]
+		}
+		if endAnchored != nil {
+			endAnchored[t] = tr.endAnchored[s]
+		}
+	}
+
+	tr.patterns = tr.patternEntries()
+	tr.failTrans, tr.dict, tr.pattern, tr.dictLink = failTrans, dict, pattern, dictLink
+	tr.priority, tr.endAnchored = priority, endAnchored
+	tr.failTrans16, tr.failTransC = nil, nil
+	tr.failLink, tr.keepFail = nil, false
+	tr.addOutputFlags()
+	tr.buildRootSkip()
+	tr.buildFailTrans16()
+	if tr.classTableWanted() {
+		tr.buildClassRows(tr.derivedLiveBytes())
+	}
+	tr.setStopEntry()
+	tr.buildSinglePattern()
+	tr.compactASCII()
+	tr.minimized = true
+}
+
+// sameSignature reports whether states s and t are in the same group and
+// move to the same groups on every byte.
+func (tr *Trie) sameSignature(group []uint32, s, t uint32) bool {
+	if group[s] != group[t] {
+		return false
+	}
+	var bs, bt [256]uint32
+	rs, rt := tr.row(s, &bs), tr.row(t, &bt)
+	for b := range rs {
+		if group[rs[b]&stateMask] != group[rt[b]&stateMask] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSkipWalk is MatchSkip for minimized and white-space-collapsing
+// tries: every match, found by a plain walk, in MatchSkip's order.
+func (tr *Trie) matchSkipWalk(input []byte) []*Match {
+	var spans []span
+	tr.walkMatches(input, func(start, end, s uint32) bool {
+		spans = append(spans, span{start: start, end: end, pattern: tr.pattern[s]})
+		return true
+	})
+	slices.SortFunc(spans, func(a, b span) int {
+		if c := cmp.Compare(a.start, b.start); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.end, b.end)
+	})
+	return tr.pooledMatches(input, spans)
+}
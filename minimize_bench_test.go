@@ -0,0 +1,29 @@
+package ahocorasick
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// BenchmarkBuildMinimized builds a k-mer dictionary whose patterns share
+// a few common tails, labeled by tail, and reports the state counts
+// before and after minimizing.
+func BenchmarkBuildMinimized(b *testing.B) {
+	genome := kmers(rand.New(rand.NewSource(1)), 20000, 16)
+	builder := func() *TrieBuilder {
+		tb := NewTrieBuilder()
+		for _, k := range genome {
+			tb.AddPatternWithID([]byte(k), uint32(k[len(k)-1]))
+		}
+		return tb
+	}
+	plain := builder().Build()
+	var min *Trie
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		min = builder().BuildMinimized()
+	}
+	b.ReportMetric(float64(plain.NumStates()), "states")
+	b.ReportMetric(float64(min.NumStates()), "min-states")
+}
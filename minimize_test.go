@@ -0,0 +1,102 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// kmers returns n random k-mers over ACGT, sharing tails by construction:
+// every k-mer ends in one of a few fixed suffixes.
+func kmers(rng *rand.Rand, n, k int) []string {
+	suffixes := []string{"TTAGGG", "CCCTAA", "GATC"}
+	out := make([]string, n)
+	for i := range out {
+		suf := suffixes[rng.Intn(len(suffixes))]
+		b := make([]byte, k-len(suf), k)
+		for j := range b {
+			b[j] = "ACGT"[rng.Intn(4)]
+		}
+		out[i] = string(append(b, suf...))
+	}
+	return out
+}
+
+func TestBuildMinimized(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen, err := os.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	dna := make([]byte, 1<<16)
+	for i := range dna {
+		dna[i] = "ACGT"[rng.Intn(4)]
+	}
+	genome := kmers(rng, 2000, 12)
+
+	for _, tc := range []struct {
+		name  string
+		build func() *TrieBuilder
+		input []byte
+	}{
+		{"words", func() *TrieBuilder { return NewTrieBuilder().AddStrings(patterns[:5000]) }, ibsen},
+		{"kmers", func() *TrieBuilder { return NewTrieBuilder().AddStrings(genome) }, dna},
+		{"labeled kmers", func() *TrieBuilder {
+			tb := NewTrieBuilder()
+			for _, k := range genome {
+				tb.AddPatternWithID([]byte(k), uint32(k[len(k)-1]))
+			}
+			return tb
+		}, dna},
+		{"nested", func() *TrieBuilder {
+			return NewTrieBuilder().AddStrings([]string{"a", "aa", "aaa", "ba", "bba"})
+		}, []byte("aaabbbabaaba")},
+		{"whole word", func() *TrieBuilder {
+			return NewTrieBuilder().SetWholeWord(true).AddStrings(patterns[:2000])
+		}, ibsen},
+		{"single", func() *TrieBuilder { return NewTrieBuilder().AddString("og") }, ibsen},
+	} {
+		plain, min := tc.build().Build(), tc.build().BuildMinimized()
+		// Only shared ids let states merge.
+		if shrank := min.NumStates() < plain.NumStates(); shrank != (tc.name == "labeled kmers") {
+			t.Errorf("%s: %d states after minimizing %d", tc.name, min.NumStates(), plain.NumStates())
+		}
+		if err := min.Validate(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if i := diffTriples(triplesFromMatches(min.Match(tc.input)), triplesFromMatches(plain.Match(tc.input))); i >= 0 {
+			t.Errorf("%s: Match differs at %d", tc.name, i)
+		}
+		if i := diffTriples(triplesFromMatches(min.MatchSkip(tc.input)), triplesFromMatches(plain.MatchSkip(tc.input))); i >= 0 {
+			t.Errorf("%s: MatchSkip differs at %d", tc.name, i)
+		}
+		if !equalBytesList(min.Patterns(), plain.Patterns()) {
+			t.Errorf("%s: Patterns differ", tc.name)
+		}
+	}
+
+	// "xb" and "yb" share an id and a future but not a priority, so they
+	// stay apart, and "ybc" still outranks "yb".
+	prio := func() *TrieBuilder {
+		return NewTrieBuilder().
+			AddPatternWithPriority([]byte("xb"), 5).
+			AddPatternWithID([]byte("yb"), 0).
+			AddPatternWithID([]byte("xbc"), 2).
+			AddPatternWithID([]byte("ybc"), 2)
+	}
+	for _, input := range []string{"ybc", "xbc"} {
+		want := triplesFromMatches(prio().Build().MatchByPriority([]byte(input)))
+		if i := diffTriples(triplesFromMatches(prio().BuildMinimized().MatchByPriority([]byte(input))), want); i >= 0 {
+			t.Errorf("priorities over %q: MatchByPriority differs at %d", input, i)
+		}
+	}
+
+	if err := Encode(&bytes.Buffer{}, NewTrieBuilder().AddString("x").BuildMinimized()); err == nil {
+		t.Error("Encode of a minimized trie: expected an error")
+	}
+}
@@ -0,0 +1,112 @@
+package ahocorasick
+
+import (
+	"cmp"
+	"slices"
+)
+
+// MultiTrie runs several Tries over the same input in priority order, so
+// separately owned dictionaries, such as secrets, PII, and profanity, can
+// be matched together with the more important ones winning contested
+// bytes. The first Trie has the highest priority.
+//
+// Overlap rule: a match from one Trie is suppressed when it shares at
+// least one input byte with a reported match from any higher-priority
+// Trie. Matches that merely touch, one ending where the other begins, do
+// not overlap. Matches from the same Trie never suppress each other, so
+// each Trie reports all of its matches, overlapping or not, that
+// survive the Tries above it. A suppressed match suppresses nothing.
+type MultiTrie struct {
+	tries []*Trie
+}
+
+// NewMultiTrie returns a MultiTrie over tries, highest priority first.
+func NewMultiTrie(tries ...*Trie) *MultiTrie {
+	return &MultiTrie{tries: slices.Clone(tries)}
+}
+
+// Tries returns the Tries in priority order. The slice must not be
+// modified.
+func (mt *MultiTrie) Tries() []*Trie {
+	return mt.tries
+}
+
+// MultiMatch is a Match together with the index of the Trie that found
+// it. Pattern ids are those of that Trie.
+type MultiMatch struct {
+	*Match
+	trie int
+}
+
+// Trie returns the index, in NewMultiTrie's arguments, of the Trie that
+// found the match.
+func (m MultiMatch) Trie() int {
+	return m.trie
+}
+
+// Match runs each Trie's Walk over input and returns the matches the
+// overlap rule keeps (see MultiTrie), ordered like Trie.Match: by end
+// position, longer first, and then by Trie priority. Checking a match
+// against the higher-priority ones costs constant time, after a pass over
+// input per Trie. The result mixes matches of several Tries, so it
+// cannot come from any one Trie's pool: it is allocated per call, and
+// must not be passed to ReleaseMatches.
+func (mt *MultiTrie) Match(input []byte) []MultiMatch {
+	type multiSpan struct {
+		span
+		trie int
+	}
+	var spans []multiSpan
+	var edges []int32    // +1 where a higher match starts, -1 past its end
+	var claimed []uint32 // claimed[b]: bytes before b inside a higher match
+	marked := 0          // spans already in edges
+	for i, tr := range mt.tries {
+		if marked < len(spans) {
+			if claimed == nil {
+				edges = make([]int32, len(input)+1)
+				claimed = make([]uint32, len(input)+1)
+			}
+			for _, s := range spans[marked:] {
+				edges[s.start]++
+				edges[s.end]--
+			}
+			marked = len(spans)
+			depth := int32(0)
+			for b := range input {
+				depth += edges[b]
+				claimed[b+1] = claimed[b]
+				if depth > 0 {
+					claimed[b+1]++
+				}
+			}
+		}
+		tr.Walk(input, func(end, n, pattern uint32) bool {
+			start := end + 1 - n
+			if claimed == nil || claimed[end+1] == claimed[start] {
+				spans = append(spans, multiSpan{span{start: start, end: end + 1, pattern: pattern}, i})
+			}
+			return true
+		})
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(spans, func(a, b multiSpan) int {
+		if c := cmp.Compare(a.end, b.end); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.end-b.start, a.end-a.start)
+	})
+	arena := make([]Match, len(spans))
+	out := make([]MultiMatch, len(spans))
+	for i, s := range spans {
+		arena[i] = Match{pos: s.start, pattern: s.pattern, match: input[s.start:s.end], buf: mt.tries[s.trie].textLink}
+		out[i] = MultiMatch{Match: &arena[i], trie: s.trie}
+	}
+	return out
+}
+
+// MatchString is Match for a string input.
+func (mt *MultiTrie) MatchString(input string) []MultiMatch {
+	return mt.Match([]byte(input))
+}
@@ -0,0 +1,45 @@
+package ahocorasick
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestMultiTrie(t *testing.T) {
+	secrets := NewTrieBuilder().AddStrings([]string{"key=abc123"}).Build()
+	words := NewTrieBuilder().AddStrings([]string{"key", "abc", "123", "xyz", "45"}).Build()
+	mt := NewMultiTrie(secrets, words)
+
+	var got []string
+	for _, m := range mt.MatchString("key=abc123 xyz 12345") {
+		got = append(got, fmt.Sprintf("%d:%d:%s", m.Trie(), m.Pos(), m.Match.Match()))
+	}
+	// The secret claims bytes 0-9, suppressing the words inside it; the
+	// words outside it survive.
+	want := []string{"0:0:key=abc123", "1:11:xyz", "1:15:123", "1:18:45"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Swapping priorities lets the words win instead; the secret, which
+	// shares bytes with them, is suppressed.
+	got = got[:0]
+	for _, m := range NewMultiTrie(words, secrets).MatchString("key=abc123") {
+		got = append(got, fmt.Sprintf("%d:%d:%s", m.Trie(), m.Pos(), m.Match.Match()))
+	}
+	if want := []string{"0:0:key", "0:4:abc", "0:7:123"}; !slices.Equal(got, want) {
+		t.Errorf("swapped: got %v, want %v", got, want)
+	}
+
+	// Touching is not overlapping.
+	a := NewTrieBuilder().AddString("ab").Build()
+	b := NewTrieBuilder().AddStrings([]string{"cd", "bc"}).Build()
+	got = got[:0]
+	for _, m := range NewMultiTrie(a, b).MatchString("abcd") {
+		got = append(got, fmt.Sprintf("%d:%d:%s", m.Trie(), m.Pos(), m.Match.Match()))
+	}
+	if want := []string{"0:0:ab", "1:2:cd"}; !slices.Equal(got, want) {
+		t.Errorf("touching: got %v, want %v", got, want)
+	}
+}
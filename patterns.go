@@ -0,0 +1,317 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"slices"
+)
+
+// gotoTree recovers the goto edges of the trie from its transitions: parent[s]
+// is the state whose real (non-fail) edge on byte label[s] leads to s,
+// and depth[s] is the length of the string that reaches s. The root,
+// state 0, and any state unreachable from the root keep parent nilState
+// and depth 0.
+//
+// A transition δ(s, c) lands on the longest suffix of s·c that is a trie
+// node, so it is a goto edge exactly when the target is one deeper than
+// s. Every path from the root to a node of depth d reads at least d
+// bytes, so a breadth-first search discovers each state first from a
+// state one shallower — its goto parent — and the byte of that first
+// discovery is its edge label. This works from the table alone, so
+// decoded tries recover the same tree as built ones.
+func (tr *Trie) gotoTree() (parent []uint32, label []byte, depth []uint32) {
+	n := tr.NumStates()
+	parent = make([]uint32, n)
+	label = make([]byte, n)
+	depth = make([]uint32, n)
+	seen := make([]bool, n)
+	seen[nilState], seen[rootState] = true, true
+	queue := make([]uint32, 1, n)
+	queue[0] = rootState
+	var buf [256]uint32
+	for qi := 0; qi < len(queue); qi++ {
+		s := queue[qi]
+		row := tr.row(s, &buf)
+		for b := range 256 {
+			t := row[b] & stateMask
+			if !seen[t] {
+				seen[t] = true
+				parent[t] = s
+				label[t] = byte(b)
+				depth[t] = depth[s] + 1
+				queue = append(queue, t)
+			}
+		}
+	}
+	return parent, label, depth
+}
+
+// depths returns gotoTree's depth table, computing it on first use.
+func (tr *Trie) depths() []uint32 {
+	tr.depthOnce.Do(func() { _, _, tr.depth = tr.gotoTree() })
+	return tr.depth
+}
+
+// FailLink returns the failure link of state: the state for the longest
+// proper suffix of the string state stands for that is also a prefix of
+// some pattern, where the automaton resumes when state has no goto edge
+// on the next byte. Custom variants build on it, such as reporting the
+// longest proper suffix that is itself a pattern. The root's link, like
+// that of state 0 or an out-of-range state, is 0.
+//
+// A Trie built with TrieBuilder.SetKeepFailLinks, or decoded from one,
+// stores the links. Otherwise the first call recovers them from the
+// transition table (a child's link is its parent's link moved on the
+// child's byte), costing time proportional to the table and 4 bytes per
+// state kept from then on, so tries that never ask pay nothing. A
+// minimized Trie no longer tells goto edges from failure transitions
+// (see Descend), so FailLink panics there.
+func (tr *Trie) FailLink(state uint32) uint32 {
+	if tr.minimized {
+		panic("ahocorasick: FailLink on a minimized trie")
+	}
+	tr.failOnce.Do(tr.buildFailLinks)
+	if int(state) >= len(tr.failLink) {
+		return nilState
+	}
+	return tr.failLink[state]
+}
+
+// buildFailLinks fills failLink breadth first along gotoTree's edges,
+// unless Build or Decode kept it.
+func (tr *Trie) buildFailLinks() {
+	if tr.keepFail {
+		return
+	}
+	parent, label, _ := tr.gotoTree()
+	fail := make([]uint32, tr.NumStates())
+	queue := make([]uint32, 1, tr.NumStates())
+	queue[0] = rootState
+	var row [256]uint32
+	for qi := 0; qi < len(queue); qi++ {
+		s := queue[qi]
+		for b, v := range tr.row(s, &row) {
+			t := v & stateMask
+			if parent[t] != s || label[t] != byte(b) {
+				continue
+			}
+			if s == rootState {
+				fail[t] = rootState
+			} else {
+				fail[t] = tr.next(fail[s], byte(b)) & stateMask
+			}
+			queue = append(queue, t)
+		}
+	}
+	tr.failLink = fail
+}
+
+// Descend follows prefix from the root along goto edges only, the edges
+// of the trie of patterns, and returns the state it reaches; ok is false
+// when prefix is not a prefix of any pattern. The empty prefix reaches
+// the root. The state can start a WalkAt over the input that follows the
+// prefix. Prefix bytes go through the Trie's byte transform like input,
+// and a reversed Trie holds its patterns back to front.
+//
+// The first call computes the depth of every state, which costs time
+// proportional to the transition table; later calls cost one step per
+// prefix byte. A minimized Trie no longer tells goto edges from failure
+// transitions, so it cannot answer: Descend panics there rather than
+// report a wrong false.
+func (tr *Trie) Descend(prefix []byte) (state uint32, ok bool) {
+	if tr.minimized {
+		panic("ahocorasick: Descend on a minimized trie")
+	}
+	if len(prefix) == 0 {
+		return rootState, true
+	}
+	depth := tr.depths()
+	s := rootState
+	for i, c := range prefix {
+		s = tr.next(s, c) & stateMask
+		if depth[s] != uint32(i+1) {
+			return nilState, false
+		}
+	}
+	return s, true
+}
+
+// Patterns recovers the patterns the trie matches from the automaton
+// itself, with no copy of the original input kept. It returns one entry
+// per pattern, ordered by pattern id; entries sharing an id (possible
+// only with duplicate explicit ids) are ordered bytewise. A pattern
+// added more than once appears once. Patterns that can never match are
+// not reported: empty patterns, and patterns containing a byte outside
+// the alphabet (see TrieBuilder.SetAlphabet).
+//
+// Recovery walks the whole transition table, so it costs time
+// proportional to the automaton size; it is meant for auditing and
+// tooling, not the matching path. A Trie decoded from format version 5
+// or later (see EncodeWithoutPatterns) reads the list stored with it
+// instead, costing only a copy.
+func (tr *Trie) Patterns() [][]byte {
+	entries := tr.patternEntries()
+	out := make([][]byte, len(entries))
+	for i, e := range entries {
+		out[i] = e.p
+		if tr.patterns != nil {
+			out[i] = bytes.Clone(e.p)
+		}
+	}
+	return out
+}
+
+// patternEntry is a pattern recovered from the automaton with its id.
+type patternEntry struct {
+	id uint32
+	p  []byte
+}
+
+// patternEntries is Patterns with each pattern's id. A minimized Trie
+// returns the list it recovered before merging, and a decoded one the
+// list it was stored with, which callers must not modify.
+func (tr *Trie) patternEntries() []patternEntry {
+	if tr.minimized || tr.patterns != nil {
+		return tr.patterns
+	}
+	return tr.recoverPatterns()
+}
+
+// recoverPatterns is patternEntries read off the goto tree.
+func (tr *Trie) recoverPatterns() []patternEntry {
+	parent, label, _ := tr.gotoTree()
+	var entries []patternEntry
+	for s := range tr.dict {
+		if tr.dict[s] == 0 {
+			continue
+		}
+		p := make([]byte, tr.dict[s])
+		u := uint32(s)
+		for i := len(p) - 1; i >= 0; i-- {
+			p[i] = label[u]
+			u = parent[u]
+		}
+		if u != rootState {
+			continue // no input reaches this state
+		}
+		entries = append(entries, patternEntry{tr.pattern[s], p})
+	}
+	slices.SortFunc(entries, func(a, b patternEntry) int {
+		if c := cmp.Compare(a.id, b.id); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.p, b.p)
+	})
+	return entries
+}
+
+// UnreachablePatterns returns the sorted ids of patterns that no input
+// can match because no input reaches their states: patterns containing
+// a byte outside the alphabet (see TrieBuilder.SetAlphabet), or, with a
+// byte transform, a byte the transform never produces, as when the
+// pattern was added before SetByteTransform. Such patterns point to a
+// configuration mistake. An id that another, reachable pattern also
+// carries is not reported. Like Patterns, it walks the whole transition
+// table.
+func (tr *Trie) UnreachablePatterns() []uint32 {
+	_, _, depth := tr.gotoTree()
+	var dead []uint32
+	live := make(map[uint32]bool)
+	for s, n := range tr.dict {
+		if n == 0 {
+			continue
+		}
+		if depth[s] == 0 {
+			dead = append(dead, tr.pattern[s])
+		} else {
+			live[tr.pattern[s]] = true
+		}
+	}
+	dead = slices.DeleteFunc(dead, func(id uint32) bool { return live[id] })
+	slices.Sort(dead)
+	return slices.Compact(dead)
+}
+
+// EachPattern calls fn once per pattern state with its pattern id and
+// length, in state order. It reads only the per-state output arrays, so
+// unlike Patterns it costs time proportional to the state count, not the
+// table size. Every terminal is visited, including one whose pattern an
+// alphabet restriction made unreachable; a pattern added more than once
+// is visited once, and empty patterns not at all.
+func (tr *Trie) EachPattern(fn func(patternID, length uint32)) {
+	for s, n := range tr.dict {
+		if n != 0 {
+			fn(tr.pattern[s], n)
+		}
+	}
+}
+
+// Diff reports which patterns were added and removed going from old to
+// new, comparing the pattern sets both tries recover (see Patterns).
+// Pattern ids are ignored: a pattern present in both tries counts as
+// unchanged even if its id differs. Both results are sorted bytewise,
+// so the output does not depend on insertion order.
+func Diff(old, new *Trie) (added, removed [][]byte, err error) {
+	if old == nil || new == nil {
+		return nil, nil, errors.New("ahocorasick: Diff of a nil Trie")
+	}
+	oldPats, newPats := old.Patterns(), new.Patterns()
+	inOld := make(map[string]struct{}, len(oldPats))
+	for _, p := range oldPats {
+		inOld[string(p)] = struct{}{}
+	}
+	inNew := make(map[string]struct{}, len(newPats))
+	for _, p := range newPats {
+		inNew[string(p)] = struct{}{}
+		if _, ok := inOld[string(p)]; !ok {
+			added = append(added, p)
+		}
+	}
+	for _, p := range oldPats {
+		if _, ok := inNew[string(p)]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	slices.SortFunc(added, bytes.Compare)
+	slices.SortFunc(removed, bytes.Compare)
+	return added, removed, nil
+}
+
+// textRef locates a pattern's text as added in the builder's and Trie's
+// text buffers.
+type textRef struct {
+	id, off, n uint32
+}
+
+// patternText is Match.PatternBytes for a match of pattern id on the
+// given bytes.
+func (tr *Trie) patternText(id uint32, match []byte) []byte {
+	i, found := slices.BinarySearchFunc(tr.textRefs, id, func(r textRef, id uint32) int {
+		return cmp.Compare(r.id, id)
+	})
+	if !found {
+		return nil
+	}
+	refs := tr.textRefs[i:]
+	for j, r := range refs {
+		if r.id != id {
+			refs = refs[:j]
+			break
+		}
+	}
+	text := func(r textRef) []byte { return tr.text[r.off : r.off+r.n : r.off+r.n] }
+	if len(refs) > 1 {
+		for _, r := range refs {
+			if bytes.Equal(text(r), match) {
+				return text(r)
+			}
+		}
+		for _, r := range refs {
+			if int(r.n) == len(match) {
+				return text(r)
+			}
+		}
+	}
+	return text(refs[0])
+}
@@ -0,0 +1,229 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func bytesList(ss ...string) [][]byte {
+	out := make([][]byte, len(ss))
+	for i, s := range ss {
+		out[i] = []byte(s)
+	}
+	return out
+}
+
+func equalBytesList(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPatterns(t *testing.T) {
+	patterns := []string{"he", "she", "his", "hers", "\x00\xff", "h"}
+	tr := NewTrieBuilder().AddStrings(patterns).Build()
+	if got := tr.Patterns(); !equalBytesList(got, bytesList(patterns...)) {
+		t.Errorf("expected %q, got %q", patterns, got)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, tr); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded.Patterns(); !equalBytesList(got, bytesList(patterns...)) {
+		t.Errorf("decoded: expected %q, got %q", patterns, got)
+	}
+}
+
+func TestPatternsLargeDictionary(t *testing.T) {
+	patterns, err := readPatterns("./test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns = patterns[:5000]
+	got := NewTrieBuilder().AddStrings(patterns).Build().Patterns()
+	if !equalBytesList(got, bytesList(patterns...)) {
+		t.Errorf("recovered %d patterns, differing from the %d inserted", len(got), len(patterns))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := NewTrieBuilder().AddStrings([]string{"a", "b"}).Build()
+	new := NewTrieBuilder().AddStrings([]string{"c", "b"}).Build()
+
+	added, removed, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalBytesList(added, bytesList("c")) {
+		t.Errorf("expected added [c], got %q", added)
+	}
+	if !equalBytesList(removed, bytesList("a")) {
+		t.Errorf("expected removed [a], got %q", removed)
+	}
+
+	added, removed, err = Diff(old, old)
+	if err != nil || len(added) != 0 || len(removed) != 0 {
+		t.Errorf("self diff: expected no changes, got +%q -%q (%v)", added, removed, err)
+	}
+
+	if _, _, err := Diff(nil, new); err == nil {
+		t.Error("expected an error diffing a nil Trie")
+	}
+}
+
+func TestEachPattern(t *testing.T) {
+	patterns := []string{"he", "she", "his", "hers", "h", "she", ""}
+	tr := NewTrieBuilder().AddStrings(patterns).Build()
+
+	lengths := make(map[uint32]uint32)
+	tr.EachPattern(func(id, length uint32) {
+		if _, dup := lengths[id]; dup {
+			t.Errorf("pattern %d visited twice", id)
+		}
+		lengths[id] = length
+	})
+	// The duplicate "she" keeps its last id (5); the empty pattern never
+	// matches and is not a terminal.
+	want := map[uint32]uint32{0: 2, 5: 3, 2: 3, 3: 4, 4: 1}
+	if len(lengths) != len(want) {
+		t.Fatalf("expected %d terminals, got %v", len(want), lengths)
+	}
+	for id, n := range want {
+		if lengths[id] != n || uint32(len(patterns[id])) != n {
+			t.Errorf("pattern %d: expected length %d, got %d", id, n, lengths[id])
+		}
+	}
+}
+
+func TestUnreachablePatterns(t *testing.T) {
+	tr := NewTrieBuilder().
+		SetAlphabet([]byte("abcdefghijklmnopqrstuvwxyz")).
+		AddStrings([]string{"abc", "ab-c", "x", "Yes", "no"}).
+		Build()
+	if got := tr.UnreachablePatterns(); !slices.Equal(got, []uint32{1, 3}) {
+		t.Errorf("alphabet: expected [1 3], got %v", got)
+	}
+
+	// "HI" went in before the transform, which never produces upper case.
+	tr = NewTrieBuilder().
+		AddString("HI").
+		SetByteTransform(foldASCII).
+		AddStrings([]string{"Hello", "hi"}).
+		Build()
+	if got := tr.UnreachablePatterns(); !slices.Equal(got, []uint32{0}) {
+		t.Errorf("transform: expected [0], got %v", got)
+	}
+
+	tr = NewTrieBuilder().AddStrings([]string{"he", "she"}).Build()
+	if got := tr.UnreachablePatterns(); len(got) != 0 {
+		t.Errorf("plain trie: expected none, got %v", got)
+	}
+}
+
+func TestDescend(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"apple", "apply"}).Build()
+	s, ok := trie.Descend([]byte("app"))
+	if !ok {
+		t.Fatal(`Descend("app") reported no path`)
+	}
+	var got []uint32
+	trie.WalkAt([]byte("ly"), 3, s, func(end, n, pattern uint32) bool {
+		got = append(got, end, n, pattern)
+		return true
+	})
+	if want := []uint32{4, 5, 1}; !slices.Equal(got, want) {
+		t.Errorf("WalkAt from the app state = %v, want %v", got, want)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Descend on a minimized trie: expected a panic")
+			}
+		}()
+		NewTrieBuilder().AddString("apple").BuildMinimized().Descend([]byte("app"))
+	}()
+	if s, ok := trie.Descend(nil); !ok || s != rootState {
+		t.Errorf("Descend(nil) = %d, %v; want the root", s, ok)
+	}
+	for _, prefix := range []string{"xyz", "pple", "apples"} {
+		if _, ok := trie.Descend([]byte(prefix)); ok {
+			t.Errorf("Descend(%q) reported a path", prefix)
+		}
+	}
+}
+
+func TestFailLink(t *testing.T) {
+	tb := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers", "ushers", "sh"})
+	var encoded bytes.Buffer
+	built := tb.Build()
+	if err := Encode(&encoded, built); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := tb.SetKeepFailLinks(true).Build()
+	encoded.Reset()
+	if err := Encode(&encoded, kept); err != nil {
+		t.Fatal(err)
+	}
+	keptDecoded, err := Decode(&encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Kept links are there before the first FailLink; others are not,
+	// and are not encoded.
+	for name, tr := range map[string]*Trie{"built": built, "decoded": decoded, "kept": kept, "kept decoded": keptDecoded} {
+		if stored, want := len(tr.failLink) != 0, tr.keepFail; stored != want || want != strings.HasPrefix(name, "kept") {
+			t.Errorf("%s: stored fail links = %v, keepFail = %v", name, stored, want)
+		}
+	}
+
+	// Map every builder state to its trie state through its string, and
+	// check the trie's link against the one computeFailLinks set.
+	strs := make([][]byte, len(tb.states))
+	var visit func(s uint32)
+	visit = func(s uint32) {
+		for c := tb.states[s].firstChild; c != 0; c = tb.states[c].nextSib {
+			strs[c] = append(slices.Clone(strs[s]), tb.states[c].value)
+			visit(c)
+		}
+	}
+	visit(rootState)
+	for name, tr := range map[string]*Trie{"built": built, "decoded": decoded, "kept": kept, "kept decoded": keptDecoded} {
+		for u := rootState + 1; int(u) < len(tb.states); u++ {
+			s, ok := tr.Descend(strs[u])
+			if !ok {
+				t.Fatalf("%s: no state for %q", name, strs[u])
+			}
+			want, _ := tr.Descend(strs[tb.states[u].failLink])
+			if got := tr.FailLink(s); got != want {
+				t.Errorf("%s: FailLink(%q) = %d, want %d (%q)", name, strs[u], got, want, strs[tb.states[u].failLink])
+			}
+		}
+		if got := tr.FailLink(rootState); got != nilState {
+			t.Errorf("%s: FailLink(root) = %d, want 0", name, got)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("FailLink on a minimized trie: expected a panic")
+		}
+	}()
+	tb.BuildMinimized().FailLink(rootState)
+}
@@ -0,0 +1,116 @@
+package ahocorasick
+
+// PayloadTrieBuilder builds a PayloadTrie, a Trie whose patterns carry
+// payloads of type T, such as routes or rule metadata, returned with
+// each match without type assertions. It wraps a TrieBuilder: configure
+// the build through Builder, and add patterns through AddPattern so
+// each gets its payload. Patterns added to the TrieBuilder directly
+// carry T's zero value.
+type PayloadTrieBuilder[T any] struct {
+	tb       *TrieBuilder
+	payloads []T // by pattern id
+}
+
+// NewPayloadTrieBuilder returns an empty PayloadTrieBuilder.
+func NewPayloadTrieBuilder[T any]() *PayloadTrieBuilder[T] {
+	return &PayloadTrieBuilder[T]{tb: NewTrieBuilder()}
+}
+
+// Builder returns the underlying TrieBuilder, for settings such as
+// SetWholeWord.
+func (pb *PayloadTrieBuilder[T]) Builder() *TrieBuilder {
+	return pb.tb
+}
+
+// AddPattern adds a byte pattern carrying payload. As with
+// TrieBuilder.AddPattern, its id is the number of patterns added before
+// it, and adding the same pattern again keeps the last payload.
+func (pb *PayloadTrieBuilder[T]) AddPattern(pattern []byte, payload T) *PayloadTrieBuilder[T] {
+	id := pb.tb.numPatterns
+	pb.tb.AddPattern(pattern)
+	if n := int(id) + 1; n > len(pb.payloads) {
+		pb.payloads = append(pb.payloads, make([]T, n-len(pb.payloads))...)
+	}
+	pb.payloads[id] = payload
+	return pb
+}
+
+// AddString adds a string pattern carrying payload.
+func (pb *PayloadTrieBuilder[T]) AddString(pattern string, payload T) *PayloadTrieBuilder[T] {
+	return pb.AddPattern([]byte(pattern), payload)
+}
+
+// Build constructs the PayloadTrie.
+func (pb *PayloadTrieBuilder[T]) Build() *PayloadTrie[T] {
+	return &PayloadTrie[T]{trie: pb.tb.Build(), payloads: append([]T(nil), pb.payloads...)}
+}
+
+// PayloadTrie is a Trie whose patterns carry payloads of type T (see
+// PayloadTrieBuilder). The Trie itself, for every other matching method
+// and for Encode, is available through Trie; payloads are not
+// serialized.
+type PayloadTrie[T any] struct {
+	trie     *Trie
+	payloads []T // by pattern id
+}
+
+// PayloadMatch is a Match together with its pattern's payload.
+type PayloadMatch[T any] struct {
+	*Match
+	payload T
+}
+
+// Payload returns the payload of the matched pattern.
+func (m PayloadMatch[T]) Payload() T {
+	return m.payload
+}
+
+// Trie returns the underlying Trie.
+func (pt *PayloadTrie[T]) Trie() *Trie {
+	return pt.trie
+}
+
+// Payload returns the payload of the pattern with the given id, or T's
+// zero value if it has none.
+func (pt *PayloadTrie[T]) Payload(pattern uint32) T {
+	if int(pattern) < len(pt.payloads) {
+		return pt.payloads[pattern]
+	}
+	var zero T
+	return zero
+}
+
+// Match is Trie.Match with each match's payload, in the same order.
+// Rather than borrow a buffer from the Trie's pool that nothing could
+// return, it collects the matches with Walk into memory of its own, so
+// the result stays valid for as long as the caller keeps it.
+func (pt *PayloadTrie[T]) Match(input []byte) []PayloadMatch[T] {
+	var spans []span
+	pt.trie.Walk(input, func(end, n, pattern uint32) bool {
+		spans = append(spans, span{start: end + 1 - n, end: end + 1, pattern: pattern})
+		return true
+	})
+	if len(spans) == 0 {
+		return nil
+	}
+	arena := make([]Match, len(spans))
+	out := make([]PayloadMatch[T], len(spans))
+	for i, s := range spans {
+		arena[i] = Match{pos: s.start, pattern: s.pattern, match: input[s.start:s.end], buf: pt.trie.textLink}
+		out[i] = PayloadMatch[T]{Match: &arena[i], payload: pt.Payload(s.pattern)}
+	}
+	return out
+}
+
+// MatchString is Match for a string input.
+func (pt *PayloadTrie[T]) MatchString(input string) []PayloadMatch[T] {
+	return pt.Match([]byte(input))
+}
+
+// Walk is Trie.Walk handing fn each match's payload in place of its
+// pattern id.
+func (pt *PayloadTrie[T]) Walk(input []byte, fn func(end, n uint32, payload T) bool) {
+	pt.trie.Walk(input, func(end, n, pattern uint32) bool {
+		return fn(end, n, pt.Payload(pattern))
+	})
+}
@@ -0,0 +1,53 @@
+package ahocorasick
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPayloadTrie(t *testing.T) {
+	pb := NewPayloadTrieBuilder[int]()
+	pb.Builder().SetWholeWord(true)
+	trie := pb.AddString("he", 1).
+		AddString("she", 2).
+		AddString("hers", 3).
+		Build()
+
+	var got []int
+	for _, m := range trie.MatchString("she hers") {
+		got = append(got, m.Payload()+int(m.Pos())*10)
+	}
+	if want := []int{2, 43}; !slices.Equal(got, want) {
+		t.Errorf("Match payloads = %v, want %v", got, want)
+	}
+	input := []byte("ushers and his hers")
+	pms := trie.Match(input)
+	ms := trie.Trie().Match(input)
+	if len(pms) != len(ms) {
+		t.Fatalf("Match: %d matches, Trie.Match %d", len(pms), len(ms))
+	}
+	for i, m := range ms {
+		if !MatchEqual(pms[i].Match, m) || pms[i].buf != nil {
+			t.Errorf("match %d: got %v (pooled %v), want %v", i, pms[i].Match, pms[i].buf != nil, m)
+		}
+	}
+	trie.Trie().ReleaseMatches(ms)
+
+	got = got[:0]
+	trie.Walk([]byte("he she"), func(end, n uint32, payload int) bool {
+		got = append(got, payload)
+		return true
+	})
+	if want := []int{1, 2}; !slices.Equal(got, want) {
+		t.Errorf("Walk payloads = %v, want %v", got, want)
+	}
+
+	// A pattern added without a payload carries the zero value.
+	pb.Builder().AddString("plain")
+	if p := pb.Build().Payload(3); p != 0 {
+		t.Errorf("payload-less pattern: got %d, want 0", p)
+	}
+	if n := trie.Trie().NumPatterns(); n != 3 {
+		t.Errorf("NumPatterns = %d, want 3", n)
+	}
+}
@@ -0,0 +1,472 @@
+package ahocorasick
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+)
+
+// readerChunk is the read size of the io.Reader scans.
+const readerChunk = 32 << 10
+
+// walkEmit is the resumable walk underlying the streaming and
+// state-aware entry points: it starts in state s rather than the root,
+// calls fn with the end position (offset by base) and the emitting state
+// of every match, and returns the state after the last byte consumed
+// along with false if fn stopped the walk. It runs a plain loop over
+// next with the rootStop skip; its callers are bound by reads or
+// per-match work, not by the specialized scan loops Walk dispatches to.
+func (tr *Trie) walkEmit(input []byte, s, base uint32, fn func(end, state uint32) bool) (uint32, bool) {
+	for i := 0; i < len(input); i++ {
+		if s == rootState {
+			if i = tr.skipRootTable(input, i); i == len(input) {
+				break
+			}
+		}
+		v := tr.next(s, input[i])
+		s = v & stateMask
+		if v&outputFlag != 0 {
+			end := base + uint32(i)
+			if tr.dict[s] != 0 && !fn(end, s) {
+				return s, false
+			}
+			for u := tr.dictLink[s]; u != nilState; u = tr.dictLink[u] {
+				if !fn(end, u) {
+					return s, false
+				}
+			}
+		}
+	}
+	return s, true
+}
+
+// walkState is walkEmit reporting matches as a WalkFn does.
+func (tr *Trie) walkState(input []byte, s, base uint32, fn WalkFn) (uint32, bool) {
+	return tr.walkEmit(input, s, base, func(end, u uint32) bool {
+		return fn(end, tr.dict[u], tr.pattern[u])
+	})
+}
+
+// walkMatches is walkEmit from the root honoring the matching settings
+// Walk does: it scans input white space collapsed for
+// SetCollapseWhitespace, drops matches that are not whole words for
+// SetWholeWord and end-anchored ones short of the end of input, and
+// calls fn with the range input[start:end] each match covers and its
+// emitting state. It serves the entry points that need states.
+func (tr *Trie) walkMatches(input []byte, fn func(start, end, state uint32) bool) {
+	scan, orig := input, []uint32(nil)
+	if tr.collapseSpace {
+		scan, orig = collapseInput(input)
+	}
+	tr.walkEmit(scan, rootState, 0, func(end, u uint32) bool {
+		if tr.anchored(u) && int(end)+1 != len(scan) {
+			return true
+		}
+		start, stop := end+1-tr.dict[u], end+1
+		if orig != nil {
+			start, stop = orig[start], orig[stop]
+		}
+		if !tr.keep(input, start, stop) {
+			return true
+		}
+		return fn(start, stop, u)
+	})
+}
+
+// WalkAt continues a walk over a larger logical stream of which input is
+// the part starting at byte baseOffset: it starts in state start, the
+// value a previous WalkAt over the preceding bytes returned (0 to start
+// at the root), calls fn as Walk does but with end positions offset by
+// baseOffset, and returns the state after input. Matches spanning slice
+// boundaries are found, and it stops early when fn returns false. State
+// values are opaque and belong to this Trie. Feeding consecutive slices
+// with their offsets reports exactly what one Walk over their
+// concatenation would.
+//
+// WalkAt panics on a Trie built with SetWholeWord,
+// SetCollapseWhitespace, or AddPatternEndAnchored: those settings judge
+// a match by the bytes around it, which the state does not carry. Use a
+// Matcher, which keeps them.
+func (tr *Trie) WalkAt(input []byte, baseOffset uint32, start uint32, fn WalkFn) uint32 {
+	if tr.wholeWord || tr.collapseSpace || tr.endAnchored != nil {
+		panic("ahocorasick: WalkAt on a whole-word, white space collapsing, or end-anchored trie")
+	}
+	if start == nilState {
+		start = rootState
+	}
+	s, _ := tr.walkState(input, start, baseOffset, fn)
+	return s
+}
+
+// MatchPath returns the states the automaton passes through on
+// input[:end+1]: element i is the state after input[i], so the last is
+// the state a match ending at end is reported from (or emits through
+// its output links). It re-walks input from the start and is meant for
+// debugging, not for matching. Input is taken as is, without white
+// space collapsing. It returns nil when end is not an index of input.
+func (tr *Trie) MatchPath(input []byte, end uint32) []uint32 {
+	if uint64(end) >= uint64(len(input)) {
+		return nil
+	}
+	path := make([]uint32, end+1)
+	s := rootState
+	for i, c := range input[:end+1] {
+		s = tr.next(s, c) & stateMask
+		path[i] = s
+	}
+	return path
+}
+
+// WalkAction tells WalkControl how to go on after a match.
+type WalkAction int
+
+const (
+	// WalkContinue goes on with the walk.
+	WalkContinue WalkAction = iota
+	// WalkStop ends the walk.
+	WalkStop
+	// WalkReset returns the automaton to the root and goes on from the
+	// byte after the match, as if the input began there: no match
+	// starting at or before the match's last byte is reported, and
+	// neither are the rest of the matches ending at that byte.
+	WalkReset
+)
+
+// WalkExclusive is Walk reporting each match as the half-open range
+// [start, end) of input it covers, in Go slice terms, so input[start:end]
+// is the matched bytes, instead of by the index of its last byte and
+// its length. Matches come in Walk's order; returning false stops.
+func (tr *Trie) WalkExclusive(input []byte, fn func(start, end, pattern uint32) bool) {
+	tr.Walk(input, func(last, n, pattern uint32) bool {
+		return fn(last+1-n, last+1, pattern)
+	})
+}
+
+// WalkControl is Walk with a callback that can also reset the automaton
+// (see WalkReset), clearing whatever partial matches it was tracking
+// without ending the walk. Log scanners can use it to resynchronize
+// after garbage, bounding how far one bad record reaches. The Trie's
+// matching settings are honored as by Walk.
+func (tr *Trie) WalkControl(input []byte, fn func(end, n, pattern uint32) WalkAction) {
+	reset := false
+	next := 0 // where the walk resumes after a reset
+	scan, orig := input, []uint32(nil)
+	if tr.collapseSpace {
+		scan, orig = collapseInput(input)
+	}
+	var emit WalkFn = func(end, n, pattern uint32) bool {
+		switch fn(end, n, pattern) {
+		case WalkStop:
+			return false
+		case WalkReset:
+			reset, next = true, int(end)+1
+			return false
+		}
+		return true
+	}
+	if tr.wholeWord {
+		emit = wordFilter(input, emit)
+	}
+	if orig != nil {
+		emit = uncollapse(orig, emit)
+	}
+	if tr.endAnchored != nil {
+		emit = tr.anchorFilter(scan, emit)
+	}
+	for pos := 0; pos < len(scan); pos = next {
+		reset = false
+		if _, ok := tr.walkState(scan[pos:], rootState, uint32(pos), emit); ok || !reset {
+			return
+		}
+		if orig != nil {
+			// Resume at the first collapsed byte after the match.
+			next, _ = slices.BinarySearch(orig, uint32(next))
+		}
+	}
+}
+
+// readWalk streams r through the automaton, calling fn for every match
+// with absolute positions. window holds the most recent input and starts
+// at absolute offset winBase; it always includes every byte of the match
+// being reported, since the last maxLen-1 bytes of each read are carried
+// into the next window. window is valid only during the call.
+//
+// For whole-word tries and tries with end-anchored patterns, the matches
+// ending at the last byte read are held back until the byte after them
+// arrives, which rules out the anchored ones, or the stream ends. The
+// carried tail then keeps maxLen bytes, so it holds a held-back match
+// whole and, for whole-word tries, the byte before the longest match.
+//
+// A white-space-collapsing match can take in a run of any length, which
+// no bounded window holds, so those tries read all of r and Walk it.
+func (tr *Trie) readWalk(r io.Reader, fn func(window []byte, winBase, end, n, pattern uint32) bool) error {
+	if tr.collapseSpace {
+		data, err := io.ReadAll(r)
+		tr.Walk(data, func(end, n, pattern uint32) bool {
+			return fn(data, 0, end, n, pattern)
+		})
+		return err
+	}
+	hold := tr.wholeWord || tr.endAnchored != nil
+	keep := max(int(tr.maxLen)-1, 0)
+	if hold {
+		keep = int(tr.maxLen)
+	}
+	buf := make([]byte, keep+readerChunk)
+	s := rootState
+	var base uint32
+	held := 0
+	type heldMatch struct {
+		end, n, pattern uint32
+		anchored        bool
+	}
+	var pending []heldMatch
+	for {
+		n, err := r.Read(buf[held:])
+		if n > 0 {
+			window := buf[:held+n]
+			for _, p := range pending {
+				if p.anchored || tr.wholeWord && isWordByte(window[held]) {
+					continue
+				}
+				if !fn(window, base, p.end, p.n, p.pattern) {
+					return nil
+				}
+			}
+			pending = pending[:0]
+			var cont bool
+			s, cont = tr.walkEmit(window[held:], s, base+uint32(held), func(end, u uint32) bool {
+				ln, pattern := tr.dict[u], tr.pattern[u]
+				if start := end + 1 - ln; tr.wholeWord && start > 0 && isWordByte(window[start-1-base]) {
+					return true
+				}
+				if hold {
+					if next := int(end + 1 - base); next == len(window) {
+						pending = append(pending, heldMatch{end, ln, pattern, tr.anchored(u)})
+						return true
+					} else if tr.anchored(u) || tr.wholeWord && isWordByte(window[next]) {
+						return true
+					}
+				}
+				return fn(window, base, end, ln, pattern)
+			})
+			if !cont {
+				return nil
+			}
+			t := min(keep, len(window))
+			copy(buf, window[len(window)-t:])
+			base += uint32(len(window) - t)
+			held = t
+		}
+		if err == io.EOF {
+			for _, p := range pending {
+				if !fn(buf[:held], base, p.end, p.n, p.pattern) {
+					break
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// MatchReader runs Walk over everything read from r, calling fn on each
+// match with end positions counted from the first byte read, exactly as
+// Walk reports them for the same bytes in one slice. Matches spanning
+// read boundaries are found. The scan stops early, returning nil, when fn
+// returns false; otherwise it reads until io.EOF and returns any other
+// read error. Positions are uint32, so streams beyond 4 GiB wrap. A Trie
+// that collapses white space (see TrieBuilder.SetCollapseWhitespace)
+// reads the whole stream into memory before matching.
+func (tr *Trie) MatchReader(r io.Reader, fn WalkFn) error {
+	return tr.readWalk(r, func(_ []byte, _, end, n, pattern uint32) bool {
+		return fn(end, n, pattern)
+	})
+}
+
+// MatchReaderAll is Match over everything read from r, for input that
+// fits in memory but arrives as a stream. It returns the same matches, in
+// the same order, as Match on the concatenated input, along with any read
+// error other than io.EOF (and the matches found before it).
+//
+// The read buffers are reused as the stream advances, so each Match owns
+// a copy of its matched bytes. The result does not come from the Trie's
+// pool; ReleaseMatches on it is a no-op.
+func (tr *Trie) MatchReaderAll(r io.Reader) ([]*Match, error) {
+	var arena []Match
+	var lens []uint32
+	var slab []byte // every match's bytes, back to back
+	err := tr.readWalk(r, func(window []byte, winBase, end, n, pattern uint32) bool {
+		start := end - n + 1
+		arena = append(arena, Match{pos: start, pattern: pattern, buf: tr.textLink})
+		lens = append(lens, n)
+		slab = append(slab, window[start-winBase:end-winBase+1]...)
+		return true
+	})
+	if len(arena) == 0 {
+		return nil, err
+	}
+	// Slice the match bytes only now: the slab may have moved while it
+	// grew.
+	matches := make([]*Match, len(arena))
+	off := uint32(0)
+	for i := range arena {
+		arena[i].match = slab[off : off+lens[i] : off+lens[i]]
+		off += lens[i]
+		matches[i] = &arena[i]
+	}
+	return matches, err
+}
+
+// MatchLines runs Match on each line read from r and calls fn for every
+// line with at least one match, passing the 1-based line number, the
+// line without its terminating "\n" or "\r\n", and the matches, whose
+// positions are relative to the line. Lines may be of any length. line
+// and matches are reused once fn returns; copy anything needed later and
+// do not call ReleaseMatches on them. Processing stops early, returning
+// nil, when fn returns false; otherwise it reads until io.EOF and
+// returns any other read error.
+func (tr *Trie) MatchLines(r io.Reader, fn func(lineNum int, line []byte, matches []*Match) bool) error {
+	br := bufio.NewReaderSize(r, readerChunk)
+	var long []byte // a line that outgrew br's buffer
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			long = append(long[:0], line...)
+			for errors.Is(err, bufio.ErrBufferFull) {
+				line, err = br.ReadSlice('\n')
+				long = append(long, line...)
+			}
+			line = long
+		}
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if n := len(line); n > 0 && line[n-1] == '\n' {
+			line = line[:n-1]
+			if n := len(line); n > 0 && line[n-1] == '\r' {
+				line = line[:n-1]
+			}
+		}
+		if ms := tr.Match(line); len(ms) != 0 {
+			cont := fn(lineNum, line, ms)
+			tr.ReleaseMatches(ms)
+			if !cont {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// PosMatch is a Match annotated with the line and column it starts at.
+type PosMatch struct {
+	*Match
+	line, col int
+}
+
+// Line returns the 1-based line the match starts on.
+func (m PosMatch) Line() int {
+	return m.line
+}
+
+// Col returns the 1-based column the match starts at, in bytes: a tab
+// or each byte of a multi-byte UTF-8 character counts as one column.
+func (m PosMatch) Col() int {
+	return m.col
+}
+
+// MatchWithPositions is Match annotating each match with its line and
+// column, for reporting matches in source code or configuration. Lines
+// end at "\n", so a "\r\n" file numbers its lines like an "\n" one, with
+// the "\r" the last byte of its line; a lone "\r" does not end a line.
+// The newline offsets are found once per call, and each match costs a
+// binary search among them. Each PosMatch wraps a Match allocated for
+// this call alongside it, so the result outlives later calls and needs
+// no ReleaseMatches.
+func (tr *Trie) MatchWithPositions(input []byte) []*PosMatch {
+	var spans []span
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		spans = append(spans, span{start: end + 1 - n, end: end + 1, pattern: pattern})
+		return true
+	})
+	if len(spans) == 0 {
+		return nil
+	}
+	var newlines []uint32
+	for i := 0; ; {
+		j := bytes.IndexByte(input[i:], '\n')
+		if j < 0 {
+			break
+		}
+		newlines = append(newlines, uint32(i+j))
+		i += j + 1
+	}
+	arena := make([]Match, len(spans))
+	pms := make([]PosMatch, len(spans))
+	out := make([]*PosMatch, len(spans))
+	for i, s := range spans {
+		arena[i] = Match{pos: s.start, pattern: s.pattern, match: input[s.start:s.end], buf: tr.textLink}
+		// The newlines before the match give its line; the last of them
+		// ends the line before.
+		k, _ := slices.BinarySearch(newlines, s.start)
+		lineStart := uint32(0)
+		if k > 0 {
+			lineStart = newlines[k-1] + 1
+		}
+		pms[i] = PosMatch{Match: &arena[i], line: k + 1, col: int(s.start-lineStart) + 1}
+		out[i] = &pms[i]
+	}
+	return out
+}
+
+// MatchRing walks the length bytes of a ring buffer starting at index
+// head, wrapping from the end of ring to its start, calling fn as Walk
+// does with end positions counted from head: the logical offset of the
+// bytes, not their index in ring. Matches across the wrap point are
+// found without copying the buffer, by carrying the automaton state
+// from one side to the other with WalkAt. Tries with whole-word,
+// white space collapsing, or end-anchored patterns, whose filters need
+// the input in one piece, walk a linearized copy instead. It panics
+// unless 0 <= length <= len(ring) and, for a non-empty walk,
+// 0 <= head < len(ring).
+func (tr *Trie) MatchRing(ring []byte, head, length int, fn WalkFn) {
+	if length < 0 || length > len(ring) {
+		panic("ahocorasick: MatchRing length out of range")
+	}
+	if length == 0 {
+		return
+	}
+	if head < 0 || head >= len(ring) {
+		panic("ahocorasick: MatchRing head out of range")
+	}
+	first := ring[head:min(head+length, len(ring))]
+	second := ring[:length-len(first)]
+	if tr.wholeWord || tr.collapseSpace || tr.endAnchored != nil {
+		tr.Walk(append(first[:len(first):len(first)], second...), fn)
+		return
+	}
+	stopped := false
+	s := tr.WalkAt(first, 0, rootState, func(end, n, pattern uint32) bool {
+		if !fn(end, n, pattern) {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	if !stopped && len(second) > 0 {
+		tr.WalkAt(second, uint32(len(first)), s, fn)
+	}
+}
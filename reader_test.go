@@ -0,0 +1,331 @@
+package ahocorasick
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// chunkReader returns at most n bytes per Read.
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+	return c.r.Read(p)
+}
+
+func TestMatchReaderAll(t *testing.T) {
+	ibsen, err := os.ReadFile("./test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTrieBuilder().AddStrings([]string{"Hedvig", "Gina", "Hjalmar Ekdal", "a", "en"}).Build()
+	input := string(ibsen[:50000])
+	want := triplesFromMatches(tr.Match([]byte(input)))
+
+	readers := map[string]func() io.Reader{
+		"whole":   func() io.Reader { return strings.NewReader(input) },
+		"onebyte": func() io.Reader { return iotest.OneByteReader(strings.NewReader(input)) },
+		"half":    func() io.Reader { return iotest.HalfReader(strings.NewReader(input)) },
+		"chunk7":  func() io.Reader { return &chunkReader{strings.NewReader(input), 7} },
+		"dataerr": func() io.Reader { return iotest.DataErrReader(strings.NewReader(input)) },
+	}
+	for name, newReader := range readers {
+		got, err := tr.MatchReaderAll(newReader())
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if i := diffTriples(triplesFromMatches(got), want); i != -1 {
+			t.Errorf("%s: mismatch at %d of %d matches", name, i, len(want))
+		}
+		for _, m := range got {
+			if string(m.Match()) != input[m.Pos():int(m.Pos())+len(m.Match())] {
+				t.Fatalf("%s: match %v bytes differ from input", name, m)
+			}
+		}
+	}
+}
+
+func TestMatchReader(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build()
+	input := "ushers and shepherds"
+	want := tr.triplesFromWalk([]byte(input))
+
+	var got [][3]uint32
+	err := tr.MatchReader(&chunkReader{strings.NewReader(input), 2}, func(end, n, pattern uint32) bool {
+		got = append(got, [3]uint32{end - n + 1, pattern, n})
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := diffTriples(got, want); i != -1 {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	calls := 0
+	err = tr.MatchReader(strings.NewReader(input), func(end, n, pattern uint32) bool {
+		calls++
+		return false
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("expected one call and no error after stopping, got %d calls, %v", calls, err)
+	}
+
+	boom := errors.New("boom")
+	r := io.MultiReader(strings.NewReader("ushe"), iotest.ErrReader(boom))
+	ms, err := tr.MatchReaderAll(r)
+	if !errors.Is(err, boom) {
+		t.Errorf("expected the read error, got %v", err)
+	}
+	if len(ms) != 2 {
+		t.Errorf("expected the 2 matches read before the error, got %v", ms)
+	}
+}
+
+func TestMatchLines(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"ERROR", "WARN", "disk"}).Build()
+	long := strings.Repeat("x", 3*readerChunk) + "ERROR"
+	input := "INFO start\r\nWARN disk low\n\nERROR: disk full, ERROR\n" + long + "\nINFO done\nWARN"
+
+	type hit struct {
+		line    int
+		text    string
+		matches []string
+	}
+	want := []hit{
+		{2, "WARN disk low", []string{"{0 1 \"WARN\"}", "{5 2 \"disk\"}"}},
+		{4, "ERROR: disk full, ERROR", []string{"{0 0 \"ERROR\"}", "{7 2 \"disk\"}", "{18 0 \"ERROR\"}"}},
+		{5, long, []string{fmt.Sprintf("{%d 0 \"ERROR\"}", 3*readerChunk)}},
+		{7, "WARN", []string{"{0 1 \"WARN\"}"}},
+	}
+	for _, n := range []int{1, 5, 1 << 20} {
+		var got []hit
+		err := tr.MatchLines(&chunkReader{strings.NewReader(input), n}, func(lineNum int, line []byte, matches []*Match) bool {
+			h := hit{line: lineNum, text: string(line)}
+			for _, m := range matches {
+				h.matches = append(h.matches, m.String())
+			}
+			got = append(got, h)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("chunk %d: expected %v, got %v", n, want, got)
+		}
+	}
+
+	var lines []int
+	tr.MatchLines(strings.NewReader(input), func(lineNum int, _ []byte, _ []*Match) bool {
+		lines = append(lines, lineNum)
+		return lineNum < 4
+	})
+	if !reflect.DeepEqual(lines, []int{2, 4}) {
+		t.Errorf("stop: expected lines [2 4], got %v", lines)
+	}
+}
+
+func TestWalkAt(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen, err := os.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := ibsen[:20000]
+	tr := NewTrieBuilder().AddStrings(patterns[:10000]).Build()
+	collect := func(out *[][3]uint32) WalkFn {
+		return func(end, n, pattern uint32) bool {
+			*out = append(*out, [3]uint32{end, n, pattern})
+			return true
+		}
+	}
+	var want [][3]uint32
+	tr.Walk(input, collect(&want))
+
+	for _, split := range []int{0, 1, 7, 9999, 19999, 20000} {
+		var got [][3]uint32
+		s := tr.WalkAt(input[:split], 0, 0, collect(&got))
+		tr.WalkAt(input[split:], uint32(split), s, collect(&got))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("split at %d: %d matches, want %d", split, len(got), len(want))
+		}
+	}
+
+	// The state cannot carry what whole words, collapsed white space,
+	// and end anchors depend on, so WalkAt refuses those tries.
+	for name, tb := range map[string]*TrieBuilder{
+		"whole word":   NewTrieBuilder().AddString("cat").SetWholeWord(true),
+		"collapse":     NewTrieBuilder().AddString("a b").SetCollapseWhitespace(true),
+		"end anchored": NewTrieBuilder().AddPatternEndAnchored([]byte("cat")),
+	} {
+		tr := tb.Build()
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: WalkAt did not panic", name)
+				}
+			}()
+			tr.WalkAt([]byte("a cat"), 0, 0, collect(new([][3]uint32)))
+		}()
+	}
+}
+
+func TestWalkExclusive(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build()
+	input := []byte("ushers")
+	var walked []uint32
+	trie.Walk(input, func(end, n, pattern uint32) bool {
+		walked = append(walked, end, n, pattern)
+		return true
+	})
+	i := 0
+	trie.WalkExclusive(input, func(start, end, pattern uint32) bool {
+		last, n := walked[i], walked[i+1]
+		if end-start != n || end != last+1 || pattern != walked[i+2] {
+			t.Errorf("[%d, %d) pattern %d; Walk reported end %d, length %d", start, end, pattern, last, n)
+		}
+		i += 3
+		return true
+	})
+	if i != len(walked) {
+		t.Errorf("WalkExclusive reported %d matches, Walk %d", i/3, len(walked)/3)
+	}
+}
+
+func TestWalkControl(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"abcd", "b", "cd"}).Build()
+	input := []byte("abcd abcd")
+	run := func(action func(end, n, pattern uint32) WalkAction) []uint32 {
+		var got []uint32
+		trie.WalkControl(input, func(end, n, pattern uint32) WalkAction {
+			got = append(got, end, pattern)
+			return action(end, n, pattern)
+		})
+		return got
+	}
+
+	all := run(func(end, n, pattern uint32) WalkAction { return WalkContinue })
+	if want := []uint32{1, 1, 3, 0, 3, 2, 6, 1, 8, 0, 8, 2}; !slices.Equal(all, want) {
+		t.Errorf("WalkContinue: got %v, want %v", all, want)
+	}
+
+	// Resetting on the first "b" drops the "abcd" in progress there but
+	// not the later one.
+	got := run(func(end, n, pattern uint32) WalkAction {
+		if end == 1 {
+			return WalkReset
+		}
+		return WalkContinue
+	})
+	if want := []uint32{1, 1, 3, 2, 6, 1, 8, 0, 8, 2}; !slices.Equal(got, want) {
+		t.Errorf("WalkReset: got %v, want %v", got, want)
+	}
+
+	got = run(func(end, n, pattern uint32) WalkAction { return WalkStop })
+	if want := []uint32{1, 1}; !slices.Equal(got, want) {
+		t.Errorf("WalkStop: got %v, want %v", got, want)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build()
+	state := func(prefix string) uint32 {
+		s, ok := trie.Descend([]byte(prefix))
+		if !ok {
+			t.Fatalf("no state for %q", prefix)
+		}
+		return s
+	}
+	want := []uint32{state(""), state("s"), state("sh"), state("she"), state("her"), state("hers")}
+	if got := trie.MatchPath([]byte("ushers"), 5); !slices.Equal(got, want) {
+		t.Errorf("MatchPath = %v, want %v", got, want)
+	}
+	if got := trie.MatchPath([]byte("ushers"), 3); !slices.Equal(got, want[:4]) {
+		t.Errorf("MatchPath to 3 = %v, want %v", got, want[:4])
+	}
+	if got := trie.MatchPath([]byte("ushers"), 6); got != nil {
+		t.Errorf("MatchPath past the end = %v, want nil", got)
+	}
+}
+
+func TestMatchRing(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build()
+	// The logical sequence "ushers..." starts at index 6 and wraps.
+	ring := []byte("ers...ush")
+	collect := func(tr *Trie, head, length int) []uint32 {
+		var got []uint32
+		tr.MatchRing(ring, head, length, func(end, n, pattern uint32) bool {
+			got = append(got, end, n, pattern)
+			return true
+		})
+		return got
+	}
+	if got, want := collect(trie, 6, 9), []uint32{3, 3, 1, 3, 2, 0, 5, 4, 2}; !slices.Equal(got, want) {
+		t.Errorf("across the seam: got %v, want %v", got, want)
+	}
+	// Stopping on the first side leaves the second unwalked.
+	n := 0
+	trie.MatchRing(ring, 6, 9, func(end, length, pattern uint32) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("after a stop: %d calls", n)
+	}
+	// Without wrapping, and empty.
+	if got, want := collect(trie, 0, 3), []uint32(nil); !slices.Equal(got, want) {
+		t.Errorf("no wrap: got %v, want %v", got, want)
+	}
+	if got := collect(trie, 3, 0); got != nil {
+		t.Errorf("empty: got %v", got)
+	}
+
+	// Whole-word tries judge the seam like any other byte.
+	words := NewTrieBuilder().AddStrings([]string{"she"}).SetWholeWord(true).Build()
+	ring = []byte("he xs")
+	if got, want := collect(words, 4, 5), []uint32{2, 3, 0}; !slices.Equal(got, want) {
+		t.Errorf("whole word: got %v, want %v", got, want)
+	}
+	if got := collect(words, 3, 5); got != nil {
+		t.Errorf("whole word, preceded by a letter: got %v", got)
+	}
+}
+
+func TestMatchWithPositions(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"key", "secret"}).Build()
+	input := []byte("key = 1\r\n\tsecret = key\n")
+	var got []string
+	for _, m := range trie.MatchWithPositions(input) {
+		got = append(got, fmt.Sprintf("%s@%d:%d", m.MatchString(), m.Line(), m.Col()))
+	}
+	// The tab is one column, and the CR stays on the first line.
+	if want := []string{"key@1:1", "secret@2:2", "key@2:11"}; !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// A match right after a newline starts its line.
+	ms := trie.MatchWithPositions([]byte("\n\nkey"))
+	if len(ms) != 1 || ms[0].Line() != 3 || ms[0].Col() != 1 || ms[0].Pos() != 2 {
+		t.Errorf("expected key at 3:1, got %v", ms)
+	}
+	if ms := trie.MatchWithPositions([]byte("none\n")); ms != nil {
+		t.Errorf("expected no matches, got %v", ms)
+	}
+}
@@ -0,0 +1,47 @@
+package ahocorasick
+
+// MatchReverse scans input from its last byte to its first with a Trie
+// built by TrieBuilder.SetReverse (or Compile with WithReverse), finding
+// the patterns as they were added. Positions are in the input's own
+// orientation: each Match's Pos is where the pattern starts in input, and
+// its bytes read forwards.
+//
+// Overlaps are handled as in Match, mirrored: every occurrence is
+// reported, including ones overlapping or nested in others. Matches come
+// in scan order, by start position descending; among matches sharing a
+// start, longer patterns come first. The result may be released with
+// ReleaseMatches.
+func (tr *Trie) MatchReverse(input []byte) []*Match {
+	scan, orig := input, []uint32(nil)
+	if tr.collapseSpace {
+		scan, orig = collapseInput(input)
+	}
+	var spans []span
+	emit := func(i int, u uint32) {
+		start, end := uint32(i), uint32(i)+tr.dict[u]
+		if tr.anchored(u) && int(end) != len(scan) {
+			return
+		}
+		if orig != nil {
+			start, end = orig[start], orig[end]
+		}
+		if tr.keep(input, start, end) {
+			spans = append(spans, span{start: start, end: end, pattern: tr.pattern[u]})
+		}
+	}
+	s := rootState
+	for i := len(scan) - 1; i >= 0; i-- {
+		v := tr.next(s, scan[i])
+		s = v & stateMask
+		if v&outputFlag == 0 {
+			continue
+		}
+		if tr.dict[s] != 0 {
+			emit(i, s)
+		}
+		for u := tr.dictLink[s]; u != nilState; u = tr.dictLink[u] {
+			emit(i, u)
+		}
+	}
+	return tr.pooledMatches(input, spans)
+}
@@ -0,0 +1,37 @@
+package ahocorasick
+
+import "testing"
+
+func TestMatchReverse(t *testing.T) {
+	tr := NewTrieBuilder().
+		SetReverse(true).
+		AddStrings([]string{".gz", ".tar.gz", "a.b", "b.c"}).
+		Build()
+
+	// Every occurrence is reported, nested and overlapping ones too, by
+	// start descending and longest first.
+	checkMatches(t, "extensions", tr.MatchReverse([]byte("x.tar.gz a.b.c")), []*Match{
+		newMatchString(11, 3, "b.c"),
+		newMatchString(9, 2, "a.b"),
+		newMatchString(5, 0, ".gz"),
+		newMatchString(1, 1, ".tar.gz"),
+	})
+
+	// Forward matching on the same trie sees the reversed patterns.
+	checkMatches(t, "forward", tr.MatchString("zg.rat."), []*Match{
+		newMatchString(0, 0, "zg."),
+		newMatchString(0, 1, "zg.rat."),
+	})
+
+	tr, err := Compile([][]byte{[]byte("example.com"), []byte(".com")}, WithReverse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMatches(t, "domains", tr.MatchReverse([]byte("www.example.com")), []*Match{
+		newMatchString(11, 1, ".com"),
+		newMatchString(4, 0, "example.com"),
+	})
+	if ms := tr.MatchReverse(nil); ms != nil {
+		t.Errorf("empty input: expected no matches, got %v", ms)
+	}
+}
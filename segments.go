@@ -0,0 +1,175 @@
+package ahocorasick
+
+import (
+	"cmp"
+	"slices"
+)
+
+// span is one match as a half-open byte range [start, end) of the input
+// plus its pattern id.
+type span struct {
+	start, end, pattern uint32
+}
+
+// pooledMatches materializes spans, in order, as a result backed by a
+// pooled buffer, so callers can release it with ReleaseMatches exactly
+// like Match's. It returns nil for no spans.
+func (tr *Trie) pooledMatches(input []byte, spans []span) []*Match {
+	if len(spans) == 0 {
+		return nil
+	}
+	buf := tr.bufPool.Get().(*matchBuf)
+	buf.reset()
+	for _, s := range spans {
+		buf.raw = append(buf.raw, uint64(s.end-1), uint64(s.pattern)<<32|uint64(s.end-s.start))
+	}
+	buf.materialize(input)
+	buf.ptrs[0].buf = buf
+	return buf.ptrs
+}
+
+// leftmostLongest returns the non-overlapping matches of input in input
+// order: scanning left to right, the earliest-starting match wins, and
+// among matches starting at the same byte the longest. A chosen match
+// consumes its bytes, so later matches must start at or after its end.
+// It collects every match with Walk and filters afterwards; callers on
+// hot paths should not assume better than O(matches log matches).
+func (tr *Trie) leftmostLongest(input []byte) []span {
+	var all []span
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		all = append(all, span{start: end + 1 - n, end: end + 1, pattern: pattern})
+		return true
+	})
+	slices.SortFunc(all, func(a, b span) int {
+		if c := cmp.Compare(a.start, b.start); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.end, a.end)
+	})
+	out := all[:0]
+	next := uint32(0)
+	for _, s := range all {
+		if s.start >= next {
+			out = append(out, s)
+			next = s.end
+		}
+	}
+	return out
+}
+
+// SegmentFn is called by WalkSegments for each segment of the input, in
+// order. Segments are half-open byte ranges [start, end). For a match
+// segment pattern is the matched pattern id; for a gap it is 0 and
+// carries no meaning. Returning false stops the walk.
+type SegmentFn func(isMatch bool, start, end, pattern uint32) bool
+
+// WalkSegments partitions input into the non-overlapping matches chosen
+// leftmost-longest (the earliest start wins, then the longest pattern at
+// that start) and the unmatched gaps between them, calling fn for each
+// segment in input order. Concatenating every segment's bytes rebuilds
+// the input exactly.
+//
+// Segments strictly alternate, beginning and ending with a gap: a gap
+// precedes every match and one more follows the last, so k matches
+// yield k+1 gaps. Gaps may be empty (start == end) — before a match at
+// offset 0, between adjacent matches, and after a match ending at
+// len(input) — and are still reported so callers can rely on the
+// alternation. An input with no matches is a single gap covering all of
+// it, including the empty input.
+func (tr *Trie) WalkSegments(input []byte, fn SegmentFn) {
+	pos := uint32(0)
+	for _, s := range tr.leftmostLongest(input) {
+		if !fn(false, pos, s.start, 0) || !fn(true, s.start, s.end, s.pattern) {
+			return
+		}
+		pos = s.end
+	}
+	fn(false, pos, uint32(len(input)), 0)
+}
+
+// Highlight returns a copy of input with every match WalkSegments would
+// report wrapped in the prefix and suffix wrap returns for it, such as
+// ANSI color codes or <mark> tags. Matches do not overlap: where they
+// would, the earliest-starting wins, then the longest. Adjacent matches
+// are wrapped separately. The Match given to wrap is valid only during
+// the call.
+func (tr *Trie) Highlight(input []byte, wrap func(m *Match) (prefix, suffix []byte)) []byte {
+	spans := tr.leftmostLongest(input)
+	out := make([]byte, 0, len(input))
+	pos := uint32(0)
+	var m Match
+	for _, s := range spans {
+		m = Match{pos: s.start, pattern: s.pattern, match: input[s.start:s.end], buf: tr.textLink}
+		prefix, suffix := wrap(&m)
+		out = append(out, input[pos:s.start]...)
+		out = append(out, prefix...)
+		out = append(out, m.match...)
+		out = append(out, suffix...)
+		pos = s.end
+	}
+	return append(out, input[pos:]...)
+}
+
+// MatchNode is a match in the tree MatchTree builds, with the matches
+// nested inside it as children.
+type MatchNode struct {
+	*Match
+	children []*MatchNode
+}
+
+// Children returns the matches directly inside the node's, in order of
+// start, then longest first.
+func (n *MatchNode) Children() []*MatchNode {
+	return n.children
+}
+
+// MatchTree arranges every match in input into a forest by nesting, for
+// structured highlights: a match's children are the matches strictly
+// inside its span, meaning within it and shorter, that are not inside a
+// child already. Matches that partly overlap, or have equal spans, are
+// siblings. A match inside two partly overlapping matches is the child
+// of the later-starting one. Roots and children are ordered by start,
+// then longest first, then by pattern id. The nodes and their Matches
+// live in two arrays allocated per call, which the tree keeps alive as
+// a whole; there is no pooled buffer to release.
+func (tr *Trie) MatchTree(input []byte) []*MatchNode {
+	var spans []span
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		spans = append(spans, span{start: end + 1 - n, end: end + 1, pattern: pattern})
+		return true
+	})
+	slices.SortFunc(spans, func(a, b span) int {
+		if c := cmp.Compare(a.start, b.start); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.end, a.end); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.pattern, b.pattern)
+	})
+	arena := make([]Match, len(spans))
+	nodes := make([]MatchNode, len(spans))
+	var roots, stack []*MatchNode
+	for i, s := range spans {
+		arena[i] = Match{pos: s.start, pattern: s.pattern, match: input[s.start:s.end], buf: tr.textLink}
+		node := &nodes[i]
+		node.Match = &arena[i]
+		// Sorted by start, every open span starts at or before this one;
+		// it contains this one if it ends at or after it and is longer.
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if top.End() >= s.end && top.Len() > s.end-s.start {
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, node)
+		} else {
+			top := stack[len(stack)-1]
+			top.children = append(top.children, node)
+		}
+		stack = append(stack, node)
+	}
+	return roots
+}
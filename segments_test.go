@@ -0,0 +1,142 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type segment struct {
+	isMatch             bool
+	start, end, pattern uint32
+}
+
+func collectSegments(tr *Trie, input []byte) []segment {
+	var segs []segment
+	tr.WalkSegments(input, func(isMatch bool, start, end, pattern uint32) bool {
+		segs = append(segs, segment{isMatch, start, end, pattern})
+		return true
+	})
+	return segs
+}
+
+func TestWalkSegments(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"X", "Y"}).Build()
+
+	got := collectSegments(tr, []byte("aXbY"))
+	want := []segment{
+		{false, 0, 1, 0},
+		{true, 1, 2, 0},
+		{false, 2, 3, 0},
+		{true, 3, 4, 1},
+		{false, 4, 4, 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d segments, got %v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("segment %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestWalkSegmentsBoundaries(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"he", "hers", "she", "X"}).Build()
+
+	tests := []struct {
+		input string
+		want  []segment
+	}{
+		{"", []segment{{false, 0, 0, 0}}},
+		{"abc", []segment{{false, 0, 3, 0}}},
+		// Adjacent matches are separated by an empty gap.
+		{"XX", []segment{{false, 0, 0, 0}, {true, 0, 1, 3}, {false, 1, 1, 0}, {true, 1, 2, 3}, {false, 2, 2, 0}}},
+		// "she" starts first and consumes the "he"; "hers" then
+		// overlaps the chosen match and is dropped.
+		{"ushers", []segment{{false, 0, 1, 0}, {true, 1, 4, 2}, {false, 4, 6, 0}}},
+		// Longest wins at a shared start.
+		{"hers", []segment{{false, 0, 0, 0}, {true, 0, 4, 1}, {false, 4, 4, 0}}},
+	}
+	for _, tt := range tests {
+		got := collectSegments(tr, []byte(tt.input))
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.input, tt.want, got)
+			continue
+		}
+		var rebuilt []byte
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q segment %d: expected %v, got %v", tt.input, i, tt.want[i], got[i])
+			}
+			rebuilt = append(rebuilt, tt.input[got[i].start:got[i].end]...)
+		}
+		if !bytes.Equal(rebuilt, []byte(tt.input)) {
+			t.Errorf("%q: segments rebuild %q", tt.input, rebuilt)
+		}
+	}
+}
+
+func TestWalkSegmentsStops(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"X"}).Build()
+	calls := 0
+	tr.WalkSegments([]byte("aXbXc"), func(isMatch bool, start, end, pattern uint32) bool {
+		calls++
+		return !isMatch
+	})
+	if calls != 2 {
+		t.Errorf("expected the walk to stop after the first match (2 calls), got %d", calls)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "hers", "is"}).Build()
+	brackets := func(m *Match) ([]byte, []byte) { return []byte("["), []byte("]") }
+	for input, want := range map[string]string{
+		"ushers":     "u[she]rs",
+		"he is hers": "[he] [is] [hers]",
+		"heis":       "[he][is]",
+		"no match":   "no match",
+		"":           "",
+	} {
+		if got := trie.Highlight([]byte(input), brackets); string(got) != want {
+			t.Errorf("Highlight(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	tags := func(m *Match) ([]byte, []byte) {
+		return []byte(`<mark data-id="` + string(rune('0'+m.Pattern())) + `">`), []byte("</mark>")
+	}
+	if got, want := trie.Highlight([]byte("hers"), tags), `<mark data-id="2">hers</mark>`; !bytes.Equal(got, []byte(want)) {
+		t.Errorf("tags: got %q, want %q", got, want)
+	}
+}
+
+func TestMatchTree(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"abcd", "ab", "cd", "bc", "b", "de", "x"}).Build()
+	var render func(nodes []*MatchNode) string
+	render = func(nodes []*MatchNode) string {
+		var sb strings.Builder
+		for i, n := range nodes {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprintf(&sb, "%s@%d", n.MatchString(), n.Pos())
+			if len(n.Children()) > 0 {
+				sb.WriteString("(" + render(n.Children()) + ")")
+			}
+		}
+		return sb.String()
+	}
+	// "ab", "bc", and "cd" nest in "abcd" but partly overlap each other,
+	// so they are siblings; "b" nests in the later-starting "bc"; "de"
+	// sticks out of "abcd".
+	got := render(trie.MatchTree([]byte("abcde x")))
+	if want := "abcd@0(ab@0 bc@1(b@1) cd@2) de@3 x@6"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if nodes := trie.MatchTree([]byte("zzz")); nodes != nil {
+		t.Errorf("no matches: got %v", nodes)
+	}
+}
@@ -0,0 +1,264 @@
+package ahocorasick
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// MatchByPriority resolves matches that start at the same position to a
+// single winner: the pattern with the highest priority (see
+// TrieBuilder.AddPatternWithPriority), then the longest, then the lowest
+// pattern id. Matches starting at different positions never compete,
+// even when they overlap. The result holds one match per start position
+// that has any, ordered by start, and may be released with
+// ReleaseMatches.
+func (tr *Trie) MatchByPriority(input []byte) []*Match {
+	type cand struct {
+		span
+		prio int
+	}
+	var cands []cand
+	tr.walkMatches(input, func(start, end, s uint32) bool {
+		c := cand{span: span{start: start, end: end, pattern: tr.pattern[s]}}
+		if tr.priority != nil {
+			c.prio = tr.priority[s]
+		}
+		cands = append(cands, c)
+		return true
+	})
+	slices.SortFunc(cands, func(a, b cand) int {
+		if c := cmp.Compare(a.start, b.start); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.prio, a.prio); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.end, a.end); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.pattern, b.pattern)
+	})
+	var spans []span
+	for i, c := range cands {
+		if i == 0 || c.start != cands[i-1].start {
+			spans = append(spans, c.span)
+		}
+	}
+	return tr.pooledMatches(input, spans)
+}
+
+// MatchTopKPerEnd is Match keeping at most k matches per end position,
+// the k longest, which bounds the output where many nested patterns end
+// together. Matches come in Match's order: by end, longest first. A k
+// below 1 yields no matches. The result may be released with
+// ReleaseMatches.
+func (tr *Trie) MatchTopKPerEnd(input []byte, k int) []*Match {
+	if k < 1 {
+		return nil
+	}
+	var spans []span
+	last, count := uint32(0), 0
+	tr.walkMatches(input, func(start, end, s uint32) bool {
+		// Output chains run longest first, so the first k per end win.
+		if end != last || len(spans) == 0 {
+			last, count = end, 0
+		}
+		if count < k {
+			spans = append(spans, span{start: start, end: end, pattern: tr.pattern[s]})
+			count++
+		}
+		return true
+	})
+	return tr.pooledMatches(input, spans)
+}
+
+// MatchByPattern is Match with its matches grouped by pattern id, each
+// group in Match's order. The Match values come from the Trie's pool, as
+// Match's do, while the map and group slices are allocated for the
+// caller. The groups share one pooled buffer: release them all at once
+// with ReleaseMatchesByPattern, never group by group, and not at all if
+// any Match is still in use.
+func (tr *Trie) MatchByPattern(input []byte) map[uint32][]*Match {
+	matches := tr.Match(input)
+	if len(matches) == 0 {
+		return nil
+	}
+	groups := make(map[uint32][]*Match)
+	for _, m := range matches {
+		groups[m.pattern] = append(groups[m.pattern], m)
+	}
+	return groups
+}
+
+// ReleaseMatchesByPattern returns the buffer behind a MatchByPattern
+// result to the Trie's pool, with the same rules as ReleaseMatches:
+// afterwards every group and Match in it is invalid.
+func (tr *Trie) ReleaseMatchesByPattern(groups map[uint32][]*Match) {
+	// The buffer is anchored to Match's first element, which heads its
+	// group; releasing the other groups is a no-op.
+	for _, g := range groups {
+		tr.ReleaseMatches(g)
+	}
+}
+
+// MatchUnique is Match keeping one match per (Pos, Pattern) key: of
+// matches with the same start and pattern id, only the first in Match's
+// order, the shortest, is kept. Plain patterns never repeat a key, since
+// one string is one pattern; keys repeat when distinct patterns share
+// an id (see TrieBuilder.AddPatternWithID) and one is a prefix of
+// another, as with "err" and "error" both mapped to one rule. Release
+// the result with ReleaseMatches.
+func (tr *Trie) MatchUnique(input []byte) []*Match {
+	var spans []span
+	var seen map[uint64]struct{}
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		start := end + 1 - n
+		key := uint64(start)<<32 | uint64(pattern)
+		if seen == nil {
+			seen = make(map[uint64]struct{})
+		}
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			spans = append(spans, span{start: start, end: end + 1, pattern: pattern})
+		}
+		return true
+	})
+	return tr.pooledMatches(input, spans)
+}
+
+// MatchWithCooldown is Match reporting a pattern again only once its
+// start is at least gap bytes away from the start of the last match of
+// that pattern reported, so a pattern repeating through the input raises
+// one alert per gap bytes rather than one per occurrence. Matches are
+// considered in Match's order, and patterns are told apart by id. Under
+// a shared id (see TrieBuilder.AddPatternWithID) a later match can start
+// before the last one reported; it is suppressed as well when it starts
+// fewer than gap bytes before it. A gap of 0 or 1 suppresses nothing.
+// Release the result with ReleaseMatches.
+func (tr *Trie) MatchWithCooldown(input []byte, gap uint32) []*Match {
+	var spans []span
+	last := make(map[uint32]uint32) // pattern id to last reported start
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		start := end + 1 - n
+		if prev, ok := last[pattern]; ok && uint64(start) < uint64(prev)+uint64(gap) && uint64(start)+uint64(gap) > uint64(prev) {
+			return true
+		}
+		last[pattern] = start
+		spans = append(spans, span{start: start, end: end + 1, pattern: pattern})
+		return true
+	})
+	return tr.pooledMatches(input, spans)
+}
+
+// MatchShortest returns non-overlapping matches chosen leftmost-shortest,
+// the mirror of WalkSegments' leftmost-longest, for greedy-minimal
+// lexers: scanning left to right, the earliest-starting match wins, and
+// among matches starting at the same byte the shortest; matches with the
+// same start and length are one state's, so ids never tie. A chosen
+// match consumes its bytes, so the next must start at or after its end.
+// Over "abc", {"a", "ab", "abc"} yields "a" alone: no pattern starts at
+// "bc". Like WalkSegments it filters a full Walk, costing
+// O(matches log matches). Release the result with ReleaseMatches.
+func (tr *Trie) MatchShortest(input []byte) []*Match {
+	var all []span
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		all = append(all, span{start: end + 1 - n, end: end + 1, pattern: pattern})
+		return true
+	})
+	slices.SortFunc(all, func(a, b span) int {
+		if c := cmp.Compare(a.start, b.start); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.end, b.end)
+	})
+	spans := all[:0]
+	next := uint32(0)
+	for _, s := range all {
+		if s.start >= next {
+			spans = append(spans, s)
+			next = s.end
+		}
+	}
+	return tr.pooledMatches(input, spans)
+}
+
+// MatchReverseOrder is Match ordered right to left: by start position
+// descending, and among matches sharing a start, longer first. Applying
+// edits in this order, such as replacing each match in place, leaves the
+// offsets of the matches still to come valid, since every edit lies at
+// or after them. It sorts a full Walk, costing O(matches log matches);
+// a Trie built with SetReverse finds the same order in its scan (see
+// MatchReverse). Release the result with ReleaseMatches.
+func (tr *Trie) MatchReverseOrder(input []byte) []*Match {
+	var spans []span
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		spans = append(spans, span{start: end + 1 - n, end: end + 1, pattern: pattern})
+		return true
+	})
+	slices.SortStableFunc(spans, func(a, b span) int {
+		if c := cmp.Compare(b.start, a.start); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.end, a.end)
+	})
+	return tr.pooledMatches(input, spans)
+}
+
+// MatchNonOverlappingStreaming reports the leftmost-longest
+// non-overlapping matches of input to fn, in order: the match starting
+// earliest, the longest of those (then the lowest pattern id), then the
+// same again from the byte after it, and so on. Unlike collecting Match
+// and filtering it, it works in the one left-to-right walk, holding only
+// the matches that start within maxLen bytes of the earliest undecided
+// one: a match is reported once the walk has moved far enough that no
+// match yet to come can start at or before it, so fn runs up to the
+// longest pattern's length behind the scan. Returning false from fn
+// stops the walk.
+func (tr *Trie) MatchNonOverlappingStreaming(input []byte, fn WalkFn) {
+	// With white space collapsing, reported matches can be longer than
+	// any pattern, so nothing is decided before the walk ends.
+	reach := uint64(tr.maxLen)
+	if tr.collapseSpace {
+		reach = math.MaxUint32
+	}
+	var pending []span
+	cursor := uint32(0) // no match before this may be reported
+	stopped := false
+	// decide reports the best pending match while no match ending at or
+	// after end can beat it, returning false once fn has stopped.
+	decide := func(end uint64) bool {
+		for len(pending) > 0 {
+			best := 0
+			for i, c := range pending[1:] {
+				b := pending[best]
+				if c.start < b.start || c.start == b.start && (c.end > b.end || c.end == b.end && c.pattern < b.pattern) {
+					best = i + 1
+				}
+			}
+			b := pending[best]
+			if uint64(b.start)+reach > end {
+				return true
+			}
+			if !fn(b.end-1, b.end-b.start, b.pattern) {
+				return false
+			}
+			cursor = b.end
+			pending = slices.DeleteFunc(pending, func(c span) bool { return c.start < cursor })
+		}
+		return true
+	}
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		if !decide(uint64(end)) {
+			stopped = true
+			return false
+		}
+		if start := end + 1 - n; start >= cursor {
+			pending = append(pending, span{start: start, end: end + 1, pattern: pattern})
+		}
+		return true
+	})
+	if !stopped {
+		decide(math.MaxUint64)
+	}
+}
@@ -0,0 +1,273 @@
+package ahocorasick
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+func checkMatches(t *testing.T, name string, got, want []*Match) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: expected %v, got %v", name, want, got)
+		return
+	}
+	for i := range want {
+		if !MatchEqual(want[i], got[i]) {
+			t.Errorf("%s: match %d: expected %v, got %v", name, i, want[i], got[i])
+		}
+	}
+}
+
+func TestMatchByPriority(t *testing.T) {
+	tr := NewTrieBuilder().
+		AddPatternWithPriority([]byte("new"), 1).      // 0
+		AddPatternWithPriority([]byte("new york"), 0). // 1
+		AddPatternWithPriority([]byte("york"), 5).     // 2
+		AddString("yo").                               // 3: priority 0
+		Build()
+
+	got := tr.MatchByPriority([]byte("new york"))
+	want := []*Match{
+		newMatchString(0, 0, "new"),  // priority 1 beats the longer "new york"
+		newMatchString(4, 2, "york"), // priority 5 beats "yo"
+	}
+	checkMatches(t, "priorities", got, want)
+	tr.ReleaseMatches(got)
+
+	// Equal priorities fall back to longest, then lowest id.
+	tr = NewTrieBuilder().
+		AddPatternWithPriority([]byte("ab"), 2).
+		AddPatternWithPriority([]byte("abc"), 2).
+		AddPatternWithID([]byte("x"), 9).
+		Build()
+	checkMatches(t, "ties", tr.MatchByPriority([]byte("abcx")), []*Match{
+		newMatchString(0, 1, "abc"),
+		newMatchString(3, 9, "x"),
+	})
+
+	// Re-adding a pattern without a priority resets it to 0.
+	tr = NewTrieBuilder().
+		AddPatternWithPriority([]byte("a"), 7).
+		AddPatternWithPriority([]byte("ab"), 3).
+		AddString("a").
+		Build()
+	checkMatches(t, "reset", tr.MatchByPriority([]byte("ab")), []*Match{
+		newMatchString(0, 1, "ab"),
+	})
+}
+
+func TestMatchTopKPerEnd(t *testing.T) {
+	tr := NewTrieBuilder().
+		AddStrings([]string{"e", "de", "cde", "bcde", "abcde", "ab"}).
+		Build()
+
+	checkMatches(t, "k=2", tr.MatchTopKPerEnd([]byte("abcde"), 2), []*Match{
+		newMatchString(0, 5, "ab"),
+		newMatchString(0, 4, "abcde"),
+		newMatchString(1, 3, "bcde"),
+	})
+	if got := tr.MatchTopKPerEnd([]byte("abcde"), 10); len(got) != 6 {
+		t.Errorf("k=10: expected all 6 matches, got %v", got)
+	}
+	if got := tr.MatchTopKPerEnd([]byte("abcde"), 0); got != nil {
+		t.Errorf("k=0: expected no matches, got %v", got)
+	}
+}
+
+func TestMatchByPattern(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"cat", "dog", "bird"}).Build()
+	groups := tr.MatchByPattern([]byte("cat dog, dog cat"))
+	want := map[uint32][]*Match{
+		0: {newMatchString(0, 0, "cat"), newMatchString(13, 0, "cat")},
+		1: {newMatchString(4, 1, "dog"), newMatchString(9, 1, "dog")},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("expected %d groups, got %v", len(want), groups)
+	}
+	for id, ms := range want {
+		checkMatches(t, fmt.Sprint("pattern ", id), groups[id], ms)
+	}
+	tr.ReleaseMatchesByPattern(groups)
+
+	if groups := tr.MatchByPattern([]byte("no pets")); groups != nil {
+		t.Errorf("expected nil, got %v", groups)
+	}
+}
+
+// nonOverlapping is the collect-then-filter reference for
+// MatchNonOverlappingStreaming.
+func nonOverlapping(tr *Trie, input []byte) [][3]uint32 {
+	all := tr.MatchIndices(input)
+	slices.SortFunc(all, func(a, b [3]uint32) int {
+		if c := cmp.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b[1], a[1]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a[2], b[2])
+	})
+	var out [][3]uint32
+	cursor := uint32(0)
+	for _, m := range all {
+		if m[0] >= cursor {
+			out = append(out, m)
+			cursor = m[1]
+		}
+	}
+	return out
+}
+
+func TestMatchNonOverlappingStreaming(t *testing.T) {
+	collect := func(tr *Trie, input []byte) [][3]uint32 {
+		var out [][3]uint32
+		tr.MatchNonOverlappingStreaming(input, func(end, n, pattern uint32) bool {
+			out = append(out, [3]uint32{end + 1 - n, end + 1, pattern})
+			return true
+		})
+		return out
+	}
+
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).Build()
+	got := collect(tr, []byte("ushers"))
+	if want := [][3]uint32{{1, 4, 1}}; !slices.Equal(got, want) {
+		t.Errorf("ushers: expected %v, got %v", want, got)
+	}
+
+	// A long pattern makes short matches wait, and a later start can win
+	// once the earlier candidate is decided.
+	tr = NewTrieBuilder().AddStrings([]string{"ab", "cd", "abcdefghij", "bcdx", "x"}).Build()
+	for _, input := range []string{"abcd", "abcdefghij", "abcdefghiq", "abcdx", "xxabcdxab", ""} {
+		got, want := collect(tr, []byte(input)), nonOverlapping(tr, []byte(input))
+		if !slices.Equal(got, want) {
+			t.Errorf("%q: expected %v, got %v", input, want, got)
+		}
+	}
+
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen, err := os.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr = NewTrieBuilder().AddStrings(patterns[:10000]).Build()
+	if got, want := collect(tr, ibsen), nonOverlapping(tr, ibsen); !slices.Equal(got, want) {
+		t.Errorf("Ibsen: %d matches differ from the %d expected", len(got), len(want))
+	}
+
+	n := 0
+	tr.MatchNonOverlappingStreaming(ibsen, func(end, length, pattern uint32) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("early stop: fn ran %d times, want 3", n)
+	}
+}
+
+func TestMatchUnique(t *testing.T) {
+	trie := NewTrieBuilder().
+		AddPatternWithID([]byte("err"), 7).
+		AddPatternWithID([]byte("error"), 7).
+		AddPatternWithID([]byte("or"), 8).
+		Build()
+	input := []byte("error errand")
+	if n := len(trie.Match(input)); n != 4 {
+		t.Fatalf("Match found %d matches, want 4 with a duplicate key", n)
+	}
+	matches := trie.MatchUnique(input)
+	defer trie.ReleaseMatches(matches)
+	if got, want := fmt.Sprint(matches), `[{0 7 "err"} {3 8 "or"} {6 7 "err"}]`; got != want {
+		t.Errorf("MatchUnique = %s, want %s", got, want)
+	}
+}
+
+func TestMatchWithCooldown(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"alert", "x"}).Build()
+	input := make([]byte, 110)
+	for i := range input {
+		input[i] = '.'
+	}
+	for _, at := range []int{0, 5, 100} {
+		copy(input[at:], "alert")
+	}
+	copy(input[12:], "xx")
+	for _, tc := range []struct {
+		gap  uint32
+		want string
+	}{
+		{10, `[{0 0 "alert"} {12 1 "x"} {100 0 "alert"}]`},
+		{1, `[{0 0 "alert"} {5 0 "alert"} {12 1 "x"} {13 1 "x"} {100 0 "alert"}]`},
+		{1000, `[{0 0 "alert"} {12 1 "x"}]`},
+	} {
+		matches := trie.MatchWithCooldown(input, tc.gap)
+		if got := fmt.Sprint(matches); got != tc.want {
+			t.Errorf("gap %d: got %s, want %s", tc.gap, got, tc.want)
+		}
+		trie.ReleaseMatches(matches)
+	}
+
+	// Under a shared id, "zabc" is reported after "a" but starts before
+	// it, and is as close.
+	shared := NewTrieBuilder().AddPatternWithID([]byte("a"), 0).AddPatternWithID([]byte("zabc"), 0).Build()
+	matches := shared.MatchWithCooldown([]byte("zabc"), 10)
+	if got, want := fmt.Sprint(matches), `[{1 0 "a"}]`; got != want {
+		t.Errorf("shared id: got %s, want %s", got, want)
+	}
+	shared.ReleaseMatches(matches)
+}
+
+func TestMatchShortest(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"a", "ab", "abc", "bc"}).Build()
+	for _, tc := range []struct {
+		input, want string
+	}{
+		// "a" consumes its byte; "bc" then starts at the next position.
+		{"abc", `[{0 0 "a"} {1 3 "bc"}]`},
+		{"xabcab", `[{1 0 "a"} {2 3 "bc"} {4 0 "a"}]`},
+		{"xyz", `[]`},
+	} {
+		matches := trie.MatchShortest([]byte(tc.input))
+		if got := fmt.Sprint(matches); got != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.input, got, tc.want)
+		}
+		trie.ReleaseMatches(matches)
+	}
+
+	trie = NewTrieBuilder().AddStrings([]string{"a", "ab", "abc"}).Build()
+	matches := trie.MatchShortest([]byte("abc"))
+	defer trie.ReleaseMatches(matches)
+	if got, want := fmt.Sprint(matches), `[{0 0 "a"}]`; got != want {
+		t.Errorf("{a, ab, abc}: got %s, want %s", got, want)
+	}
+}
+
+func TestMatchReverseOrder(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).Build()
+	input := []byte("ushers and his")
+	matches := trie.MatchReverseOrder(input)
+	defer trie.ReleaseMatches(matches)
+	if got, want := fmt.Sprint(matches), `[{11 2 "his"} {2 3 "hers"} {2 0 "he"} {1 1 "she"}]`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if len(matches) != len(trie.Match(input)) {
+		t.Errorf("expected every match of Match, got %d", len(matches))
+	}
+
+	trie = NewTrieBuilder().AddStrings([]string{"ab", "cd", "bc"}).Build()
+	matches = trie.MatchReverseOrder([]byte("abcdab"))
+	defer trie.ReleaseMatches(matches)
+	for i := 1; i < len(matches); i++ {
+		if matches[i].Pos() >= matches[i-1].Pos() {
+			t.Errorf("match %d at %d does not start before %d", i, matches[i].Pos(), matches[i-1].Pos())
+		}
+	}
+	if len(matches) != 4 {
+		t.Errorf("expected 4 matches, got %v", matches)
+	}
+}
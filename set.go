@@ -0,0 +1,62 @@
+package ahocorasick
+
+// PatternSet answers exact membership: whether a string is one of the
+// patterns, rather than whether any pattern occurs inside it. It shares
+// the Trie's tables, following only goto edges, the edges of the trie of
+// patterns, so common prefixes are stored once.
+type PatternSet struct {
+	tr       *Trie
+	reverse  bool // patterns are stored back to front (see SetReverse)
+	collapse bool // white space runs are collapsed (see SetCollapseWhitespace)
+}
+
+// BuildSet is Build for exact membership tests (see PatternSet). The
+// byte transform, alphabet, reversal, and white space collapsing apply
+// to Contains' argument as they would to input. The goto edges are told
+// from failure transitions by a depth table computed here, which costs
+// time proportional to the transition table and 4 bytes per state.
+func (tb *TrieBuilder) BuildSet() *PatternSet {
+	tr := tb.Build()
+	tr.depths()
+	return &PatternSet{tr: tr, reverse: tb.reverse, collapse: tb.collapseSpace}
+}
+
+// Contains reports whether s is exactly one of the patterns: following
+// s from the root along goto edges must consume every byte and end on a
+// pattern's final state. A proper prefix or extension of a pattern is
+// not a member, and neither is the empty string. It costs one table
+// lookup per byte and does not allocate, apart from collapsing white
+// space.
+func (ps *PatternSet) Contains(s []byte) bool {
+	if ps.collapse {
+		s = collapseSpace(s)
+	}
+	if len(s) == 0 {
+		return false
+	}
+	tr := ps.tr
+	depth := tr.depths()
+	state := rootState
+	for i := range s {
+		c := s[i]
+		if ps.reverse {
+			c = s[len(s)-1-i]
+		}
+		state = tr.next(state, c) & stateMask
+		if depth[state] != uint32(i+1) {
+			return false
+		}
+	}
+	return tr.dict[state] != 0
+}
+
+// ContainsString is Contains for a string.
+func (ps *PatternSet) ContainsString(s string) bool {
+	return ps.Contains([]byte(s))
+}
+
+// Trie returns the Trie behind the set, for substring matching against
+// the same patterns.
+func (ps *PatternSet) Trie() *Trie {
+	return ps.tr
+}
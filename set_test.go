@@ -0,0 +1,39 @@
+package ahocorasick
+
+import "testing"
+
+func TestPatternSet(t *testing.T) {
+	set := NewTrieBuilder().AddStrings([]string{"apple", "apply", "banana"}).BuildSet()
+	for s, want := range map[string]bool{
+		"apple":   true,
+		"apply":   true,
+		"banana":  true,
+		"app":     false,
+		"apples":  false,
+		"ana":     false, // a substring reached by failure transitions
+		"pple":    false,
+		"":        false,
+		"bananas": false,
+	} {
+		if got := set.ContainsString(s); got != want {
+			t.Errorf("%q: expected %v, got %v", s, want, got)
+		}
+	}
+	if n := set.Trie().Count([]byte("apple banana")); n != 2 {
+		t.Errorf("Trie: expected 2 matches, got %d", n)
+	}
+
+	set = NewTrieBuilder().
+		SetReverse(true).
+		SetByteTransform(func(c byte) byte {
+			if 'A' <= c && c <= 'Z' {
+				return c + 'a' - 'A'
+			}
+			return c
+		}).
+		AddStrings([]string{"apple"}).
+		BuildSet()
+	if !set.ContainsString("APPLE") || set.ContainsString("elppa") || set.ContainsString("app") {
+		t.Error("reversed, case-folded set: wrong membership")
+	}
+}
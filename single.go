@@ -69,8 +69,8 @@ var byteRank = func() (r [256]uint8) {
 // buildSinglePattern detects the one-pattern trie shape and extracts its
 // pattern from the transition table, enabling the fast scan paths
 // (matchSingle, walkSingle). Derived like the other acceleration tables:
-// it reads only failTrans/dict/dictLink/dictPat, so Build and Decode both
-// reach the same result without any wire-format change.
+// it reads only the transitions and dict/dictLink/dictPat, so Build and
+// Decode both reach the same result without any wire-format change.
 //
 // A single pattern of length n compiles to exactly n+2 states (nil, root,
 // one chain state per byte) numbered sequentially by the BFS renumbering,
@@ -84,7 +84,7 @@ var byteRank = func() (r [256]uint8) {
 func (tr *Trie) buildSinglePattern() {
 	tr.single = nil
 	n := int(tr.maxLen)
-	if n < 1 || len(tr.failTrans) != n+2 {
+	if n < 1 || tr.NumStates() != n+2 {
 		return
 	}
 	final := uint32(n) + 1
@@ -100,8 +100,9 @@ func (tr *Trie) buildSinglePattern() {
 		return
 	}
 	pat := make([]byte, 0, n)
+	var buf, failBuf [256]uint32
 	for s := rootState; s <= uint32(n); s++ {
-		row := &tr.failTrans[s]
+		row := tr.row(s, &buf)
 		found := -1
 		for b := range 256 {
 			if row[b]&stateMask == s+1 {
@@ -152,13 +153,13 @@ func (tr *Trie) buildSinglePattern() {
 		if byte(b) == pat[0] {
 			want = rootState + 1
 		}
-		if tr.failTrans[rootState][b]&stateMask != want {
+		if tr.next(rootState, byte(b))&stateMask != want {
 			return
 		}
 	}
 	for s := rootState + 1; s <= final; s++ {
-		row := &tr.failTrans[s]
-		failRow := &tr.failTrans[lps[s-2]+1]
+		row := tr.row(s, &buf)
+		failRow := tr.row(uint32(lps[s-2])+1, &failBuf)
 		d := int(s) - 1 // pattern bytes matched entering s
 		for b := range 256 {
 			want := failRow[b] & stateMask
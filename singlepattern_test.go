@@ -362,7 +362,7 @@ func TestSinglePatternRejectsNoncanonicalTable(t *testing.T) {
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			tr := NewTrieBuilder().AddString(tc.pattern).Build()
+			tr := fullTable(NewTrieBuilder().AddString(tc.pattern).Build())
 			if tr.single == nil {
 				t.Fatal("canonical table not detected as single")
 			}
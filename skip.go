@@ -0,0 +1,136 @@
+package ahocorasick
+
+// skipTable holds MatchSkip's precomputed state. It is derived from the
+// automaton on first use, so Build and Decode pay nothing for tries that
+// never call MatchSkip.
+type skipTable struct {
+	// minLen is the shortest pattern length, the width of the window
+	// the shift is computed over; 0 when the trie has no patterns.
+	minLen int
+	// shift[c] is how far the window may advance when its last byte is
+	// c: the distance from c's rightmost position among the first
+	// minLen-1 bytes of any pattern to the window end, or minLen if c
+	// appears there in no pattern.
+	shift [256]int
+	// depth[s] is the string length reaching state s, which identifies
+	// goto edges for verification (see gotoTree).
+	depth []uint32
+}
+
+func (tr *Trie) buildSkipTable() *skipTable {
+	st := &skipTable{depth: tr.depths()}
+	pats := tr.Patterns()
+	if len(pats) == 0 {
+		return st
+	}
+	m := len(pats[0])
+	for _, p := range pats[1:] {
+		m = min(m, len(p))
+	}
+	st.minLen = m
+	for c := range st.shift {
+		st.shift[c] = m
+	}
+	for _, p := range pats {
+		for j := 0; j < m-1; j++ {
+			st.shift[p[j]] = min(st.shift[p[j]], m-1-j)
+		}
+	}
+	// Bytes whose columns agree in every row are interchangeable to the
+	// automaton (SetByteTransform makes such aliases), while Patterns
+	// names only one of them, so every alias gets the least shift.
+	alias := tr.columnAliases()
+	for c := range st.shift {
+		st.shift[alias[c]] = min(st.shift[alias[c]], st.shift[c])
+	}
+	for c := range st.shift {
+		st.shift[c] = st.shift[alias[c]]
+	}
+	return st
+}
+
+// columnAliases maps each byte to the lowest byte whose transition column
+// is identical to its own.
+func (tr *Trie) columnAliases() (alias [256]byte) {
+	var reps []int
+next:
+	for c := range 256 {
+		for _, r := range reps {
+			same := true
+			for s := range uint32(tr.NumStates()) {
+				if tr.next(s, byte(c)) != tr.next(s, byte(r)) {
+					same = false
+					break
+				}
+			}
+			if same {
+				alias[c] = byte(r)
+				continue next
+			}
+		}
+		reps = append(reps, c)
+		alias[c] = byte(c)
+	}
+	return alias
+}
+
+// MatchSkip finds the same matches as Match with a Horspool-style
+// skip-ahead scan (the Set Horspool member of the Commentz-Walter
+// family). A window as wide as the shortest pattern slides over the
+// input; at each alignment the patterns starting there are verified by
+// descending the trie's goto edges, and the window then advances by a
+// bad-character shift on its last byte, up to the shortest pattern
+// length at a time. Bytes the shift jumps over are never read.
+//
+// Results are ordered by start position, and by length (shortest first)
+// among matches sharing a start, rather than Match's end-position order.
+// They come from the same pool as Match's and may be released with
+// ReleaseMatches. The shift table is built on the first call. Minimized
+// tries, which have no goto edges, and tries that collapse white space,
+// whose matches span input the window cannot measure, fall back to a
+// plain walk.
+//
+// MatchSkip pays off when every pattern is long and the input rarely
+// resembles the patterns' leading bytes, so shifts stay near the
+// shortest pattern length. Each alignment costs a table walk rather than
+// the scan loops' amortized byte step, so one short pattern (which caps
+// every shift) or input dense in pattern bytes makes it slower than
+// Match; BenchmarkMatchSkip compares the two over prose and random
+// letters at several shortest-pattern lengths.
+func (tr *Trie) MatchSkip(input []byte) []*Match {
+	if tr.minimized || tr.collapseSpace {
+		return tr.matchSkipWalk(input)
+	}
+	tr.skipOnce.Do(func() { tr.skip = tr.buildSkipTable() })
+	st := tr.skip
+	m := st.minLen
+	if m == 0 || len(input) < m {
+		return nil
+	}
+
+	buf := tr.bufPool.Get().(*matchBuf)
+	buf.reset()
+	depth := st.depth
+	for pos := 0; pos+m <= len(input); pos += st.shift[input[pos+m-1]] {
+		s := rootState
+		for k := pos; k < len(input); k++ {
+			t := tr.next(s, input[k]) & stateMask
+			if depth[t] != depth[s]+1 {
+				break
+			}
+			s = t
+			if tr.dict[s] != 0 && tr.keep(input, uint32(pos), uint32(k+1)) &&
+				(k+1 == len(input) || !tr.anchored(s)) {
+				buf.raw = append(buf.raw, uint64(k), tr.dictPat[s])
+			}
+		}
+	}
+
+	if len(buf.raw) == 0 {
+		tr.bufPool.Put(buf)
+		return nil
+	}
+	buf.materialize(input)
+	buf.ptrs[0].buf = buf
+	return buf.ptrs
+}
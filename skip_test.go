@@ -0,0 +1,64 @@
+package ahocorasick
+
+import (
+	"cmp"
+	"math/rand"
+	"os"
+	"slices"
+	"testing"
+)
+
+// sortTriples orders (start, pattern, length) triples by start, then
+// length, MatchSkip's output order.
+func sortTriples(ts [][3]uint32) {
+	slices.SortFunc(ts, func(a, b [3]uint32) int {
+		if c := cmp.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a[2], b[2])
+	})
+}
+
+func TestMatchSkip(t *testing.T) {
+	ibsen, err := os.ReadFile("./test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := readPatterns("./test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	sets := map[string][]string{
+		"short":  {"he", "she", "his", "hers", "a"},
+		"nested": {"abcabc", "bcab", "cabca", "abcabcabc"},
+		"ibsen":  {"Hedvig", "Hjalmar", "Gregers", "Werle", "Ekdal"},
+		"words":  words[:3000],
+	}
+	inputs := [][]byte{ibsen, []byte("abcabcabcabcabxabcabcab"), []byte(""), []byte("ab")}
+	for name, pats := range sets {
+		tr := NewTrieBuilder().AddStrings(pats).Build()
+		for _, input := range inputs {
+			want := triplesFromMatches(tr.Match(input))
+			sortTriples(want)
+			got := tr.MatchSkip(input)
+			if i := diffTriples(triplesFromMatches(got), want); i != -1 {
+				t.Errorf("%s: mismatch at %d over %d-byte input", name, i, len(input))
+			}
+			tr.ReleaseMatches(got)
+		}
+		random := make([]byte, 10000)
+		for i := range random {
+			random[i] = "abcehrs"[rng.Intn(7)]
+		}
+		want := triplesFromMatches(tr.Match(random))
+		sortTriples(want)
+		if i := diffTriples(triplesFromMatches(tr.MatchSkip(random)), want); i != -1 {
+			t.Errorf("%s: random input mismatch at %d", name, i)
+		}
+	}
+
+	if m := NewTrieBuilder().Build().MatchSkip([]byte("anything")); m != nil {
+		t.Errorf("empty trie: expected no matches, got %v", m)
+	}
+}
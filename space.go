@@ -0,0 +1,60 @@
+package ahocorasick
+
+// isSpaceByte reports whether c is ASCII white space for
+// SetCollapseWhitespace: space, tab, newline, vertical tab, form feed,
+// or carriage return.
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c >= '\t' && c <= '\r'
+}
+
+// collapseSpace returns p with every run of white space replaced by a
+// single ' '. It returns p itself when there is nothing to replace.
+func collapseSpace(p []byte) []byte {
+	norm, _ := collapseInput(p)
+	return norm
+}
+
+// collapseInput is collapseSpace for input, also returning where each
+// byte of the result came from: the bytes collapsed into norm[i] are
+// input[orig[i]:orig[i+1]], and orig has a final entry of len(input).
+// When input needs no collapsing it returns input and a nil orig
+// without allocating.
+func collapseInput(input []byte) (norm []byte, orig []uint32) {
+	i := 0
+	for ; i < len(input); i++ {
+		if c := input[i]; isSpaceByte(c) && (c != ' ' || i+1 < len(input) && isSpaceByte(input[i+1])) {
+			break
+		}
+	}
+	if i == len(input) {
+		return input, nil
+	}
+	norm = make([]byte, i, len(input))
+	copy(norm, input)
+	orig = make([]uint32, i, len(input)+1)
+	for j := range orig {
+		orig[j] = uint32(j)
+	}
+	for ; i < len(input); i++ {
+		c := input[i]
+		if isSpaceByte(c) {
+			if i > 0 && isSpaceByte(input[i-1]) {
+				continue
+			}
+			c = ' '
+		}
+		norm = append(norm, c)
+		orig = append(orig, uint32(i))
+	}
+	return norm, append(orig, uint32(len(input)))
+}
+
+// uncollapse wraps fn so that matches found in the collapsed input are
+// reported at their positions in the original input. A match takes in
+// every byte of the white space runs at its ends.
+func uncollapse(orig []uint32, fn WalkFn) WalkFn {
+	return func(end, n, pattern uint32) bool {
+		start, stop := orig[end+1-n], orig[end+1]
+		return fn(stop-1, stop-start, pattern)
+	}
+}
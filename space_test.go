@@ -0,0 +1,149 @@
+package ahocorasick
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCollapseWhitespace(t *testing.T) {
+	tr := NewTrieBuilder().
+		SetCollapseWhitespace(true).
+		AddStrings([]string{"a b", "hello \t world", "x "}).
+		Build()
+
+	tests := []struct {
+		input    string
+		expected []*Match
+	}{
+		{"a     b", []*Match{newMatchString(0, 0, "a     b")}},
+		{"za\t\r\nbz", []*Match{newMatchString(1, 0, "a\t\r\nb")}},
+		{"a b", []*Match{newMatchString(0, 0, "a b")}},
+		{"ab", nil},
+		{"say hello\n\nworld  x   !", []*Match{
+			newMatchString(4, 1, "hello\n\nworld"),
+			newMatchString(18, 2, "x   "),
+		}},
+	}
+	for _, tt := range tests {
+		got := tr.MatchString(tt.input)
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.input, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if !MatchEqual(tt.expected[i], got[i]) {
+				t.Errorf("%q: expected %v, got %v", tt.input, tt.expected[i], got[i])
+			}
+		}
+		if n := tr.Count([]byte(tt.input)); n != len(tt.expected) {
+			t.Errorf("%q: Count %d, expected %d", tt.input, n, len(tt.expected))
+		}
+		tr.ReleaseMatches(got)
+	}
+
+	// Plain input is scanned in place.
+	allocs := testing.AllocsPerRun(100, func() {
+		tr.Count([]byte("no runs here: a b"))
+	})
+	if allocs > 1 {
+		t.Errorf("expected no input copy, got %v allocs", allocs)
+	}
+}
+
+func TestCollapseWhitespaceWholeWord(t *testing.T) {
+	tr := NewTrieBuilder().
+		SetCollapseWhitespace(true).
+		SetWholeWord(true).
+		AddString("new york").
+		Build()
+	got := tr.MatchString("new  york, not new  yorkshire")
+	if len(got) != 1 || !MatchEqual(newMatchString(0, 0, "new  york"), got[0]) {
+		t.Errorf("expected only the first match, got %v", got)
+	}
+}
+
+// checkEntryPoints checks that the matching methods that do not go
+// through Walk find Walk's matches in input, each in its own order. rev
+// is tr's patterns built with SetReverse, for MatchReverse. No two
+// matches may share a start, which MatchByPriority resolves to one.
+func checkEntryPoints(t *testing.T, tr, rev *Trie, input string) {
+	t.Helper()
+	want := tr.triplesFromWalk([]byte(input))
+	sorted := slices.Clone(want)
+	sortTriples(sorted)
+	collect := func(out *[][3]uint32) WalkFn {
+		return func(end, n, pattern uint32) bool {
+			*out = append(*out, [3]uint32{end + 1 - n, pattern, n})
+			return true
+		}
+	}
+	check := func(name string, got, want [][3]uint32) {
+		t.Helper()
+		if i := diffTriples(got, want); i >= 0 {
+			t.Errorf("%s(%q): expected %v, got %v", name, input, want, got)
+		}
+	}
+
+	check("MatchSkip", triplesFromMatches(tr.MatchSkip([]byte(input))), sorted)
+	check("MatchTopKPerEnd", triplesFromMatches(tr.MatchTopKPerEnd([]byte(input), len(want))), want)
+	byPrio := triplesFromMatches(tr.MatchByPriority([]byte(input)))
+	sortTriples(byPrio)
+	check("MatchByPriority", byPrio, sorted)
+	reversed := triplesFromMatches(rev.MatchReverse([]byte(input)))
+	sortTriples(reversed)
+	check("MatchReverse", reversed, sorted)
+	all, err := tr.MatchReaderAll(iotest.OneByteReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("MatchReaderAll", triplesFromMatches(all), want)
+	var got [][3]uint32
+	if err := tr.MatchReader(strings.NewReader(input), collect(&got)); err != nil {
+		t.Fatal(err)
+	}
+	check("MatchReader", got, want)
+	got = nil
+	m := tr.NewMatcher()
+	for i := range len(input) {
+		m.Feed([]byte(input[i:i+1]), collect(&got))
+	}
+	m.Flush(collect(&got))
+	check("Matcher.Feed", got, want)
+	got = nil
+	tr.WalkControl([]byte(input), func(end, n, pattern uint32) WalkAction {
+		got = append(got, [3]uint32{end + 1 - n, pattern, n})
+		return WalkContinue
+	})
+	check("WalkControl", got, want)
+	got = nil
+	tr.WalkSkip([]byte(input), func(end, n, pattern uint32) (bool, uint32) {
+		got = append(got, [3]uint32{end + 1 - n, pattern, n})
+		return true, 0
+	})
+	check("WalkSkip", got, want)
+}
+
+func TestCollapseWhitespaceEntryPoints(t *testing.T) {
+	patterns := []string{"a b", "hello \t world", "world", "x "}
+	tr := NewTrieBuilder().SetCollapseWhitespace(true).AddStrings(patterns).Build()
+	rev := NewTrieBuilder().SetCollapseWhitespace(true).SetReverse(true).AddStrings(patterns).Build()
+	const input = "say hello\n\nworld  x   ! a\t b"
+	if n := tr.Count([]byte(input)); n != 4 {
+		t.Fatalf("Walk found %d matches, want 4", n)
+	}
+	checkEntryPoints(t, tr, rev, input)
+
+	// A skip into a white space run resumes after it, since the run's
+	// collapsed space starts before skipTo.
+	skipper := NewTrieBuilder().SetCollapseWhitespace(true).AddStrings([]string{"x", " !"}).Build()
+	var got [][3]uint32
+	skipper.WalkSkip([]byte("x   !"), func(end, n, pattern uint32) (bool, uint32) {
+		got = append(got, [3]uint32{end + 1 - n, pattern, n})
+		return true, 2
+	})
+	if want := [][3]uint32{{0, 0, 1}}; diffTriples(got, want) >= 0 {
+		t.Errorf("WalkSkip into a run: expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,62 @@
+package ahocorasick
+
+import "time"
+
+// Stats describes one matching call for metrics.
+type Stats struct {
+	Bytes    int           // input bytes scanned
+	Matches  int           // matches reported
+	Duration time.Duration // wall time of the scan
+}
+
+// MatchStats is Match also returning Stats for the call, for services
+// that export scan metrics without timing every call site themselves.
+// The Trie takes no observer: one that could be set would break its
+// read-only contract, and Match itself stays free of timing.
+func (tr *Trie) MatchStats(input []byte) ([]*Match, Stats) {
+	start := time.Now()
+	matches := tr.Match(input)
+	return matches, Stats{
+		Bytes:    len(input),
+		Matches:  len(matches),
+		Duration: time.Since(start),
+	}
+}
+
+// WalkStats is Walk also returning Stats for the call. Matches counts
+// the calls to fn, including one that returned false, and Bytes is the
+// input length even when fn stopped the walk early.
+func (tr *Trie) WalkStats(input []byte, fn WalkFn) Stats {
+	start := time.Now()
+	n := 0
+	tr.Walk(input, func(end, length, pattern uint32) bool {
+		n++
+		return fn(end, length, pattern)
+	})
+	return Stats{Bytes: len(input), Matches: n, Duration: time.Since(start)}
+}
+
+// MatchedCoverage returns how many bytes of input lie inside at least
+// one match, for metrics such as the share of a document flagged:
+// overlapping matches count their union once. It merges spans during
+// one Walk, which reports them by end position, so it needs no sort,
+// and keeps one span per disjoint run of matches.
+func (tr *Trie) MatchedCoverage(input []byte) uint32 {
+	var merged [][2]uint32 // disjoint [start, end) spans, in order
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		start, stop := end+1-n, end+1
+		// stop is at least every merged end, so the spans this one
+		// overlaps or touches are at the top.
+		for len(merged) > 0 && merged[len(merged)-1][1] >= start {
+			start = min(start, merged[len(merged)-1][0])
+			merged = merged[:len(merged)-1]
+		}
+		merged = append(merged, [2]uint32{start, stop})
+		return true
+	})
+	covered := uint32(0)
+	for _, s := range merged {
+		covered += s[1] - s[0]
+	}
+	return covered
+}
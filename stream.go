@@ -1,18 +1,212 @@
 package ahocorasick
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/flate"
 	"compress/gzip"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"slices"
 )
 
-// Encode writes a Trie to w in gzip compressed binary format.
+// Errors returned by Decode, wrapped with details; test for them with
+// errors.Is.
+var (
+	// ErrBadMagic reports a stream that is not a gzip-compressed trie.
+	ErrBadMagic = errors.New("ahocorasick: not a serialized trie")
+	// ErrTruncated reports a stream that ended before the trie did.
+	ErrTruncated = errors.New("ahocorasick: truncated trie")
+	// ErrUnsupportedVersion reports a trie written in a format version
+	// this package cannot read, typically by a newer release. Callers
+	// that keep the source patterns can rebuild instead.
+	ErrUnsupportedVersion = errors.New("ahocorasick: unsupported trie format version")
+	// ErrCorrupt reports a stream whose contents are not a valid trie.
+	ErrCorrupt = errors.New("ahocorasick: corrupt trie")
+)
+
+// formatVersion is the wire format version Encode writes.
+//
+// The version travels in the gzip header as an extra subfield (RFC 1952
+// section 2.3.1.1) with ID "AC" whose first data byte is the version, so
+// the compressed payload keeps its original layout. Streams without the
+// subfield predate versioning and read as version 1.
+//
+// Version 1 stores every table as little-endian uint32s. Version 2 packs
+// them as uvarints and stores each failTrans row other than the root's as
+// its differences from the root row (see appendDeltaRow): most entries
+// fall back to the same state the root row names, so a row shrinks from
+// 1 KiB to a few bytes. Version 3 appends the pattern values section
+// (see writeValues). Version 4 adds a second subfield byte naming the
+// byte order of the fixed-width integers, which earlier versions write
+// little-endian (see EncodeWithByteOrder). Version 5 appends the
+// patterns section (see writePatternSection), and version 6 the matching
+// options (see writeOptions). Decode reads every version.
+const formatVersion = 6
+
+// Byte order codes of the version 4 and later header.
+const (
+	orderLittle = 0
+	orderBig    = 1
+)
+
+// formatExtra returns the gzip extra field recording version, followed
+// by any further subfield data.
+func formatExtra(version byte, data ...byte) []byte {
+	return append([]byte{'A', 'C', byte(1 + len(data)), 0, version}, data...)
+}
+
+// parseFormatVersion extracts the format version and byte order from a
+// gzip extra field, defaulting to version 1 when the "AC" subfield is
+// absent and to little-endian before version 4.
+func parseFormatVersion(extra []byte) (byte, binary.ByteOrder, error) {
+	for len(extra) > 0 {
+		if len(extra) < 4 {
+			return 0, nil, fmt.Errorf("%w: malformed gzip extra field", ErrCorrupt)
+		}
+		n := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+n {
+			return 0, nil, fmt.Errorf("%w: malformed gzip extra field", ErrCorrupt)
+		}
+		if extra[0] == 'A' && extra[1] == 'C' {
+			if n == 0 {
+				return 0, nil, fmt.Errorf("%w: empty format version", ErrCorrupt)
+			}
+			// Versions newer than this package's are left for the
+			// caller to reject; their subfield may mean anything.
+			version := extra[4]
+			if version < 4 || version > formatVersion {
+				return version, binary.LittleEndian, nil
+			}
+			if n < 2 {
+				return 0, nil, fmt.Errorf("%w: missing byte order", ErrCorrupt)
+			}
+			switch extra[5] {
+			case orderLittle:
+				return version, binary.LittleEndian, nil
+			case orderBig:
+				return version, binary.BigEndian, nil
+			}
+			return 0, nil, fmt.Errorf("%w: unknown byte order %d", ErrCorrupt, extra[5])
+		}
+		extra = extra[4+n:]
+	}
+	return 1, binary.LittleEndian, nil
+}
+
+// readErr classifies an error from reading the compressed stream:
+// running out of data is ErrTruncated and undecodable compressed data
+// is ErrCorrupt. Other errors (from the underlying reader) pass through,
+// as do errors readErr already classified.
+func readErr(err error) error {
+	var corrupt flate.CorruptInputError
+	switch {
+	case errors.Is(err, ErrTruncated), errors.Is(err, ErrCorrupt):
+		return err
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: %w", ErrTruncated, err)
+	case errors.As(err, &corrupt), errors.Is(err, gzip.ErrChecksum):
+		return fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return err
+}
+
+// readUvarint is binary.ReadUvarint with Decode's error kinds: a varint
+// cut short is ErrTruncated and one overflowing 64 bits is ErrCorrupt.
+func readUvarint(r io.ByteReader) (uint64, error) {
+	var x uint64
+	for i, shift := 0, uint(0); i < binary.MaxVarintLen64; i, shift = i+1, shift+7 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, readErr(err)
+		}
+		if b < 0x80 {
+			if i == binary.MaxVarintLen64-1 && b > 1 {
+				break
+			}
+			return x | uint64(b)<<shift, nil
+		}
+		x |= uint64(b&0x7f) << shift
+	}
+	return 0, fmt.Errorf("%w: varint overflows 64 bits", ErrCorrupt)
+}
+
+// expectEOF reports an error unless r has no data left and ends cleanly.
+func expectEOF(r io.Reader) error {
+	var one [1]byte
+	n, err := r.Read(one[:])
+	for n == 0 && err == nil {
+		n, err = r.Read(one[:])
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: trailing data after trie", ErrCorrupt)
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return readErr(err)
+}
+
+// Encode writes a Trie to w in gzip compressed binary format. It fails
+// for a minimized Trie (see TrieBuilder.BuildMinimized).
 func Encode(w io.Writer, trie *Trie) error {
+	return EncodeWithByteOrder(w, trie, binary.LittleEndian)
+}
+
+// EncodeWithByteOrder is Encode writing the format's fixed-width integers
+// in the given byte order: binary.LittleEndian (Encode's choice),
+// binary.BigEndian for readers that expect network byte order, or
+// binary.NativeEndian. The order is recorded in the header, so Decode
+// reads either without being told.
+func EncodeWithByteOrder(w io.Writer, trie *Trie, order binary.ByteOrder) error {
 	enc := newEncoder(w)
+	switch {
+	case order == nil:
+		return errors.New("ahocorasick: nil byte order")
+	case order.Uint16([]byte{1, 0}) == 1:
+		enc.order = orderLittle
+	case order.Uint16([]byte{0, 1}) == 1:
+		enc.order = orderBig
+	default:
+		return fmt.Errorf("ahocorasick: unsupported byte order %v", order)
+	}
 	return enc.encode(trie)
 }
 
+// EncodeLevel is Encode compressing at the given gzip level, from
+// gzip.HuffmanOnly and gzip.BestSpeed up to gzip.BestCompression, or
+// gzip.DefaultCompression as Encode uses. Any level decodes the same.
+// A level outside that range is an error, reported before anything is
+// written.
+func EncodeLevel(w io.Writer, trie *Trie, level int) error {
+	enc := newEncoder(w)
+	enc.level = level
+	return enc.encode(trie)
+}
+
+// EncodeWithoutPatterns is Encode leaving out the section that stores
+// the trie's patterns, for when space matters more than Patterns' speed:
+// a Trie decoded from its output recovers patterns from the automaton,
+// as every Trie did before format version 5, instead of reading them.
+func EncodeWithoutPatterns(w io.Writer, trie *Trie) error {
+	enc := newEncoder(w)
+	enc.omitPatterns = true
+	return enc.encode(trie)
+}
+
+// EncodeBytes is Encode returning the serialized Trie as a byte slice.
+func EncodeBytes(trie *Trie) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, trie); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // DecodeMaxStates is the default upper bound Decode places on the number of
 // automaton states it will accept from a stream. A decoded trie's memory is
 // dominated by failTrans at one [256]uint32 row (1 KiB) per state, so this is
@@ -28,6 +222,12 @@ func Decode(r io.Reader) (*Trie, error) {
 	return DecodeWithMaxStates(r, DecodeMaxStates)
 }
 
+// DecodeBytes is Decode reading the serialized Trie from data, as
+// EncodeBytes returns it.
+func DecodeBytes(data []byte) (*Trie, error) {
+	return Decode(bytes.NewReader(data))
+}
+
 // DecodeWithMaxStates is Decode with a caller-supplied ceiling on the number of
 // automaton states. The bound caps the memory a corrupt or hostile stream can
 // make Decode allocate — failTrans costs one [256]uint32 row (1 KiB) per state
@@ -42,126 +242,680 @@ func DecodeWithMaxStates(r io.Reader, maxStates int) (*Trie, error) {
 	return dec.decode(maxStates)
 }
 
+// DecodeFrom is Decode into tr, reusing the memory of its tables for
+// the new ones where they are large enough, so a service reloading a
+// big dictionary in a loop does not allocate a new transition table
+// each time. Everything else about tr is replaced: settings such as
+// whole-word matching and values are those of the stream, as for
+// Decode, and its match buffer pool starts empty.
+//
+// DecodeFrom is the one method that changes a Trie's tables, so the
+// caller must have tr to itself: no other goroutine may use tr during
+// the call, and matches taken from it before the call must no longer
+// be used. Between calls tr is read-only as usual. tr is changed only
+// once the whole stream has been read and checked; on error it is left
+// as it was. The DecodeMaxStates ceiling applies.
+func (tr *Trie) DecodeFrom(r io.Reader) error {
+	return newDecoder(r).decodeInto(tr, DecodeMaxStates)
+}
+
+// Header describes a serialized Trie (see DecodeHeader).
+type Header struct {
+	// Version is the format version the Trie was written in.
+	Version int
+	// ByteOrder is the byte order of the format's fixed-width integers.
+	ByteOrder binary.ByteOrder
+	// States is the number of automaton states, including the unused
+	// state 0; a decoded Trie's transition table takes 1 KiB per state.
+	States int
+	// Patterns is the number of distinct patterns stored.
+	Patterns int
+}
+
+// DecodeHeader reads the header of a Trie serialized by Encode: its
+// version and counts, so a cache can judge a stream's size before
+// loading it. It reads the table lengths and the first table, which
+// holds one entry per state, and stops before the transition table, so
+// it costs a small fraction of Decode's time and memory. Errors wrap
+// the same sentinels as Decode's; a stream whose header reads cleanly
+// may still fail to decode.
+func DecodeHeader(r io.Reader) (Header, error) {
+	dec := newDecoder(r)
+	if err := dec.readHeader(); err != nil {
+		return Header{}, err
+	}
+	defer dec.gz.Close()
+	h := Header{Version: int(dec.version), ByteOrder: dec.order}
+	if dec.states > uint64(stateMask)+1 {
+		return Header{}, fmt.Errorf("%w: %d states exceeds %d", ErrCorrupt, dec.states, uint64(stateMask)+1)
+	}
+	h.States = int(dec.states)
+	var word [4]byte
+	for range dec.states {
+		var n uint64
+		if dec.version >= 2 {
+			v, err := readUvarint(dec.br)
+			if err != nil {
+				return Header{}, readErr(err)
+			}
+			n = v
+		} else {
+			if _, err := io.ReadFull(dec.br, word[:]); err != nil {
+				return Header{}, readErr(err)
+			}
+			n = uint64(dec.order.Uint32(word[:]))
+		}
+		if n != 0 {
+			h.Patterns++
+		}
+	}
+	return h, nil
+}
+
+// Load reads a serialized Trie from r and checks it with Validate: the
+// counterpart to Compile for tries stored with Encode. Errors wrap the
+// same sentinels as Decode's, with ErrCorrupt for a Trie that decodes
+// but fails validation.
+func Load(r io.Reader) (*Trie, error) {
+	tr, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := tr.Validate(); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// Validate checks that the Trie's tables describe a consistent
+// automaton, returning an error wrapping ErrCorrupt if not. Decode
+// already rejects tables that would make matching index out of range or
+// loop; Validate also checks the relations a well-formed automaton keeps
+// between its states, so that a stream altered into another
+// decodable-looking trie is caught: every reachable state's pattern is
+// no longer than the shortest input reaching it, every output link
+// leads to a pattern state nearer the root, and a stored patterns
+// section lists exactly the patterns the automaton matches. The checks
+// cost one pass over the transition table, to find each state's depth,
+// plus one step per stored pattern byte.
+func (tr *Trie) Validate() error {
+	n := tr.NumStates()
+	if n < 2 || tr.failTrans != nil && len(tr.failTrans) != n || len(tr.dictLink) != n || len(tr.pattern) != n {
+		return fmt.Errorf("%w: inconsistent table lengths", ErrCorrupt)
+	}
+	var row [256]uint32
+	for s := range uint32(n) {
+		for _, v := range tr.row(s, &row) {
+			if int(v&stateMask) >= n {
+				return fmt.Errorf("%w: state %d transition targets state %d, want < %d states", ErrCorrupt, s, v&stateMask, n)
+			}
+		}
+	}
+	_, _, depth := tr.gotoTree()
+	reachable := func(s uint32) bool {
+		return s == rootState || depth[s] != 0
+	}
+	for s := range tr.dict {
+		if !reachable(uint32(s)) {
+			continue
+		}
+		if tr.dict[s] > depth[s] {
+			return fmt.Errorf("%w: state %d at depth %d has a pattern of length %d", ErrCorrupt, s, depth[s], tr.dict[s])
+		}
+		u := tr.dictLink[s]
+		if u == nilState {
+			continue
+		}
+		if int(u) >= n || !reachable(u) || tr.dict[u] == 0 || depth[u] >= depth[s] {
+			return fmt.Errorf("%w: state %d has an invalid output link to state %d", ErrCorrupt, s, u)
+		}
+	}
+	if tr.patterns != nil && !tr.minimized {
+		return tr.validatePatterns(depth)
+	}
+	return nil
+}
+
+// validatePatterns checks the stored patterns against the automaton
+// without recovering them: in Patterns' order, each must lead from the
+// root along goto edges, as told by depth, to a reachable pattern state
+// of its length and id not already claimed by another, and together they
+// must claim every such state.
+func (tr *Trie) validatePatterns(depth []uint32) error {
+	claimed := make([]bool, tr.NumStates())
+	for i, e := range tr.patterns {
+		if i > 0 {
+			prev := tr.patterns[i-1]
+			if c := cmp.Compare(prev.id, e.id); c > 0 || c == 0 && bytes.Compare(prev.p, e.p) >= 0 {
+				return fmt.Errorf("%w: stored pattern %d is out of order", ErrCorrupt, i)
+			}
+		}
+		s := rootState
+		for j, c := range e.p {
+			s = tr.next(s, c) & stateMask
+			if depth[s] != uint32(j+1) {
+				return fmt.Errorf("%w: stored pattern %d is not in the automaton", ErrCorrupt, i)
+			}
+		}
+		if tr.dict[s] != uint32(len(e.p)) || tr.pattern[s] != e.id || claimed[s] {
+			return fmt.Errorf("%w: stored pattern %d does not match its state %d", ErrCorrupt, i, s)
+		}
+		claimed[s] = true
+	}
+	for s, n := range tr.dict {
+		if n != 0 && depth[s] != 0 && !claimed[s] {
+			return fmt.Errorf("%w: state %d's pattern is missing from the stored patterns", ErrCorrupt, s)
+		}
+	}
+	return nil
+}
+
 type encoder struct {
-	w io.Writer
+	w            io.Writer
+	order        byte // orderLittle or orderBig
+	level        int  // gzip compression level
+	omitPatterns bool // write an empty patterns section
 }
 
 func newEncoder(w io.Writer) *encoder {
 	return &encoder{
-		w,
+		w:     w,
+		level: gzip.DefaultCompression,
 	}
 }
 
 func (enc *encoder) encode(trie *Trie) error {
-	w := gzip.NewWriter(enc.w)
+	if trie.minimized {
+		return errMinimized
+	}
+	w, err := gzip.NewWriterLevel(enc.w, enc.level)
+	if err != nil {
+		return fmt.Errorf("ahocorasick: %w", err)
+	}
 	defer w.Close()
+	w.Extra = formatExtra(formatVersion, enc.order)
+	var order binary.ByteOrder = binary.LittleEndian
+	if enc.order == orderBig {
+		order = binary.BigEndian
+	}
 
 	// Write the lengths of all arrays first
-	if err := binary.Write(w, binary.LittleEndian, uint64(len(trie.dict))); err != nil {
+	if err := binary.Write(w, order, uint64(len(trie.dict))); err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint64(len(trie.failTrans))); err != nil {
+	if err := binary.Write(w, order, uint64(trie.NumStates())); err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint64(len(trie.dictLink))); err != nil {
+	if err := binary.Write(w, order, uint64(len(trie.dictLink))); err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.LittleEndian, uint64(len(trie.pattern))); err != nil {
+	if err := binary.Write(w, order, uint64(len(trie.pattern))); err != nil {
 		return err
 	}
 
-	// Write the actual data
-	if err := binary.Write(w, binary.LittleEndian, trie.dict); err != nil {
+	// Write the actual data. Entries are uvarints (format version 2); the
+	// values are small (lengths, ids, mostly-zero links), so most take one
+	// or two bytes instead of four.
+	buf := make([]byte, 0, 4096)
+	writeTable := func(table []uint32) error {
+		buf = buf[:0]
+		for _, v := range table {
+			buf = binary.AppendUvarint(buf, uint64(v))
+			if len(buf) >= 4096-binary.MaxVarintLen32 {
+				if _, err := w.Write(buf); err != nil {
+					return err
+				}
+				buf = buf[:0]
+			}
+		}
+		_, err := w.Write(buf)
+		return err
+	}
+	if err := writeTable(trie.dict); err != nil {
 		return err
 	}
 
-	// Flatten and write failTrans. In-memory entries carry outputFlag bits
-	// (see addOutputFlags); mask them off so the serialized format stays
-	// plain state ids, compatible with readers that predate the flags.
-	// Decode re-derives the flags.
-	var row [256]uint32
-	for _, arr := range trie.failTrans {
-		for i, v := range arr {
-			row[i] = v & stateMask
+	// Write failTrans: the root row, then every other row as the entries
+	// differing from it. In-memory entries carry outputFlag bits (see
+	// addOutputFlags); mask them off so the serialized format stays plain
+	// state ids. Decode re-derives the flags.
+	var root, row [256]uint32
+	for b, v := range trie.row(rootState, &row) {
+		root[b] = v & stateMask
+	}
+	if err := writeTable(root[:]); err != nil {
+		return err
+	}
+	for s := range uint32(trie.NumStates()) {
+		if s == rootState {
+			continue
 		}
-		if err := binary.Write(w, binary.LittleEndian, row[:]); err != nil {
+		buf = appendDeltaRow(buf[:0], &root, trie.row(s, &row))
+		if _, err := w.Write(buf); err != nil {
 			return err
 		}
 	}
 
-	if err := binary.Write(w, binary.LittleEndian, trie.dictLink); err != nil {
+	if err := writeTable(trie.dictLink); err != nil {
 		return err
 	}
-	if err := binary.Write(w, binary.LittleEndian, trie.pattern); err != nil {
+	if err := writeTable(trie.pattern); err != nil {
+		return err
+	}
+	if err := writeValues(w, trie.values); err != nil {
+		return err
+	}
+	var entries []patternEntry
+	if !enc.omitPatterns {
+		entries = trie.patternEntries()
+	}
+	if err := writePatternSection(w, entries, !enc.omitPatterns); err != nil {
 		return err
 	}
+	return writeOptions(w, trie)
+}
 
-	return nil
+// Bits of the version 6 options section.
+const (
+	optWholeWord     = 1 << iota // SetWholeWord
+	optCollapseSpace             // SetCollapseWhitespace
+	optEndAnchored               // AddPatternEndAnchored
+	optFailLinks                 // SetKeepFailLinks
+
+	optKnown = optWholeWord | optCollapseSpace | optEndAnchored | optFailLinks
+)
+
+// writeOptions writes the version 6 options section: the uvarint set of
+// opt bits naming the matching settings trie was built with. With
+// optEndAnchored, the uvarint count of end-anchored pattern states
+// follows, then the states in increasing order, each as its uvarint gap
+// from the one before (the first from 0). With optFailLinks, every
+// state's failure link follows as a uvarint, in state order.
+func writeOptions(w io.Writer, trie *Trie) error {
+	var bits uint64
+	if trie.wholeWord {
+		bits |= optWholeWord
+	}
+	if trie.collapseSpace {
+		bits |= optCollapseSpace
+	}
+	var anchored []uint32
+	for s, a := range trie.endAnchored {
+		if a {
+			anchored = append(anchored, uint32(s))
+		}
+	}
+	if len(anchored) != 0 {
+		bits |= optEndAnchored
+	}
+	if trie.keepFail {
+		bits |= optFailLinks
+	}
+	buf := binary.AppendUvarint(nil, bits)
+	if len(anchored) != 0 {
+		buf = binary.AppendUvarint(buf, uint64(len(anchored)))
+		prev := uint32(0)
+		for _, s := range anchored {
+			buf = binary.AppendUvarint(buf, uint64(s-prev))
+			prev = s
+		}
+	}
+	if trie.keepFail {
+		for _, f := range trie.failLink {
+			buf = binary.AppendUvarint(buf, uint64(f))
+			if len(buf) >= readerChunk {
+				if _, err := w.Write(buf); err != nil {
+					return err
+				}
+				buf = buf[:0]
+			}
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// options are the matching settings a version 6 options section
+// carries, held apart from the Trie until the whole stream is read.
+type options struct {
+	wholeWord, collapseSpace bool
+	endAnchored              []bool
+	failLink                 []uint32
+}
+
+// readOptions reads a version 6 options section (see writeOptions) for
+// a Trie with the given dict. Bits this package does not know are
+// corrupt, since a Trie ignoring them would match differently from the
+// one encoded, and so are anchored states out of order or not matching
+// a pattern, and failure links out of range.
+func readOptions(r *bufio.Reader, dict []uint32) (options, error) {
+	var opts options
+	bits, err := readUvarint(r)
+	if err != nil {
+		return opts, err
+	}
+	if bits&^optKnown != 0 {
+		return opts, fmt.Errorf("%w: unknown option bits %#x", ErrCorrupt, bits&^optKnown)
+	}
+	opts.wholeWord = bits&optWholeWord != 0
+	opts.collapseSpace = bits&optCollapseSpace != 0
+	if bits&optEndAnchored != 0 {
+		if opts.endAnchored, err = readAnchored(r, dict); err != nil {
+			return opts, err
+		}
+	}
+	if bits&optFailLinks != 0 {
+		opts.failLink = make([]uint32, len(dict))
+		if err := readUvarints(r, opts.failLink); err != nil {
+			return opts, err
+		}
+		for s, f := range opts.failLink {
+			if int(f) >= len(dict) {
+				return opts, fmt.Errorf("%w: state %d fails to state %d, want < %d states", ErrCorrupt, s, f, len(dict))
+			}
+		}
+	}
+	return opts, nil
+}
+
+// readAnchored reads the end-anchored states of an options section.
+func readAnchored(r *bufio.Reader, dict []uint32) ([]bool, error) {
+	count, err := readUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || count >= uint64(len(dict)) {
+		return nil, fmt.Errorf("%w: %d end-anchored states", ErrCorrupt, count)
+	}
+	anchored := make([]bool, len(dict))
+	s := uint64(0)
+	for i := uint64(0); i < count; i++ {
+		gap, err := readUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if gap == 0 && i > 0 || gap >= uint64(len(dict))-s || dict[s+gap] == 0 {
+			return nil, fmt.Errorf("%w: end-anchored state %d", ErrCorrupt, i)
+		}
+		s += gap
+		anchored[s] = true
+	}
+	return anchored, nil
+}
+
+// writeValues writes the version 3 values section: the uvarint count of
+// []byte values, then each as its uvarint pattern id, uvarint length, and
+// bytes, in id order. Values of other types cannot be serialized and are
+// left out.
+func writeValues(w io.Writer, values map[uint32]any) error {
+	ids := make([]uint32, 0, len(values))
+	for id, v := range values {
+		if _, ok := v.([]byte); ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	buf := binary.AppendUvarint(nil, uint64(len(ids)))
+	for _, id := range ids {
+		v := values[id].([]byte)
+		buf = binary.AppendUvarint(buf, uint64(id))
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		buf = append(buf, v...)
+		if len(buf) >= readerChunk {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// writePatternSection writes the version 5 patterns section, Patterns'
+// list with ids: a uvarint 1, or 0 when the section was omitted and
+// nothing follows, then the uvarint count of patterns and each as its
+// uvarint id, uvarint length, and bytes, in Patterns' order.
+func writePatternSection(w io.Writer, entries []patternEntry, present bool) error {
+	if !present {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	buf := binary.AppendUvarint([]byte{1}, uint64(len(entries)))
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, uint64(e.id))
+		buf = binary.AppendUvarint(buf, uint64(len(e.p)))
+		buf = append(buf, e.p...)
+		if len(buf) >= readerChunk {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// readPatternSection reads a version 5 patterns section (see
+// writePatternSection), returning nil when it was omitted. No pattern
+// can be longer than the automaton is deep, so lengths of states or
+// more are corrupt.
+func readPatternSection(r *bufio.Reader, states uint64) ([]patternEntry, error) {
+	present, err := readUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	switch present {
+	case 0:
+		return nil, nil
+	case 1:
+	default:
+		return nil, fmt.Errorf("%w: patterns section marker %d", ErrCorrupt, present)
+	}
+	count, err := readUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []patternEntry
+	for i := uint64(0); i < count; i++ {
+		id, err := readUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		n, err := readUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if id > math.MaxUint32 || n == 0 || n >= states {
+			return nil, fmt.Errorf("%w: stored pattern %d: id %d, length %d", ErrCorrupt, i, id, n)
+		}
+		p := make([]byte, n)
+		if _, err := io.ReadFull(r, p); err != nil {
+			return nil, readErr(err)
+		}
+		entries = append(entries, patternEntry{id: uint32(id), p: p})
+	}
+	return entries, nil
+}
+
+// readValues reads a version 3 values section (see writeValues), or
+// returns nil for an empty one. Value bytes are copied as they arrive,
+// so a declared length larger than the stream costs only what the
+// stream delivers.
+func readValues(r *bufio.Reader) (map[uint32]any, error) {
+	count, err := readUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	values := make(map[uint32]any)
+	for i := uint64(0); i < count; i++ {
+		id, err := readUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		n, err := readUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if id > math.MaxUint32 {
+			return nil, fmt.Errorf("%w: value for pattern id %d", ErrCorrupt, id)
+		}
+		if _, dup := values[uint32(id)]; dup {
+			return nil, fmt.Errorf("%w: duplicate value for pattern %d", ErrCorrupt, id)
+		}
+		var v bytes.Buffer
+		if _, err := io.CopyN(&v, r, int64(min(n, math.MaxInt64))); err != nil {
+			return nil, readErr(err)
+		}
+		values[uint32(id)] = v.Bytes()
+	}
+	return values, nil
+}
+
+// appendDeltaRow appends row's version 2 encoding to buf: the uvarint
+// count of entries differing from root, then for each, in byte order, the
+// uvarint gap since the previous one and the zigzag varint delta from
+// root. Nearly every entry matches root, so a row is a handful of bytes.
+func appendDeltaRow(buf []byte, root, row *[256]uint32) []byte {
+	var diff int
+	for b, v := range row {
+		if v&stateMask != root[b] {
+			diff++
+		}
+	}
+	buf = binary.AppendUvarint(buf, uint64(diff))
+	prev := -1
+	for b, v := range row {
+		if v &= stateMask; v != root[b] {
+			buf = binary.AppendUvarint(buf, uint64(b-prev-1))
+			buf = binary.AppendVarint(buf, int64(v)-int64(root[b]))
+			prev = b
+		}
+	}
+	return buf
 }
 
 type decoder struct {
 	r io.Reader
+
+	// Set by readHeader: the decompressing reader, the buffered reader
+	// over it that the tables are read from, the format version and
+	// byte order, and the state count every table's length equals.
+	gz      *gzip.Reader
+	br      *bufio.Reader
+	version byte
+	order   binary.ByteOrder
+	states  uint64
 }
 
 func newDecoder(r io.Reader) *decoder {
 	return &decoder{
-		r,
+		r: r,
 	}
 }
 
-func (dec *decoder) decode(maxStates int) (*Trie, error) {
-	if maxStates <= 0 {
-		maxStates = DecodeMaxStates
+// readHeader opens the gzip stream and reads the format version and the
+// table lengths, checking they agree. On success the caller must close
+// dec.gz.
+func (dec *decoder) readHeader() error {
+	r, err := gzip.NewReader(dec.r)
+	if err != nil {
+		if errors.Is(err, gzip.ErrHeader) {
+			return fmt.Errorf("%w: %w", ErrBadMagic, err)
+		}
+		return readErr(err)
 	}
 
-	r, err := gzip.NewReader(dec.r)
+	version, order, err := parseFormatVersion(r.Extra)
 	if err != nil {
-		return nil, err
+		r.Close()
+		return err
 	}
-	defer r.Close()
+	if version < 1 || version > formatVersion {
+		r.Close()
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	br := bufio.NewReader(r)
 
 	var dictLen, failTransLen, dictLinkLen, patternLen uint64
 
 	// Read the lengths of all arrays
-	if err := binary.Read(r, binary.LittleEndian, &dictLen); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(r, binary.LittleEndian, &failTransLen); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(r, binary.LittleEndian, &dictLinkLen); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(r, binary.LittleEndian, &patternLen); err != nil {
-		return nil, err
+	for _, n := range []*uint64{&dictLen, &failTransLen, &dictLinkLen, &patternLen} {
+		if err := binary.Read(br, order, n); err != nil {
+			r.Close()
+			return readErr(err)
+		}
 	}
 
 	// Decode operates on untrusted input. A well-formed trie has one row per
 	// state across all four arrays and at least the unused state 0 plus the
 	// root, so buildRootSkip can index failTrans[rootState]. Reject anything
 	// else with an error rather than panicking on a truncated or corrupt stream.
-	//
+	if failTransLen < 2 || dictLen != failTransLen || dictLinkLen != failTransLen || patternLen != failTransLen {
+		r.Close()
+		return fmt.Errorf("%w: inconsistent table lengths (dict=%d failTrans=%d dictLink=%d pattern=%d)", ErrCorrupt, dictLen, failTransLen, dictLinkLen, patternLen)
+	}
+	dec.gz, dec.br, dec.version, dec.order, dec.states = r, br, version, order, failTransLen
+	return nil
+}
+
+func (dec *decoder) decode(maxStates int) (*Trie, error) {
+	trie := new(Trie)
+	if err := dec.decodeInto(trie, maxStates); err != nil {
+		return nil, err
+	}
+	return trie, nil
+}
+
+// decodeInto decodes into trie, which is either new or, for DecodeFrom,
+// a Trie whose tables' memory is reused. trie is not touched until the
+// whole stream has been read and checked, so on error it is as before.
+func (dec *decoder) decodeInto(trie *Trie, maxStates int) error {
+	if maxStates <= 0 {
+		maxStates = DecodeMaxStates
+	}
+
+	if err := dec.readHeader(); err != nil {
+		return err
+	}
+	defer dec.gz.Close()
+	br, version, order := dec.br, dec.version, dec.order
+	dictLen, failTransLen, dictLinkLen, patternLen := dec.states, dec.states, dec.states, dec.states
+
 	// maxStates caps the memory a corrupt or hostile stream can make Decode
 	// allocate: failTrans dominates at one [256]uint32 row (1 KiB) per state.
 	// failTrans is also grown incrementally as rows are read (below), so a
 	// stream that declares a huge count but carries little data cannot force a
 	// large up-front allocation — the reservation tracks the bytes actually
 	// delivered, bounded by maxStates.
-	if failTransLen < 2 || dictLen != failTransLen || dictLinkLen != failTransLen || patternLen != failTransLen {
-		return nil, fmt.Errorf("ahocorasick: corrupt trie: inconsistent table lengths (dict=%d failTrans=%d dictLink=%d pattern=%d)", dictLen, failTransLen, dictLinkLen, patternLen)
-	}
+	//
 	// Packed transitions reserve the high bit for outputFlag (see trie.go),
 	// so state ids must fit in stateMask regardless of the caller's memory
 	// budget. The default DecodeMaxStates sits far below this ceiling; the
 	// check matters only for callers passing a larger custom limit.
 	if failTransLen > uint64(maxStates) || failTransLen > uint64(stateMask)+1 {
-		return nil, fmt.Errorf("ahocorasick: corrupt trie: %d states exceeds decode limit %d", failTransLen, maxStates)
+		return fmt.Errorf("%w: %d states exceeds decode limit %d", ErrCorrupt, failTransLen, maxStates)
+	}
+
+	// Version 1 tables are raw little-endian uint32s; version 2 packs
+	// them as uvarints.
+	readTable := func(dst []uint32) error {
+		return binary.Read(br, order, dst)
+	}
+	if version >= 2 {
+		readTable = func(dst []uint32) error {
+			return readUvarints(br, dst)
+		}
 	}
 
 	// Allocate memory and read the actual data
 	dict := make([]uint32, dictLen)
-	if err := binary.Read(r, binary.LittleEndian, dict); err != nil {
-		return nil, err
+	if err := readTable(dict); err != nil {
+		return readErr(err)
 	}
 
 	// Grow failTrans as rows are read rather than allocating the declared count
@@ -173,32 +927,66 @@ func (dec *decoder) decode(maxStates int) (*Trie, error) {
 	if initCap > initialFailTransCap {
 		initCap = initialFailTransCap
 	}
-	failTrans := make([][256]uint32, 0, initCap)
+	//
+	// When trie has a table to reuse, rows cannot go into it before the
+	// stream checks out. They are staged instead, each packed against
+	// root as appendDeltaRow writes them (root is all zero for version
+	// 1, which has none), and unpacked into the old table at the end.
+	var root [256]uint32
+	var failTrans [][256]uint32
+	var staged []byte
+	reuse := cap(trie.failTrans) > 0
+	if !reuse {
+		failTrans = make([][256]uint32, 0, initCap)
+	}
+	readRow := func(_ uint64, row *[256]uint32) error {
+		return binary.Read(br, order, row[:])
+	}
+	if version >= 2 {
+		if err := readUvarints(br, root[:]); err != nil {
+			return err
+		}
+		readRow = func(i uint64, row *[256]uint32) error {
+			if i == uint64(rootState) {
+				*row = root
+				return nil
+			}
+			return readDeltaRow(br, &root, row)
+		}
+	}
+	var scratch [256]uint32
 	for i := uint64(0); i < failTransLen; i++ {
-		failTrans = append(failTrans, [256]uint32{})
-		if err := binary.Read(r, binary.LittleEndian, failTrans[i][:]); err != nil {
-			return nil, err
+		row := &scratch
+		if !reuse {
+			failTrans = append(failTrans, [256]uint32{})
+			row = &failTrans[i]
+		}
+		if err := readRow(i, row); err != nil {
+			return readErr(err)
 		}
 		// Transition targets come from an untrusted stream and are used as
 		// indexes by addOutputFlags and the scan loops. Entries must be
 		// plain state ids: in range and without flag bits (Encode strips
 		// them).
-		for _, v := range failTrans[i] {
+		for _, v := range row {
 			if uint64(v) >= failTransLen {
-				return nil, fmt.Errorf("ahocorasick: corrupt trie: state %d transition targets state %d, want < %d states", i, v, failTransLen)
+				return fmt.Errorf("%w: state %d transition targets state %d, want < %d states", ErrCorrupt, i, v, failTransLen)
 			}
 		}
+		if reuse {
+			staged = appendDeltaRow(staged, &root, row)
+		}
 	}
 
 	dictLink := make([]uint32, dictLinkLen)
-	if err := binary.Read(r, binary.LittleEndian, dictLink); err != nil {
-		return nil, err
+	if err := readTable(dictLink); err != nil {
+		return readErr(err)
 	}
 	// dictLink entries are chased and indexed during matching; bound them
 	// the same way.
 	for i, v := range dictLink {
 		if uint64(v) >= failTransLen {
-			return nil, fmt.Errorf("ahocorasick: corrupt trie: dictLink %d targets state %d, want < %d states", i, v, failTransLen)
+			return fmt.Errorf("%w: dictLink %d targets state %d, want < %d states", ErrCorrupt, i, v, failTransLen)
 		}
 	}
 	// A dictLink cycle (e.g. 5 -> 7 -> 5) passes the bounds check but
@@ -213,7 +1001,7 @@ func (dec *decoder) decode(maxStates int) (*Trie, error) {
 		path = path[:0]
 		for u := uint32(s); !resolved[u]; u = dictLink[u] {
 			if len(path) == len(dictLink) {
-				return nil, fmt.Errorf("ahocorasick: corrupt trie: dictLink chain from state %d cycles", s)
+				return fmt.Errorf("%w: dictLink chain from state %d cycles", ErrCorrupt, s)
 			}
 			path = append(path, u)
 		}
@@ -223,23 +1011,76 @@ func (dec *decoder) decode(maxStates int) (*Trie, error) {
 	}
 
 	pattern := make([]uint32, patternLen)
-	if err := binary.Read(r, binary.LittleEndian, pattern); err != nil {
-		return nil, err
+	if err := readTable(pattern); err != nil {
+		return readErr(err)
 	}
 
-	trie := &Trie{
-		failTrans: failTrans,
-		dictLink:  dictLink,
-		dict:      dict,
-		pattern:   pattern,
-		bufPool:   newBufPool(),
+	var values map[uint32]any
+	if version >= 3 {
+		var err error
+		if values, err = readValues(br); err != nil {
+			return err
+		}
 	}
+	var patterns []patternEntry
+	if version >= 5 {
+		var err error
+		if patterns, err = readPatternSection(br, failTransLen); err != nil {
+			return err
+		}
+	}
+	var opts options
+	if version >= 6 {
+		var err error
+		if opts, err = readOptions(br, dict); err != nil {
+			return err
+		}
+	}
+
+	// The payload is complete; reading on must hit a clean end of stream.
+	// This is also what makes the gzip reader verify its trailer, so a
+	// stream cut inside the checksum or carrying trailing data is
+	// rejected rather than silently accepted.
+	if err := expectEOF(br); err != nil {
+		return err
+	}
+
+	// The stream checked out; only now is trie replaced, keeping the
+	// memory of its old tables for the new ones.
+	if reuse {
+		failTrans = trie.failTrans[:0]
+		sr := bytes.NewReader(staged)
+		for i := uint64(0); i < failTransLen; i++ {
+			failTrans = append(failTrans, [256]uint32{})
+			if err := readDeltaRow(sr, &root, &failTrans[i]); err != nil {
+				return err
+			}
+		}
+	}
+	// A reused class table's memory is handed back only if one is built.
+	classBuf := trie.failTransC[:0]
+	*trie = Trie{
+		failTrans:     failTrans,
+		dict:          dict,
+		dictLink:      dictLink,
+		pattern:       pattern,
+		values:        values,
+		patterns:      patterns,
+		wholeWord:     opts.wholeWord,
+		collapseSpace: opts.collapseSpace,
+		endAnchored:   opts.endAnchored,
+		failLink:      opts.failLink,
+		keepFail:      opts.failLink != nil,
+		dictPat:       trie.dictPat[:0],
+		failTrans16:   trie.failTrans16[:0],
+	}
+	trie.bufPool = newBufPool(trie, 0)
 	// Rebuild the derived acceleration tables (dictPat, failTrans16, root
 	// skip); they are recomputed on decode, not stored in the wire format.
 	trie.addOutputFlags()
 	trie.buildRootSkip()
 	trie.buildFailTrans16()
-	if trie.classTableUsable() {
+	if trie.classTableWanted() {
 		// The maxStates contract prices decode memory in failTrans rows:
 		// 1 KiB per state, at most maxStates states. failTransC is on
 		// top of that, so build it only from budget the cap leaves
@@ -254,10 +1095,65 @@ func (dec *decoder) decode(maxStates int) (*Trie, error) {
 		spare := uint64(maxStates) - failTransLen
 		if stride := classTableStride(live); stride != 0 &&
 			(spare >= failTransLen || uint64(stride*4)*failTransLen <= spare*1024) {
-			trie.buildClassTable(live)
+			trie.failTransC = classBuf
+			trie.buildClassRows(live)
 		}
 	}
 	trie.setStopEntry()
 	trie.buildSinglePattern()
-	return trie, nil
+	trie.compactASCII()
+	trie.frozen = true
+	return nil
+}
+
+// readUvarints fills dst with uvarints read from r, reporting values
+// that do not fit a uint32 as corrupt.
+func readUvarints(r io.ByteReader, dst []uint32) error {
+	for i := range dst {
+		v, err := readUvarint(r)
+		if err != nil {
+			return err
+		}
+		if v > math.MaxUint32 {
+			return fmt.Errorf("%w: table entry %d overflows uint32", ErrCorrupt, v)
+		}
+		dst[i] = uint32(v)
+	}
+	return nil
+}
+
+// readDeltaRow reads a version 2 failTrans row (see appendDeltaRow)
+// against root. Targets outside uint32 are reported as corrupt; the
+// caller checks the rest of the range.
+func readDeltaRow(r io.ByteReader, root, row *[256]uint32) error {
+	*row = *root
+	diff, err := readUvarint(r)
+	if err != nil {
+		return err
+	}
+	if diff > 256 {
+		return fmt.Errorf("%w: row lists %d entries", ErrCorrupt, diff)
+	}
+	b := uint64(0)
+	for k := uint64(0); k < diff; k++ {
+		gap, err := readUvarint(r)
+		if err != nil {
+			return err
+		}
+		if gap > 255 || b+gap > 255 {
+			return fmt.Errorf("%w: row entry past byte 255", ErrCorrupt)
+		}
+		b += gap
+		u, err := readUvarint(r)
+		if err != nil {
+			return err
+		}
+		v := int64(root[b]) + (int64(u>>1) ^ -int64(u&1))
+		if v < 0 || v > math.MaxUint32 {
+			return fmt.Errorf("%w: transition delta %d out of range", ErrCorrupt, v-int64(root[b]))
+		}
+		row[b] = uint32(v)
+		b++
+	}
+	return nil
 }
@@ -0,0 +1,63 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// BenchmarkEncodedSize reports the serialized size of real dictionaries
+// in both wire formats as a bytes/trie metric; the timing measures the
+// encode itself.
+func BenchmarkEncodedSize(b *testing.B) {
+	patterns, _ := pubLoad(b)
+	for _, n := range []int{1000, 10000, 100000} {
+		trie := NewTrieBuilder().AddStrings(patterns[:n]).Build()
+		b.Run(fmt.Sprintf("v1/%d", n), func(b *testing.B) {
+			rows := plainRows(trie)
+			var size int
+			for i := 0; i < b.N; i++ {
+				size = encodeRaw(b, trie.dict, rows, trie.dictLink, trie.pattern).Len()
+			}
+			b.ReportMetric(float64(size), "bytes/trie")
+		})
+		b.Run(fmt.Sprintf("v2/%d", n), func(b *testing.B) {
+			var buf bytes.Buffer
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := Encode(&buf, trie); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(buf.Len()), "bytes/trie")
+		})
+	}
+}
+
+// BenchmarkDecodeReload reloads a 10k-pattern dictionary in a loop, as a
+// service picking up a new dictionary does, with Decode allocating fresh
+// tables each time and DecodeFrom reusing the previous ones.
+func BenchmarkDecodeReload(b *testing.B) {
+	patterns, _ := pubLoad(b)
+	data, err := EncodeBytes(NewTrieBuilder().AddStrings(patterns[:10000]).Build())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := DecodeBytes(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("DecodeFrom", func(b *testing.B) {
+		var tr Trie
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := tr.DecodeFrom(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -1,11 +1,17 @@
 package ahocorasick
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
+	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -87,7 +93,7 @@ func TestReadAndWriteTrie(t *testing.T) {
 
 // encodeRaw writes a trie stream from raw tables, bypassing Encode's
 // flag masking, so tests can construct corrupt payloads.
-func encodeRaw(t *testing.T, dict []uint32, failTrans [][256]uint32, dictLink, pattern []uint32) *bytes.Buffer {
+func encodeRaw(t testing.TB, dict []uint32, failTrans [][256]uint32, dictLink, pattern []uint32) *bytes.Buffer {
 	t.Helper()
 	var buf bytes.Buffer
 	w := gzip.NewWriter(&buf)
@@ -150,11 +156,12 @@ func TestEncodeStripsOutputFlags(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	r, err := gzip.NewReader(&buf)
+	zr, err := gzip.NewReader(&buf)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer r.Close()
+	defer zr.Close()
+	r := bufio.NewReader(zr)
 
 	var lens [4]uint64
 	for i := range lens {
@@ -166,13 +173,25 @@ func TestEncodeStripsOutputFlags(t *testing.T) {
 	if err := binary.Read(r, binary.LittleEndian, dict); err != nil {
 		t.Fatal(err)
 	}
-	flat := make([]uint32, lens[1]*256)
-	if err := binary.Read(r, binary.LittleEndian, flat); err != nil {
+	// Rows are read back without Decode's range check, so a flag bit
+	// surviving into the stream shows up here.
+	var root [256]uint32
+	if err := readUvarints(r, root[:]); err != nil {
 		t.Fatal(err)
 	}
-	for i, v := range flat {
-		if v&outputFlag != 0 {
-			t.Fatalf("serialized transition %d carries outputFlag: %#x", i, v)
+	rows := [][256]uint32{root}
+	for s := uint64(1); s < lens[1]; s++ {
+		var row [256]uint32
+		if err := readDeltaRow(r, &root, &row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	for s, row := range rows {
+		for b, v := range row {
+			if v&outputFlag != 0 {
+				t.Fatalf("serialized transition %d/%d carries outputFlag: %#x", s, b, v)
+			}
 		}
 	}
 }
@@ -356,3 +375,591 @@ func TestEncodeDeterministic(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeErrorKinds(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"or", "amet"}).Build()
+	var enc bytes.Buffer
+	if err := Encode(&enc, trie); err != nil {
+		t.Fatal(err)
+	}
+	full := enc.Bytes()
+
+	// Every proper prefix of a valid stream is truncated, including one
+	// cut inside the gzip trailer.
+	for _, n := range []int{0, 1, 5, 12, len(full) / 2, len(full) - 9, len(full) - 1} {
+		_, err := Decode(bytes.NewReader(full[:n]))
+		if !errors.Is(err, ErrTruncated) {
+			t.Errorf("prefix of %d/%d bytes: expected ErrTruncated, got %v", n, len(full), err)
+		}
+	}
+
+	if _, err := Decode(bytes.NewReader([]byte("definitely not a gzip stream"))); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("garbage: expected ErrBadMagic, got %v", err)
+	}
+
+	var future bytes.Buffer
+	w := gzip.NewWriter(&future)
+	w.Extra = formatExtra(formatVersion + 1)
+	w.Write(make([]byte, 64))
+	w.Close()
+	if _, err := Decode(&future); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("future version: expected ErrUnsupportedVersion, got %v", err)
+	}
+
+	if _, err := Decode(bytes.NewReader(append(full[:len(full):len(full)], 0x1f, 0x8b, 0))); err == nil {
+		t.Error("trailing bytes: expected an error")
+	}
+
+	bad := encodeRaw(t, []uint32{0, 0}, [][256]uint32{{}, {0: 7}}, []uint32{0, 0}, []uint32{0, 0})
+	if _, err := Decode(bad); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("out-of-range transition: expected ErrCorrupt, got %v", err)
+	}
+
+	// Version 2 rows: an entry past byte 255, a delta below state 0, and
+	// a varint longer than 64 bits.
+	for name, row := range map[string][]byte{
+		"gap":      {1, 0xac, 0x02, 0},
+		"delta":    {1, 0, 3},
+		"overflow": bytes.Repeat([]byte{0xff}, 11),
+	} {
+		var v2 bytes.Buffer
+		w := gzip.NewWriter(&v2)
+		w.Extra = formatExtra(2)
+		for _, n := range []uint64{2, 2, 2, 2} {
+			binary.Write(w, binary.LittleEndian, n)
+		}
+		w.Write([]byte{0, 0})                 // dict
+		w.Write(bytes.Repeat([]byte{1}, 256)) // root row: all to root
+		w.Write(row)                          // state 0
+		w.Close()
+		if _, err := Decode(&v2); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("version 2 %s: expected ErrCorrupt, got %v", name, err)
+		}
+	}
+}
+
+// TestDecodeUnversionedStream verifies streams written before the format
+// version was recorded (no gzip extra field) still decode as version 1.
+func TestDecodeUnversionedStream(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"or", "amet"}).Build()
+	buf := encodeRaw(t, trie.dict, plainRows(trie), trie.dictLink, trie.pattern)
+	decoded, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testTrie(decoded); err != nil {
+		t.Error(err)
+	}
+}
+
+// plainRows returns trie's transition rows with the in-memory flag bits
+// masked off, as the wire format stores them.
+func plainRows(trie *Trie) [][256]uint32 {
+	rows := make([][256]uint32, trie.NumStates())
+	var row [256]uint32
+	for s := range rows {
+		for b, v := range trie.row(uint32(s), &row) {
+			rows[s][b] = v & stateMask
+		}
+	}
+	return rows
+}
+
+// TestEncodeDeltaRoundTrip verifies a version 2 stream of a real
+// dictionary decodes to the same tables and matches as the built trie,
+// and as a version 1 stream of the same trie.
+func TestEncodeDeltaRoundTrip(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen, err := os.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trie := NewTrieBuilder().AddStrings(patterns[:20000]).Build()
+
+	var v2 bytes.Buffer
+	if err := Encode(&v2, trie); err != nil {
+		t.Fatal(err)
+	}
+	rows := plainRows(trie)
+	v1 := encodeRaw(t, trie.dict, rows, trie.dictLink, trie.pattern)
+	if v2.Len() >= v1.Len() {
+		t.Errorf("version 2 stream is %d bytes, version 1 is %d", v2.Len(), v1.Len())
+	}
+
+	want := triplesFromMatches(trie.Match(ibsen))
+	for name, buf := range map[string]*bytes.Buffer{"v1": v1, "v2": &v2} {
+		decoded, err := Decode(buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := plainRows(decoded)
+		for s := range rows {
+			if rows[s] != got[s] {
+				t.Fatalf("%s: failTrans row %d differs after round trip", name, s)
+			}
+		}
+		if i := diffTriples(triplesFromMatches(decoded.Match(ibsen)), want); i >= 0 {
+			t.Errorf("%s: matches differ from the built trie at %d", name, i)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, trie := range map[string]*Trie{
+		"dictionary": NewTrieBuilder().AddStrings(patterns[:10000]).Build(),
+		"alphabet":   NewTrieBuilder().SetAlphabet([]byte("abc")).AddStrings([]string{"ab", "xab", "bc"}).Build(),
+		"single":     NewTrieBuilder().AddString("amet").Build(),
+	} {
+		if err := trie.Validate(); err != nil {
+			t.Errorf("%s: built trie fails validation: %v", name, err)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, trie); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(&buf); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// A pattern longer than any input reaching its state decodes, since
+	// every index is in range, but would slice before the input's start.
+	trie := NewTrieBuilder().AddStrings([]string{"or", "amet"}).Build()
+	dict := append([]uint32(nil), trie.dict...)
+	for s := range dict {
+		if dict[s] == 2 {
+			dict[s] = 9
+		}
+	}
+	blob := encodeRaw(t, dict, plainRows(trie), trie.dictLink, trie.pattern).Bytes()
+	if _, err := Decode(bytes.NewReader(blob)); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if _, err := Load(bytes.NewReader(blob)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("long pattern: expected ErrCorrupt, got %v", err)
+	}
+
+	if _, err := Load(bytes.NewReader([]byte("not a trie"))); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("garbage: expected ErrBadMagic, got %v", err)
+	}
+}
+
+func TestEncodeValues(t *testing.T) {
+	trie := NewTrieBuilder().
+		AddPatternWithValue([]byte("/api"), []byte("backend")).
+		AddString("/static").
+		AddPatternWithValue([]byte("/admin"), []byte{}).
+		AddPatternWithValue([]byte("/health"), 42).
+		Build()
+	if v, ok := trie.Value(3).(int); !ok || v != 42 {
+		t.Errorf("built: expected value 42, got %v", trie.Value(3))
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, trie); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[uint32]any{0: []byte("backend"), 1: nil, 2: []byte{}, 3: nil} {
+		got := decoded.Value(id)
+		if b, ok := want.([]byte); ok {
+			if g, ok := got.([]byte); !ok || !bytes.Equal(g, b) {
+				t.Errorf("pattern %d: expected %q, got %v", id, b, got)
+			}
+		} else if got != nil {
+			t.Errorf("pattern %d: expected no value, got %v", id, got)
+		}
+	}
+	ms := decoded.MatchString("GET /api/users")
+	if len(ms) != 1 || string(decoded.Value(ms[0].Pattern()).([]byte)) != "backend" {
+		t.Errorf("expected /api with value backend, got %v", ms)
+	}
+
+	// A stream cut inside the values section is truncated.
+	buf.Reset()
+	if err := EncodeWithoutPatterns(&buf, trie); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cut bytes.Buffer
+	w := gzip.NewWriter(&cut)
+	w.Extra = formatExtra(3)
+	w.Write(payload[:len(payload)-3])
+	w.Close()
+	if _, err := Decode(&cut); !errors.Is(err, ErrTruncated) {
+		t.Errorf("cut values: expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestEncodeWithByteOrder(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).Build()
+	want := triplesFromMatches(trie.MatchString("ushers and his"))
+
+	var payloads [][]byte
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var buf bytes.Buffer
+		if err := EncodeWithByteOrder(&buf, trie, order); err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := order.Uint64(payload); n != uint64(len(trie.dict)) {
+			t.Errorf("%v: header declares %d states, want %d", order, n, len(trie.dict))
+		}
+		payloads = append(payloads, payload)
+
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		if i := diffTriples(triplesFromMatches(decoded.MatchString("ushers and his")), want); i >= 0 {
+			t.Errorf("%v: matches differ from the built trie at %d", order, i)
+		}
+	}
+	if bytes.Equal(payloads[0], payloads[1]) {
+		t.Error("byte orders produced identical payloads")
+	}
+
+	if err := EncodeWithByteOrder(io.Discard, trie, nil); err == nil {
+		t.Error("nil byte order: expected an error")
+	}
+
+	var bad bytes.Buffer
+	w := gzip.NewWriter(&bad)
+	w.Extra = formatExtra(formatVersion, 7)
+	w.Write(make([]byte, 64))
+	w.Close()
+	if _, err := Decode(&bad); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("unknown byte order: expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestEncodePatterns(t *testing.T) {
+	tb := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"})
+	tb.AddPatternWithID([]byte("\x00\xff"), 9)
+	trie := tb.Build()
+	want := trie.Patterns()
+
+	for name, encode := range map[string]func(io.Writer, *Trie) error{
+		"stored":  Encode,
+		"omitted": EncodeWithoutPatterns,
+	} {
+		var buf bytes.Buffer
+		if err := encode(&buf, trie); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		decoded, err := Load(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if stored := decoded.patterns != nil; stored != (name == "stored") {
+			t.Errorf("%s: stored patterns = %v", name, stored)
+		}
+		if got := decoded.Patterns(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+
+	// A stored list that disagrees with the automaton fails Validate.
+	var buf bytes.Buffer
+	if err := Encode(&buf, trie); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, alter := range map[string]func([]patternEntry) []patternEntry{
+		"other id":  func(es []patternEntry) []patternEntry { es[0].id += 100; return es },
+		"reordered": func(es []patternEntry) []patternEntry { es[0], es[1] = es[1], es[0]; return es },
+		"dropped":   func(es []patternEntry) []patternEntry { return es[1:] },
+		"prefix":    func(es []patternEntry) []patternEntry { es[3].p = es[3].p[:2]; return es },
+	} {
+		stored := decoded.patterns
+		decoded.patterns = alter(slices.Clone(stored))
+		if err := decoded.Validate(); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected ErrCorrupt, got %v", name, err)
+		}
+		decoded.patterns = stored
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Errorf("stored patterns: %v", err)
+	}
+}
+
+func TestEncodeOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		tb    *TrieBuilder
+		input string
+	}{
+		{"whole word", NewTrieBuilder().AddString("cat").SetWholeWord(true), "cats, a cat"},
+		{"collapse", NewTrieBuilder().SetCollapseWhitespace(true).AddString("a b"), "a  b, a\tb"},
+		{"end anchored", NewTrieBuilder().AddPatternEndAnchored([]byte(".log")).AddString("app"), "app.log.gz app.log"},
+		{"fail links", NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).SetKeepFailLinks(true), "ushers"},
+	} {
+		trie := tc.tb.Build()
+		data, err := EncodeBytes(trie)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		decoded, err := DecodeBytes(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		want := triplesFromMatches(trie.MatchString(tc.input))
+		if i := diffTriples(triplesFromMatches(decoded.MatchString(tc.input)), want); i >= 0 {
+			t.Errorf("%s: decoded matches differ from the built trie at %d", tc.name, i)
+		}
+		if !trie.Equal(decoded) || !slices.Equal(decoded.failLink, trie.failLink) {
+			t.Errorf("%s: decoded trie differs from the built one", tc.name)
+		}
+	}
+
+	// Options this package cannot honor are corrupt: an unknown bit, and
+	// an anchor on state 0, which matches no pattern, and a failure link
+	// past the last state. Each is the last byte of the payload.
+	for _, tc := range []struct {
+		name string
+		tb   *TrieBuilder
+		last byte
+	}{
+		{"unknown option", NewTrieBuilder().AddString("cat"), 0x40},
+		{"anchored state", NewTrieBuilder().AddPatternEndAnchored([]byte("cat")), 0},
+		{"fail link", NewTrieBuilder().AddString("cat").SetKeepFailLinks(true), 0x7f},
+	} {
+		data, err := EncodeBytes(tc.tb.Build())
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload[len(payload)-1] = tc.last
+		var bad bytes.Buffer
+		w := gzip.NewWriter(&bad)
+		w.Extra = zr.Extra
+		w.Write(payload)
+		w.Close()
+		if _, err := Decode(&bad); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected ErrCorrupt, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestTrieEqual(t *testing.T) {
+	original := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).Build()
+	var buf bytes.Buffer
+	if err := Encode(&buf, original); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !original.Equal(decoded) || !decoded.Equal(original) {
+		t.Error("decoded trie is not Equal to the original")
+	}
+
+	for name, other := range map[string]*Trie{
+		"extra pattern": NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers", "x"}).Build(),
+		"other ids":     NewTrieBuilder().AddStrings([]string{"she", "he", "his", "hers"}).Build(),
+		"nil":           nil,
+	} {
+		if original.Equal(other) {
+			t.Errorf("%s: expected not Equal", name)
+		}
+	}
+}
+
+func TestEncodeBytes(t *testing.T) {
+	original := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).Build()
+	data, err := EncodeBytes(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, original); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Error("EncodeBytes differs from Encode")
+	}
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !original.Equal(decoded) {
+		t.Error("DecodeBytes trie is not Equal to the original")
+	}
+	if _, err := DecodeBytes(data[:len(data)/2]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("truncated input: got %v, want ErrTruncated", err)
+	}
+	if _, err := EncodeBytes(NewTrieBuilder().AddString("x").BuildMinimized()); err == nil {
+		t.Error("EncodeBytes accepted a minimized trie")
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers"}).Build()
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var buf bytes.Buffer
+		if err := EncodeWithByteOrder(&buf, trie, order); err != nil {
+			t.Fatal(err)
+		}
+		h, err := DecodeHeader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Header{Version: formatVersion, ByteOrder: order, States: trie.NumStates(), Patterns: 4}
+		if h != want {
+			t.Errorf("%v: got %+v, want %+v", order, h, want)
+		}
+	}
+
+	v1 := encodeRaw(t, trie.dict, plainRows(trie), trie.dictLink, trie.pattern)
+	if h, err := DecodeHeader(v1); err != nil || h.Version != 1 || h.Patterns != 4 {
+		t.Errorf("version 1 stream: got %+v, %v", h, err)
+	}
+
+	data, err := EncodeBytes(trie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeHeader(bytes.NewReader(data[:20])); !errors.Is(err, ErrTruncated) {
+		t.Errorf("truncated stream: got %v, want ErrTruncated", err)
+	}
+	if _, err := DecodeHeader(bytes.NewReader([]byte("not a trie"))); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("garbage: got %v, want ErrBadMagic", err)
+	}
+}
+
+func TestEncodeLevel(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trie := NewTrieBuilder().AddStrings(patterns[:5000]).Build()
+	sizes := make(map[int]int)
+	for _, level := range []int{gzip.BestSpeed, gzip.BestCompression, gzip.HuffmanOnly, gzip.DefaultCompression} {
+		var buf bytes.Buffer
+		if err := EncodeLevel(&buf, trie, level); err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		sizes[level] = buf.Len()
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if !trie.Equal(decoded) {
+			t.Errorf("level %d: decoded trie differs", level)
+		}
+	}
+	if sizes[gzip.BestCompression] > sizes[gzip.BestSpeed] {
+		t.Errorf("BestCompression wrote %d bytes, BestSpeed %d", sizes[gzip.BestCompression], sizes[gzip.BestSpeed])
+	}
+
+	for _, level := range []int{-3, 10} {
+		var buf bytes.Buffer
+		if err := EncodeLevel(&buf, trie, level); err == nil || buf.Len() != 0 {
+			t.Errorf("level %d: got error %v after %d bytes", level, err, buf.Len())
+		}
+	}
+}
+
+func TestDecodeFrom(t *testing.T) {
+	// small is ASCII, so compact; the others keep the full table, whose
+	// memory DecodeFrom reuses.
+	small := NewTrieBuilder().AddStrings([]string{"he", "she"}).Build()
+	large := NewTrieBuilder().AddStrings([]string{"he", "she", "his", "hers", "ushers", "h\xe9"}).SetWholeWord(true).Build()
+	encode := func(tr *Trie) []byte {
+		data, err := EncodeBytes(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	// Past failTrans16's range, so the byte-class table is rebuilt too.
+	var words []string
+	rng := rand.New(rand.NewSource(1))
+	words = append(words, "caf\xc3\xa9")
+	for len(words) < 6000 {
+		w := make([]byte, 10)
+		for i := range w {
+			w[i] = 'a' + byte(rng.Intn(20))
+		}
+		words = append(words, string(w))
+	}
+	huge := NewTrieBuilder().AddStrings(words).Build()
+	if huge.failTransC == nil {
+		t.Fatal("test trie has no class table")
+	}
+
+	// A version 1 stream has no root row to stage rows against.
+	v1 := encodeRaw(t, large.dict, plainRows(large), large.dictLink, large.pattern).Bytes()
+
+	var tr Trie
+	for _, data := range [][]byte{encode(large), encode(small), encode(huge), v1, encode(large), encode(huge), encode(huge)} {
+		before := tr.failTrans[:cap(tr.failTrans)]
+		if err := tr.DecodeFrom(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		want, err := DecodeBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tr.Equal(want) || !tr.IsReadOnly() {
+			t.Fatalf("DecodeFrom differs from Decode")
+		}
+		if got, want := fmt.Sprint(tr.MatchString("ushers his")), fmt.Sprint(want.MatchString("ushers his")); got != want {
+			t.Errorf("matches %s, want %s", got, want)
+		}
+		if len(tr.failTrans) != 0 && len(before) >= len(tr.failTrans) && &before[0] != &tr.failTrans[0] {
+			t.Error("a large enough transition table was not reused")
+		}
+	}
+
+	// A failed DecodeFrom leaves tr as it was, including when the stream
+	// breaks only after every transition row was read.
+	data := encode(large)
+	for _, bad := range [][]byte{[]byte("not a trie"), data[:len(data)-4]} {
+		if err := tr.DecodeFrom(bytes.NewReader(bad)); err == nil {
+			t.Fatal("DecodeFrom accepted a bad stream")
+		}
+		if !tr.Equal(huge) || !tr.IsReadOnly() {
+			t.Fatal("a failed DecodeFrom changed the Trie")
+		}
+		if got, want := fmt.Sprint(tr.MatchString(words[0])), fmt.Sprint(huge.MatchString(words[0])); got != want {
+			t.Errorf("after a failed DecodeFrom: matches %s, want %s", got, want)
+		}
+	}
+}
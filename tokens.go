@@ -0,0 +1,35 @@
+package ahocorasick
+
+// MatchTokens splits input into tokens at every byte isDelim reports
+// true for and returns, in input order, the tokens that are patterns:
+// a match must cover a whole token, so "cat" matches the input
+// "cat category" once. A nil isDelim splits at ASCII white space.
+//
+// The automaton restarts from the root at each token and looks at its
+// output only at the token's end, so the scan is one table step per
+// byte with no match filtering, cheaper than whole-word matching when
+// tokens are delimited up front. An end-anchored pattern matches only
+// the last token, and only when no delimiter follows it; white space
+// collapsing plays no part.
+func (tr *Trie) MatchTokens(input []byte, isDelim func(byte) bool) []*Match {
+	if isDelim == nil {
+		isDelim = isSpaceByte
+	}
+	var spans []span
+	s, start := rootState, 0
+	for i := 0; i <= len(input); i++ {
+		if i < len(input) && !isDelim(input[i]) {
+			s = tr.next(s, input[i]) & stateMask
+			continue
+		}
+		// The state after a token is the longest suffix of it that is a
+		// trie node; its own output has the token's length only when
+		// that suffix is the whole token.
+		if n := uint32(i - start); n != 0 && tr.dict[s] == n &&
+			(tr.endAnchored == nil || !tr.endAnchored[s] || i == len(input)) {
+			spans = append(spans, span{start: uint32(start), end: uint32(i), pattern: tr.pattern[s]})
+		}
+		s, start = rootState, i+1
+	}
+	return tr.pooledMatches(input, spans)
+}
@@ -0,0 +1,37 @@
+package ahocorasick
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestMatchTokens(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"cat", "at", "dog"}).Build()
+	tokens := func(input string, isDelim func(byte) bool) []string {
+		matches := trie.MatchTokens([]byte(input), isDelim)
+		defer trie.ReleaseMatches(matches)
+		var out []string
+		for _, m := range matches {
+			out = append(out, fmt.Sprintf("%s@%d", m.Match(), m.Pos()))
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		input string
+		want  []string
+	}{
+		{"cat category", []string{"cat@0"}},
+		{"  cat\tat\n", []string{"cat@2", "at@6"}},
+		{"dogcat", nil},
+		{"", nil},
+	} {
+		if got := tokens(tc.input, nil); !slices.Equal(got, tc.want) {
+			t.Errorf("MatchTokens(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+	comma := func(c byte) bool { return c == ',' }
+	if got, want := tokens("dog,cat dog,at", comma), []string{"dog@0", "at@12"}; !slices.Equal(got, want) {
+		t.Errorf("comma-delimited: got %q, want %q", got, want)
+	}
+}
@@ -5,10 +5,19 @@ import (
 	"encoding/binary"
 	"math/bits"
 	"runtime"
+	"slices"
 	"sync"
 	"unsafe"
 )
 
+// State ids. nilState is never a real state: it is the "no state"
+// sentinel ending failure-link and dictLink chains, and index 0 of every
+// table is a placeholder (no pattern, no link, and a transition row
+// sending every byte to the root, so even a stray 0 recovers). rootState
+// is the root. A byte with no goto edge anywhere up the failure chain
+// leads back to the root, so the root loops to itself on every byte that
+// starts no pattern: unmatched input leaves the automaton at the root,
+// ready for the next match, never stuck.
 const (
 	rootState uint32 = 1
 	nilState  uint32 = 0
@@ -22,7 +31,18 @@ const (
 )
 
 // Trie represents a trie of patterns with extra links as per the Aho-Corasick algorithm.
+//
+// A Trie is read-only once Build or Decode returns it (see IsReadOnly):
+// no method but DecodeFrom writes its tables, so any number of goroutines
+// may match against one Trie concurrently. DecodeFrom replaces the tables
+// wholesale and needs the Trie to itself. The only state that changes
+// otherwise is internally synchronized: the pool of result buffers
+// behind ReleaseMatches and the table MatchSkip builds once on first use.
 type Trie struct {
+	// failTrans is the full transition table, one row per state; nil on
+	// a compact Trie (see IsCompact), which keeps only failTrans16 or
+	// failTransC. Code outside the scan loops reads transitions through
+	// next and row, which serve either.
 	failTrans [][256]uint32
 
 	dict     []uint32
@@ -56,6 +76,10 @@ type Trie struct {
 	// chunk maxLen-1 bytes early so boundary-spanning matches are found.
 	maxLen uint32
 
+	// patternStates is the number of states that emit a pattern of
+	// their own (see NumPatterns).
+	patternStates uint32
+
 	// failTrans16 is a half-width copy of failTrans used by the match
 	// loops when every state id fits in 15 bits (bit 15 carries the
 	// output flag). Rows are 512B instead of 1KB, halving the cache
@@ -108,7 +132,221 @@ type Trie struct {
 	singleO1   int
 	singleO2   int
 
+	// priority holds each pattern state's AddPatternWithPriority
+	// priority for MatchByPriority; nil when no pattern has one.
+	priority []int
+
 	bufPool sync.Pool // Pool of *matchBuf
+
+	// poolDebug quarantines released match buffers (see
+	// TrieBuilder.SetPoolDebug).
+	poolDebug bool
+
+	// skip is MatchSkip's shift table, built once on first use.
+	skipOnce sync.Once
+	skip     *skipTable
+
+	// approx holds MatchApprox's index for each mismatch budget used up
+	// to maxCachedApproxK, keyed by int.
+	approx sync.Map
+
+	// depth is gotoTree's depth table, built once on first use by
+	// Descend and MatchSkip.
+	depthOnce sync.Once
+	depth     []uint32
+
+	// failLink is FailLink's table, kept by Build or Decode when
+	// keepFail is set (see TrieBuilder.SetKeepFailLinks) and otherwise
+	// built once on first use.
+	failOnce sync.Once
+	failLink []uint32
+	keepFail bool
+
+	// ids is PatternIDs' list, built once on first use; denseIDs is set
+	// when it is 0 through len(ids)-1, so an id is its own index.
+	idsOnce  sync.Once
+	ids      []uint32
+	denseIDs bool
+
+	// ascii is IsASCII's answer, computed once on first use.
+	asciiOnce sync.Once
+	ascii     bool
+
+	// values maps pattern ids to AddPatternWithValue values; nil when
+	// no pattern has one.
+	values map[uint32]any
+
+	// text holds every pattern as added, back to back, and textRefs
+	// locates each one, sorted by id, for Match.PatternBytes; both are
+	// nil unless the Trie was built with SetKeepPatternText.
+	text     []byte
+	textRefs []textRef
+
+	// textLink, set alongside text, is a bare match buffer naming the
+	// Trie, which the Matches made outside the pool carry in their buf
+	// field for PatternBytes; nil without text.
+	textLink *matchBuf
+
+	// endAnchored marks the pattern states that match only at the end
+	// of the input (see TrieBuilder.AddPatternEndAnchored); nil when
+	// none do.
+	endAnchored []bool
+
+	// wholeWord restricts matches to whole words (see
+	// TrieBuilder.SetWholeWord).
+	wholeWord bool
+
+	// collapseSpace matches with white space runs collapsed (see
+	// TrieBuilder.SetCollapseWhitespace).
+	collapseSpace bool
+
+	// utf8Policy is MatchUTF8's handling of invalid UTF-8 (see
+	// TrieBuilder.SetInvalidUTF8Policy).
+	utf8Policy InvalidUTF8Policy
+
+	// minimized is set by BuildMinimized, whose merged states no longer
+	// form a tree; patterns is what Patterns recovered before merging.
+	minimized bool
+	patterns  []patternEntry
+
+	// frozen is set as Build or Decode returns; every table above is
+	// final from then on.
+	frozen bool
+}
+
+// Value returns the value the pattern with the given id was added with
+// (see TrieBuilder.AddPatternWithValue), or nil if it has none.
+func (tr *Trie) Value(pattern uint32) any {
+	return tr.values[pattern]
+}
+
+// ValueAs is Value for patterns whose values share one type, such as a
+// category enum: it returns the value of the pattern with the given id
+// as a T, and false, with T's zero value, when the pattern has no value
+// or one of another type. A decoded Trie keeps only []byte values.
+//
+//	switch cat, _ := ValueAs[Category](trie, m.Pattern()); cat {
+//	case Secret:
+//		...
+//	}
+func ValueAs[T any](tr *Trie, pattern uint32) (T, bool) {
+	v, ok := tr.values[pattern].(T)
+	return v, ok
+}
+
+// Equal reports whether tr and other are the same automaton: identical
+// transition, output-length, pattern-id, and output-link tables, so
+// with the same settings they report the same matches for every input.
+// It is true for a Trie and its Encode/Decode round trip.
+// Pattern values and priorities, the whole-word and white space
+// settings, and the match buffer pools are not compared.
+func (tr *Trie) Equal(other *Trie) bool {
+	if tr == other {
+		return true
+	}
+	if tr == nil || other == nil {
+		return false
+	}
+	if !slices.Equal(tr.dict, other.dict) ||
+		!slices.Equal(tr.pattern, other.pattern) ||
+		!slices.Equal(tr.dictLink, other.dictLink) {
+		return false
+	}
+	if tr.failTrans != nil && other.failTrans != nil {
+		return slices.Equal(tr.failTrans, other.failTrans)
+	}
+	var a, b [256]uint32
+	for s := range uint32(tr.NumStates()) {
+		if *tr.row(s, &a) != *other.row(s, &b) {
+			return false
+		}
+	}
+	return true
+}
+
+// tableBytes returns the bytes held by tr's tables, as
+// TrieBuilder.EstimateBuildBytes prices them.
+func (tr *Trie) tableBytes() int {
+	return len(tr.failTrans)*256*4 +
+		(len(tr.dict)+len(tr.pattern)+len(tr.dictLink))*4 +
+		len(tr.dictPat)*8 + len(tr.priority)*8 + len(tr.endAnchored) +
+		len(tr.text) + len(tr.textRefs)*12 + len(tr.failLink)*4 +
+		len(tr.failTrans16)*2 + len(tr.failTransC)*4
+}
+
+// IsReadOnly reports whether tr was produced by Build or Decode (or
+// Compile, Load, or a DecodeFrom that succeeded), after which it is
+// safe for concurrent use: its tables change only if DecodeFrom is
+// called on tr, which its caller must own exclusively for the call. A
+// zero Trie, which cannot match, reports false.
+func (tr *Trie) IsReadOnly() bool {
+	return tr.frozen
+}
+
+// IsASCII reports whether the automaton only moves on ASCII bytes: every
+// byte of 0x80 and above sends every state back to the root, as it does
+// when all patterns are ASCII (and no byte transform maps a high byte
+// onto a pattern byte). Build, Decode, and BuildMinimized make such a
+// Trie compact (see IsCompact): the high bytes need no columns of their
+// own, so it keeps the half-width table alone or, past 32768 states, the
+// byte-class table, whose rows then hold at most 128 entries. The first
+// call scans the upper half of the transition table; later calls return
+// the cached answer.
+func (tr *Trie) IsASCII() bool {
+	tr.asciiOnce.Do(func() {
+		for s := range uint32(tr.NumStates()) {
+			for b := 0x80; b < 256; b++ {
+				if tr.next(s, byte(b)) != rootState {
+					return
+				}
+			}
+		}
+		tr.ascii = true
+	})
+	return tr.ascii
+}
+
+// IsCompact reports whether tr keeps its transitions only in a compact
+// table instead of the full one of 1 KiB per state: the half-width
+// table (512 bytes per state) for up to 32768 states, otherwise the
+// byte-class table, one 4-byte entry per state for each class of bytes
+// the patterns tell apart. ASCII tries are compact (see IsASCII), except
+// ones over 32768 states in which all 128 ASCII bytes occur, whose class
+// rows would be no narrower than half a full row; so are tries Compile
+// builds under a WithMaxDenseBytes budget the full table would exceed.
+// Decode keeps only ASCII tries compact. A compact Trie matches exactly
+// as the full table would, through every method.
+func (tr *Trie) IsCompact() bool {
+	return tr.failTrans == nil && len(tr.dict) != 0
+}
+
+// next returns the transition of state s on byte c as a failTrans entry
+// (the target state, with outputFlag when it emits), from whichever
+// table tr keeps. The scan loops read their tables directly; next
+// serves the paths that step through the automaton outside them.
+func (tr *Trie) next(s uint32, c byte) uint32 {
+	switch {
+	case tr.failTrans != nil:
+		return tr.failTrans[s][c]
+	case tr.failTrans16 != nil:
+		v := uint32(tr.failTrans16[s<<8|uint32(c)])
+		return v&^(1<<15) | v>>15<<31
+	default:
+		v := tr.failTransC[s<<tr.classShift|uint32(tr.classOf[c])]
+		return v>>tr.classShift | v<<31
+	}
+}
+
+// row returns state s's failTrans row: the row itself, or on a compact
+// Trie buf, filled from the compact table.
+func (tr *Trie) row(s uint32, buf *[256]uint32) *[256]uint32 {
+	if tr.failTrans != nil {
+		return &tr.failTrans[s]
+	}
+	for b := range buf {
+		buf[b] = tr.next(s, byte(b))
+	}
+	return buf
 }
 
 // matchBuf holds the per-call scratch for Match, recycled through a
@@ -121,10 +359,14 @@ type Trie struct {
 // are materialized in one pass afterwards, when the final count is
 // known, so the arena never reallocates under live pointers.
 type matchBuf struct {
+	tr    *Trie    // owner, for Match.PatternBytes
 	raw   []uint64 // pairs: end position, dictPat
 	raw2  []uint64 // second lane of the dual-cursor scan
 	ptrs  []*Match
 	arena []Match
+
+	// released marks a buffer quarantined by a SetPoolDebug release.
+	released bool
 }
 
 // reset prepares the buffer for reuse, keeping all allocated capacity.
@@ -158,8 +400,13 @@ func (b *matchBuf) sizeArena(n int) {
 // materializeSegment expands raw pairs into b.arena/b.ptrs starting at
 // index off, returning the index after the last entry written. The
 // arena must already be sized; segments written by different goroutines
-// are disjoint, so parallel calls are safe.
+// are disjoint, so parallel calls are safe. When the Trie keeps pattern
+// text, every Match links back to b, and through it to the Trie.
 func (b *matchBuf) materializeSegment(input []byte, raw []uint64, off int) int {
+	var link *matchBuf
+	if b.tr.textLink != nil {
+		link = b
+	}
 	for k := 0; k < len(raw)/2; k++ {
 		end := raw[2*k]
 		dp := raw[2*k+1]
@@ -169,7 +416,7 @@ func (b *matchBuf) materializeSegment(input []byte, raw []uint64, off int) int {
 		m.pos = pos
 		m.pattern = uint32(dp >> 32)
 		m.match = input[pos : uint32(end)+1]
-		m.buf = nil
+		m.buf = link
 		b.ptrs[off+k] = m
 	}
 	return off + len(raw)/2
@@ -182,9 +429,47 @@ func (b *matchBuf) materialize(input []byte) {
 	b.materializeSegment(input, b.raw, 0)
 }
 
-func newBufPool() sync.Pool {
+// newBufPool returns an empty match buffer pool for tr whose new buffers
+// are presized for n matches. Build and Decode do not warm it: a buffer is
+// allocated on a Trie's first Match and recycled from then on, so
+// short-lived or never-matched tries pay nothing for it.
+func newBufPool(tr *Trie, n int) sync.Pool {
 	return sync.Pool{
-		New: func() any { return new(matchBuf) },
+		New: func() any {
+			if n == 0 {
+				return &matchBuf{tr: tr}
+			}
+			return &matchBuf{
+				tr:    tr,
+				raw:   make([]uint64, 0, 2*n),
+				ptrs:  make([]*Match, 0, n),
+				arena: make([]Match, 0, n),
+			}
+		},
+	}
+}
+
+// applyByteTransform makes every row take byte b to where it took
+// xlat[b], so the scan loops apply SetByteTransform's transform with no
+// per-byte work. It rewrites failTrans and failTrans16 in place and must
+// run before the tables derived from them.
+func (tr *Trie) applyByteTransform(xlat *[256]byte) {
+	for s := range tr.failTrans {
+		row := &tr.failTrans[s]
+		orig := *row
+		for b, c := range xlat {
+			row[b] = orig[c]
+		}
+	}
+	if tr.failTrans16 != nil {
+		var orig [256]uint16
+		for i := 0; i < len(tr.failTrans16); i += 256 {
+			row16 := tr.failTrans16[i : i+256]
+			copy(orig[:], row16)
+			for b, c := range xlat {
+				row16[b] = orig[c]
+			}
+		}
 	}
 }
 
@@ -208,19 +493,36 @@ func (tr *Trie) addOutputFlags() {
 	tr.buildDictPat()
 }
 
+// reuseSlice returns s resliced to n zeroed entries when its capacity
+// allows, or a new slice, so DecodeFrom can rebuild tables in the memory
+// of the ones they replace. Build and Decode start from nil slices and
+// always allocate.
+func reuseSlice[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+	s = s[:n]
+	clear(s)
+	return s
+}
+
 // buildDictPat packs the per-state (pattern id, pattern length) pair
 // into one uint64 so the emit path loads both with a single access, and
 // records the longest pattern (the parallel scan's overlap width). The
 // builder fuses the output flags into its row DP and calls this
 // directly; the decode path reaches it through addOutputFlags.
 func (tr *Trie) buildDictPat() {
-	tr.dictPat = make([]uint64, len(tr.dict))
+	tr.dictPat = reuseSlice(tr.dictPat, len(tr.dict))
 	tr.maxLen = 0
+	tr.patternStates = 0
 	for s := range tr.dict {
 		tr.dictPat[s] = uint64(tr.pattern[s])<<32 | uint64(tr.dict[s])
 		if tr.dict[s] > tr.maxLen {
 			tr.maxLen = tr.dict[s]
 		}
+		if tr.dict[s] != 0 {
+			tr.patternStates++
+		}
 	}
 }
 
@@ -248,11 +550,12 @@ func packState16(v uint32) uint16 {
 // the halved cache footprint of the serial transition chain. Must run
 // after addOutputFlags (reads the flag bits).
 func (tr *Trie) buildFailTrans16() {
+	old := tr.failTrans16
 	tr.failTrans16 = nil
 	if len(tr.failTrans) > failTrans16MaxStates {
 		return
 	}
-	tr.failTrans16 = make([]uint16, len(tr.failTrans)*256)
+	tr.failTrans16 = reuseSlice(old, len(tr.failTrans)*256)
 	for s := range tr.failTrans {
 		for b := range 256 {
 			tr.failTrans16[s<<8+b] = packState16(tr.failTrans[s][b])
@@ -262,14 +565,22 @@ func (tr *Trie) buildFailTrans16() {
 
 // classTableUsable reports whether any scan path can consume failTransC.
 // Only the multi-stop table loops (matchDualTableC, scanRangeTableC) read
-// it: single-stop tries always take matchStopByte, and tries small enough
-// for failTrans16 use its half-width loops, so building the table for
-// either would retain up to classStrideMax*4 bytes per state that nothing
+// it: single-stop tries take matchStopByte, and tries small enough for
+// failTrans16 use its half-width loops, so building the table for either
+// would retain up to classStrideMax*4 bytes per state that nothing
 // loads. Valid only after buildRootSkip and buildFailTrans16 have run.
 func (tr *Trie) classTableUsable() bool {
 	return tr.failTrans16 == nil && len(tr.rootStopBytes) != 1
 }
 
+// classTableWanted reports whether Decode and BuildMinimized, which
+// rebuild the derived tables from the full one, build failTransC: for a
+// scan path that reads it (classTableUsable), or for compactASCII to
+// keep in place of failTrans.
+func (tr *Trie) classTableWanted() bool {
+	return tr.classTableUsable() || tr.failTrans16 == nil && tr.IsASCII()
+}
+
 // classStrideMax is the widest failTransC row buildClassTable accepts, in
 // entries. At half the full 256-entry row the compressed table stops
 // fitting meaningfully better in cache, so wider strides aren't built.
@@ -310,10 +621,20 @@ func classTableStride(live *[256]bool) int {
 // plain root and shares class 0. The builder passes the live set it
 // already knows; the decoder derives it with derivedLiveBytes.
 func (tr *Trie) buildClassTable(live *[256]bool) {
-	tr.failTransC = nil
 	if !tr.classTableUsable() {
+		tr.failTransC = nil
 		return
 	}
+	tr.buildClassRows(live)
+}
+
+// buildClassRows is buildClassTable without the scan-path check, for
+// tries that keep the class table in place of failTrans (see
+// compactASCII). It reuses failTransC's memory and leaves it nil when
+// the row would be too wide.
+func (tr *Trie) buildClassRows(live *[256]bool) {
+	old := tr.failTransC
+	tr.failTransC = nil
 	stride := classTableStride(live)
 	if stride == 0 {
 		return
@@ -350,7 +671,7 @@ func (tr *Trie) buildClassTable(live *[256]bool) {
 			liveList = append(liveList, b)
 		}
 	}
-	tr.failTransC = make([]uint32, len(tr.failTrans)*stride)
+	tr.failTransC = reuseSlice(old, len(tr.failTrans)*stride)
 	for s := range tr.failTrans {
 		row := &tr.failTrans[s]
 		crow := tr.failTransC[s<<shift : s<<shift+stride]
@@ -384,6 +705,17 @@ func (tr *Trie) derivedLiveBytes() *[256]bool {
 	return &live
 }
 
+// compactASCII drops failTrans from an ASCII Trie (see IsASCII) when
+// failTrans16 or failTransC can stand in for it. Decode and
+// BuildMinimized, which work on the full table, call it once the tables
+// derived from it are built; Build makes such tries compact without
+// building the full table at all.
+func (tr *Trie) compactASCII() {
+	if (tr.failTrans16 != nil || tr.failTransC != nil) && tr.IsASCII() {
+		tr.failTrans = nil
+	}
+}
+
 // setStopEntry caches the root transition on the single stop byte.
 // Must run after both buildRootSkip and buildFailTrans16.
 func (tr *Trie) setStopEntry() {
@@ -393,14 +725,15 @@ func (tr *Trie) setStopEntry() {
 	}
 }
 
-// buildRootSkip derives the root self-loop byte set from failTrans.
-// Must be called after failTrans is fully populated.
+// buildRootSkip derives the root self-loop byte set from the root's
+// transitions. Must be called after the transition table is fully
+// populated.
 func (tr *Trie) buildRootSkip() {
 	tr.rootStopBytes = nil
 	tr.skipBytes = nil
 	var stops []byte
 	for b := range 256 {
-		if tr.failTrans[rootState][b]&stateMask != rootState {
+		if tr.next(rootState, byte(b))&stateMask != rootState {
 			tr.rootStop[b] = 1
 			stops = append(stops, byte(b))
 		} else {
@@ -580,7 +913,22 @@ type WalkFn func(end, n, pattern uint32) bool
 
 // Walk runs the algorithm on a given output, calling the supplied callback function on every
 // match. The algorithm will terminate if the callback function returns false.
+//
+// Matches come in order of end position and, among matches ending at the same byte, longest
+// first. No sorting is involved: a state's output chain starts at its own pattern and follows
+// dictionary links, each to a proper suffix, so the order is built into the automaton.
 func (tr *Trie) Walk(input []byte, fn WalkFn) {
+	if tr.wholeWord {
+		fn = wordFilter(input, fn)
+	}
+	if tr.collapseSpace {
+		if norm, orig := collapseInput(input); orig != nil {
+			input, fn = norm, uncollapse(orig, fn)
+		}
+	}
+	if tr.endAnchored != nil {
+		fn = tr.anchorFilter(input, fn)
+	}
 	if tr.single != nil {
 		tr.walkSingle(input, fn)
 		return
@@ -593,6 +941,10 @@ func (tr *Trie) Walk(input []byte, fn WalkFn) {
 		}
 		return
 	}
+	if tr.failTrans == nil {
+		tr.walkTableC(input, fn)
+		return
+	}
 	if len(tr.rootStopBytes) == 1 {
 		tr.walkStopByte(input, fn)
 		return
@@ -600,6 +952,54 @@ func (tr *Trie) Walk(input []byte, fn WalkFn) {
 	tr.walkTable(input, fn)
 }
 
+// WalkSkipFn is the WalkSkip callback. It receives what a WalkFn does and
+// returns whether to continue and, optionally, where to resume: a skipTo
+// past end restarts the scan at input[skipTo] from the root, while any
+// skipTo <= end (such as 0) continues normally.
+type WalkSkipFn func(end, n, pattern uint32) (cont bool, skipTo uint32)
+
+// WalkSkip is Walk with a callback that can move the cursor forward. A
+// skip discards the automaton state along with any further matches
+// ending at end: scanning resumes at skipTo from the root, so no match
+// reported afterwards starts before skipTo. Returning end+1 after each
+// accepted match gives non-overlapping matches in a single pass. A skipTo
+// beyond the input ends the walk.
+func (tr *Trie) WalkSkip(input []byte, fn WalkSkipFn) {
+	scan, orig := input, []uint32(nil)
+	if tr.collapseSpace {
+		scan, orig = collapseInput(input)
+	}
+	for from := 0; from < len(scan); {
+		next := -1
+		tr.walkEmit(scan[from:], rootState, uint32(from), func(end, s uint32) bool {
+			start, stop := end+1-tr.dict[s], end+1
+			if tr.anchored(s) && int(stop) != len(scan) {
+				return true
+			}
+			if orig != nil {
+				start, stop = orig[start], orig[stop]
+			}
+			if !tr.keep(input, start, stop) {
+				return true
+			}
+			cont, skipTo := fn(stop-1, stop-start, tr.pattern[s])
+			if cont && skipTo >= stop {
+				next = int(min(skipTo, uint32(len(input))))
+				if orig != nil {
+					// Resume at the first collapsed byte from skipTo on.
+					next, _ = slices.BinarySearch(orig, uint32(next))
+				}
+				return false
+			}
+			return cont
+		})
+		if next < 0 {
+			return
+		}
+		from = next
+	}
+}
+
 // walkStopByte16 is walkStopByte on the half-width failTrans16 table,
 // with the same root-transition constant (stopEntry16) and raw pointer
 // loads as matchStopByte16. See matchStopByte for the offset shifts.
@@ -806,6 +1206,55 @@ func (tr *Trie) walkTable(input []byte, fn WalkFn) {
 	}
 }
 
+// walkTableC is walkTable on the class-compressed table, for compact
+// tries too large for failTrans16 (see IsCompact). The cursor is a
+// premultiplied row offset; see failTransC.
+func (tr *Trie) walkTableC(input []byte, fn WalkFn) {
+	ftBase := unsafe.Pointer(&tr.failTransC[0])
+	dpBase := unsafe.Pointer(&tr.dictPat[0])
+	dlBase := unsafe.Pointer(&tr.dictLink[0])
+	classOf := &tr.classOf
+	shift := tr.classShift
+
+	rootOff := uintptr(rootState) << shift
+	sOff := rootOff
+
+	inputLen := len(input)
+
+	// Root self-loop skip gated on stop-byte density measured inline; see
+	// walkTable.
+	skip := true
+	sampler := rootSkipSampler{budget: rootSkipSampleLen}
+
+	for i := 0; i < inputLen; i++ {
+		if skip && sOff == rootOff {
+			j := tr.skipRootTable(input, i)
+			if j < inputLen && sampler.observe(j-i) {
+				skip = false
+			}
+			i = j
+			if i == inputLen {
+				return
+			}
+		}
+
+		v := *(*uint32)(unsafe.Add(ftBase, (sOff+uintptr(classOf[input[i]]))<<2))
+		sOff = uintptr(v &^ 1)
+		if v&1 != 0 {
+			st := sOff >> shift
+			if dp := *(*uint64)(unsafe.Add(dpBase, st<<3)); uint32(dp) != 0 && !fn(uint32(i), uint32(dp), uint32(dp>>32)) {
+				return
+			}
+			for u := *(*uint32)(unsafe.Add(dlBase, st<<2)); u != nilState; u = *(*uint32)(unsafe.Add(dlBase, uintptr(u)<<2)) {
+				dp := *(*uint64)(unsafe.Add(dpBase, uintptr(u)<<3))
+				if !fn(uint32(i), uint32(dp), uint32(dp>>32)) {
+					return
+				}
+			}
+		}
+	}
+}
+
 // parallelChunk is the minimum bytes of input per worker goroutine;
 // below it, goroutine startup outweighs the scan work.
 const parallelChunk = 8 << 10
@@ -926,6 +1375,9 @@ func (tr *Trie) Match(input []byte) []*Match {
 	// differ from the whole input's), so a dense-verdict dispatch pays
 	// one whole-input sample here plus up to one chunk-local sample per
 	// worker inside matchParallel.
+	if tr.wholeWord || tr.collapseSpace || tr.endAnchored != nil {
+		return tr.matchWalk(input)
+	}
 	p, dense, denseKnown := tr.parallelWorkersDense(input, runtime.GOMAXPROCS(0))
 	if p > 0 {
 		return tr.matchParallel(input, p)
@@ -1312,6 +1764,16 @@ func (tr *Trie) matchSeqDense(input []byte, buf *matchBuf, dense, denseKnown boo
 		tr.matchStopByte16(input, buf)
 		return
 	}
+	if tr.failTrans == nil && tr.failTrans16 == nil {
+		// A compact Trie past failTrans16's reach keeps only the class
+		// table, whatever its stop bytes (see IsCompact).
+		if len(input) >= dualTableMin && int(tr.maxLen)*4 < len(input)/2 && tr.rootDense(input) {
+			tr.matchDualTableC(input, buf)
+		} else {
+			buf.raw = tr.scanRangeTableC(input, 0, len(input), rootState, 0, buf.raw)
+		}
+		return
+	}
 	if len(tr.rootStopBytes) == 1 {
 		tr.matchStopByte(input, buf)
 	} else if tr.failTrans16 != nil {
@@ -2204,14 +2666,60 @@ func (tr *Trie) MatchFirst(input []byte) *Match {
 
 	tr.Walk(input, func(end, n, pattern uint32) bool {
 		pos := end - n + 1
-		match = &Match{pos: pos, pattern: pattern, match: input[pos : pos+n]}
+		match = &Match{pos: pos, pattern: pattern, match: input[pos : pos+n], buf: tr.textLink}
 		return false
 	})
 
 	return match
 }
 
+// MatchNth returns the nth match (1-based) in walk order, or nil if input
+// has fewer than n matches or n < 1. Walk order is Match's order: by end
+// position, and among matches ending at the same byte, longest first.
+// The walk stops at the nth match and allocates only the returned Match.
+func (tr *Trie) MatchNth(input []byte, n int) *Match {
+	if n < 1 {
+		return nil
+	}
+	var match *Match
+
+	tr.Walk(input, func(end, length, pattern uint32) bool {
+		if n--; n > 0 {
+			return true
+		}
+		pos := end - length + 1
+		match = &Match{pos: pos, pattern: pattern, match: input[pos : pos+length], buf: tr.textLink}
+		return false
+	})
+
+	return match
+}
+
+// MatchLongestOverall returns the longest match anywhere in input, or
+// nil if there is none. Among equally long matches it prefers the
+// earliest start, then the lowest pattern id. It keeps only the best
+// match so far in one walk and allocates only the returned Match.
+func (tr *Trie) MatchLongestOverall(input []byte) *Match {
+	var best [3]uint32 // start, length, pattern
+	found := false
+
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		pos := end - n + 1
+		if !found || n > best[1] || n == best[1] && (pos < best[0] || pos == best[0] && pattern < best[2]) {
+			best, found = [3]uint32{pos, n, pattern}, true
+		}
+		return true
+	})
+
+	if !found {
+		return nil
+	}
+	return &Match{pos: best[0], pattern: best[2], match: input[best[0] : best[0]+best[1]], buf: tr.textLink}
+}
+
 // MatchString runs the Aho-Corasick string-search algorithm on a string input.
+// Like Match it compares bytes, not runes, whether or not input is valid
+// UTF-8; see MatchUTF8 for a choice of how to treat invalid bytes.
 func (tr *Trie) MatchString(input string) []*Match {
 	return tr.Match([]byte(input))
 }
@@ -2221,6 +2729,153 @@ func (tr *Trie) MatchFirstString(input string) *Match {
 	return tr.MatchFirst([]byte(input))
 }
 
+// MatchIndices reports the same matches as Match, in the same order, as
+// plain {start, end, patternID} triples with end exclusive, so
+// input[start:end] is the matched text. It allocates only the returned
+// slice: no Match values and nothing to release, which suits callers that
+// need offsets alone or hand results across an FFI or encoding boundary.
+func (tr *Trie) MatchIndices(input []byte) [][3]uint32 {
+	var out [][3]uint32
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		out = append(out, [3]uint32{end + 1 - n, end + 1, pattern})
+		return true
+	})
+	return out
+}
+
+// MatchStringIndices is MatchIndices on a string input.
+func (tr *Trie) MatchStringIndices(input string) [][3]uint32 {
+	return tr.MatchIndices([]byte(input))
+}
+
+// Count returns the number of matches Match would report on input,
+// without materializing them.
+func (tr *Trie) Count(input []byte) int {
+	n := 0
+	tr.Walk(input, func(end, length, pattern uint32) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Satisfies reports whether input contains a pattern from every group
+// of pattern ids: AND across groups, OR within one, so a rule such as
+// "(A or B) and C" is groups {{A, B}, {C}}, checked in a single walk
+// that stops as soon as the last group is met. No groups are trivially
+// satisfied, and an empty group never is.
+func (tr *Trie) Satisfies(input []byte, groups [][]uint32) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	in := make(map[uint32][]int) // pattern id to the groups it is in
+	for g, ids := range groups {
+		if len(ids) == 0 {
+			return false
+		}
+		for _, id := range ids {
+			in[id] = append(in[id], g)
+		}
+	}
+	met := make([]bool, len(groups))
+	left := len(groups)
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		for _, g := range in[pattern] {
+			if !met[g] {
+				met[g] = true
+				left--
+			}
+		}
+		return left > 0
+	})
+	return left == 0
+}
+
+// PatternIDs returns the distinct pattern ids in the trie in increasing
+// order: the id each entry of FeatureVector's result counts, so its
+// length is the vector's. With the ids AddPattern assigns, entry i is
+// id i. Patterns sharing an id (see AddPatternWithID) share an entry,
+// so there can be fewer ids than NumPatterns.
+func (tr *Trie) PatternIDs() []uint32 {
+	return slices.Clone(tr.patternIDs())
+}
+
+// patternIDs is PatternIDs without the copy, computed on first use.
+func (tr *Trie) patternIDs() []uint32 {
+	tr.idsOnce.Do(func() {
+		var ids []uint32
+		for s, n := range tr.dict {
+			if n != 0 {
+				ids = append(ids, tr.pattern[s])
+			}
+		}
+		slices.Sort(ids)
+		tr.ids = slices.Compact(ids)
+		tr.denseIDs = len(tr.ids) == 0 || int(tr.ids[len(tr.ids)-1]) == len(tr.ids)-1
+	})
+	return tr.ids
+}
+
+// NumPatterns returns the number of distinct patterns the trie holds: a
+// pattern added more than once counts once, and empty patterns not at
+// all. Patterns given one id with AddPatternWithID count separately
+// (compare PatternIDs). The count is not serialized: a decoded Trie
+// recovers the same one from its tables. A minimized Trie, whose merged states can emit for
+// several patterns, counts the patterns Patterns returns.
+func (tr *Trie) NumPatterns() uint32 {
+	if tr.minimized {
+		return uint32(len(tr.patterns))
+	}
+	return tr.patternStates
+}
+
+// NumStates returns the number of automaton states, including the
+// unused state 0. The full transition table takes 1 KiB per state; a
+// compact one less (see IsCompact).
+func (tr *Trie) NumStates() int {
+	return len(tr.dict)
+}
+
+// FeatureVector returns, for each pattern id in PatternIDs' order, the
+// number of times Match would report that pattern on input: a
+// bag-of-keywords vector computed in one walk with a single allocation.
+// Entries are indexed densely, so ids chosen with AddPatternWithID, such
+// as database keys, cost one entry each however large or sparse they
+// are; with the ids AddPattern assigns, entry i counts id i.
+func (tr *Trie) FeatureVector(input []byte) []uint32 {
+	ids := tr.patternIDs()
+	counts := make([]uint32, len(ids))
+	if tr.denseIDs {
+		tr.Walk(input, func(end, n, pattern uint32) bool {
+			counts[pattern]++
+			return true
+		})
+		return counts
+	}
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		i, _ := slices.BinarySearch(ids, pattern)
+		counts[i]++
+		return true
+	})
+	return counts
+}
+
+// EstimateMatches returns an upper bound on the number of matches Match
+// would report on input, for presizing result buffers. It is currently
+// exact (it is Count), but callers should rely only on it being an upper
+// bound, so it can trade exactness for speed later.
+func (tr *Trie) EstimateMatches(input []byte) int {
+	return tr.Count(input)
+}
+
+// MatchBuffer runs Match on the unread portion of buf without copying
+// it. The returned matches alias buf's storage, so they are valid only
+// until buf is next modified (written to, read from, reset, or grown);
+// copy any match bytes needed beyond that. buf itself is not consumed.
+func (tr *Trie) MatchBuffer(buf *bytes.Buffer) []*Match {
+	return tr.Match(buf.Bytes())
+}
+
 // ReleaseMatches returns the scratch buffer backing a Match result to the
 // Trie's pool for reuse. Releasing is optional: a result that is simply
 // dropped is reclaimed by the GC.
@@ -2233,14 +2888,48 @@ func (tr *Trie) MatchFirstString(input string) *Match {
 // Match, or a tail sub-slice such as result[1:] is a no-op; a sub-slice
 // that includes the original first element (e.g. result[:k]) releases the
 // whole underlying buffer.
+//
+// With TrieBuilder.SetPoolDebug, releasing a batch again panics, and so
+// does reading any of its Matches afterwards.
 func (tr *Trie) ReleaseMatches(matches []*Match) {
 	if len(matches) == 0 {
 		return
 	}
+	// Matches of a Trie keeping pattern text all link to their buffer;
+	// only the batch's first element releases it.
 	buf := matches[0].buf
-	if buf == nil {
+	if buf == nil || len(buf.ptrs) == 0 || buf.ptrs[0] != matches[0] {
+		return
+	}
+	if tr.poolDebug {
+		buf.quarantine()
 		return
 	}
 	matches[0].buf = nil
 	tr.bufPool.Put(buf)
 }
+
+// quarantine is ReleaseMatches under SetPoolDebug: rather than return
+// the buffer to the pool, it marks the buffer released and links every
+// Match in it to the buffer, where the accessors look, so that reading
+// one panics and so does a second release.
+func (b *matchBuf) quarantine() {
+	if b.released {
+		panic("ahocorasick: ReleaseMatches called twice on one result")
+	}
+	b.released = true
+	for i := range b.arena {
+		b.arena[i].buf = b
+	}
+}
+
+// WithMatches calls fn with Match's result for input and releases it to
+// the pool when fn returns, or panics, so the release can be neither
+// forgotten nor repeated. The slice and its Matches are valid only
+// inside fn: keep what must outlive the call by copying the values out
+// (or the Matches, with *m).
+func (tr *Trie) WithMatches(input []byte, fn func([]*Match)) {
+	matches := tr.Match(input)
+	defer tr.ReleaseMatches(matches)
+	fn(matches)
+}
@@ -3,9 +3,14 @@ package ahocorasick
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -421,3 +426,668 @@ func TestParallelWorkersPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchNth(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build()
+	input := []byte("ushers")
+
+	// Walk order: "she" and "he" both end at 3, longest first; "hers"
+	// ends at 5.
+	expected := []*Match{
+		newMatchString(1, 1, "she"),
+		newMatchString(2, 0, "he"),
+		newMatchString(2, 2, "hers"),
+	}
+	for i, want := range expected {
+		if got := tr.MatchNth(input, i+1); got == nil || !MatchEqual(want, got) {
+			t.Errorf("MatchNth(%d): expected %v, got %v", i+1, want, got)
+		}
+	}
+	for _, n := range []int{0, -1, 4} {
+		if got := tr.MatchNth(input, n); got != nil {
+			t.Errorf("MatchNth(%d): expected nil, got %v", n, got)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		tr.MatchNth(input, 2)
+	})
+	if allocs > 2 {
+		t.Errorf("expected at most one Match plus the callback closure, got %v allocs", allocs)
+	}
+}
+
+func TestMatchLongestOverall(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"a", "cde", "bcd", "de", "wxyz"}).Build()
+
+	// "bcd" and "cde" tie on length; "bcd" starts first.
+	want := newMatchString(1, 2, "bcd")
+	if got := tr.MatchLongestOverall([]byte("abcde")); got == nil || !MatchEqual(want, got) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	want = newMatchString(3, 4, "wxyz")
+	if got := tr.MatchLongestOverall([]byte("de wxyz a")); got == nil || !MatchEqual(want, got) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := tr.MatchLongestOverall([]byte("nothing here")); got != nil {
+		t.Errorf("expected nil, got %v", got)
+	}
+}
+
+func TestMatchBuffer(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"or", "amet"}).Build()
+	var buf bytes.Buffer
+	buf.WriteString("Lorem ipsum dolor sit amet, consectetur adipiscing elit.")
+
+	got := tr.MatchBuffer(&buf)
+	want := tr.Match(buf.Bytes())
+	if len(got) != len(want) {
+		t.Fatalf("expected %d matches, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !MatchEqual(want[i], got[i]) {
+			t.Errorf("expected %v, got %v", want[i], got[i])
+		}
+	}
+	if &got[0].Match()[0] != &buf.Bytes()[got[0].Pos()] {
+		t.Error("match bytes do not alias the buffer")
+	}
+	if buf.Len() != 56 {
+		t.Errorf("MatchBuffer consumed the buffer: %d bytes left", buf.Len())
+	}
+	tr.ReleaseMatches(got)
+	tr.ReleaseMatches(want)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		tr.ReleaseMatches(tr.MatchBuffer(&buf))
+	})
+	direct := testing.AllocsPerRun(100, func() {
+		tr.ReleaseMatches(tr.Match(buf.Bytes()))
+	})
+	if allocs > direct {
+		t.Errorf("MatchBuffer allocates %v per call, Match on buf.Bytes() %v", allocs, direct)
+	}
+}
+
+func TestMatchIndices(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen, err := ioutil.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tr := range map[string]*Trie{
+		"dictionary": NewTrieBuilder().AddStrings(patterns[:10000]).Build(),
+		"single":     NewTrieBuilder().AddString("og").Build(),
+	} {
+		ms := tr.Match(ibsen)
+		idx := tr.MatchIndices(ibsen)
+		if len(idx) != len(ms) {
+			t.Fatalf("%s: expected %d indices, got %d", name, len(ms), len(idx))
+		}
+		for i, m := range ms {
+			want := [3]uint32{m.Pos(), m.Pos() + uint32(len(m.Match())), m.Pattern()}
+			if idx[i] != want {
+				t.Fatalf("%s: index %d: expected %v, got %v", name, i, want, idx[i])
+			}
+			if !bytes.Equal(ibsen[idx[i][0]:idx[i][1]], m.Match()) {
+				t.Fatalf("%s: index %d does not slice the matched text", name, i)
+			}
+		}
+		tr.ReleaseMatches(ms)
+	}
+
+	tr := NewTrieBuilder().AddStrings([]string{"or", "amet"}).Build()
+	got := tr.MatchStringIndices("Lorem ipsum dolor sit amet")
+	want := [][3]uint32{{1, 3, 0}, {15, 17, 0}, {22, 26, 1}}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], got[i])
+		}
+	}
+	if got := tr.MatchStringIndices("nothing here"); got != nil {
+		t.Errorf("expected nil, got %v", got)
+	}
+}
+
+func TestWalkSkip(t *testing.T) {
+	collect := func(tr *Trie, input string, skip bool) [][3]uint32 {
+		var out [][3]uint32
+		tr.WalkSkip([]byte(input), func(end, n, pattern uint32) (bool, uint32) {
+			out = append(out, [3]uint32{end + 1 - n, end + 1, pattern})
+			if skip {
+				return true, end + 1
+			}
+			return true, 0
+		})
+		return out
+	}
+	equal := func(name string, got, want [][3]uint32) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: expected %v, got %v", name, want, got)
+				return
+			}
+		}
+	}
+
+	tr := NewTrieBuilder().AddStrings([]string{"aa"}).Build()
+	equal("no skip", collect(tr, "aaaa", false), [][3]uint32{{0, 2, 0}, {1, 3, 0}, {2, 4, 0}})
+	equal("skip", collect(tr, "aaaa", true), [][3]uint32{{0, 2, 0}, {2, 4, 0}})
+
+	// Skipping resets the automaton: "abcd" is in progress when "ab"
+	// matches, and must not be reported once the scan restarts at 'c'.
+	tr = NewTrieBuilder().AddStrings([]string{"ab", "abcd", "bc", "cd"}).Build()
+	equal("overlapping", collect(tr, "abcd", false), [][3]uint32{{0, 2, 0}, {1, 3, 2}, {0, 4, 1}, {2, 4, 3}})
+	equal("reset", collect(tr, "abcd", true), [][3]uint32{{0, 2, 0}, {2, 4, 3}})
+
+	// A skip beyond the input ends the walk; cont false stops it.
+	var calls int
+	tr.WalkSkip([]byte("abab"), func(end, n, pattern uint32) (bool, uint32) {
+		calls++
+		return true, 100
+	})
+	if calls != 1 {
+		t.Errorf("skip past input: expected 1 call, got %d", calls)
+	}
+	calls = 0
+	tr.WalkSkip([]byte("abab"), func(end, n, pattern uint32) (bool, uint32) {
+		calls++
+		return false, end + 1
+	})
+	if calls != 1 {
+		t.Errorf("stop: expected 1 call, got %d", calls)
+	}
+}
+
+func TestCount(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen, err := ioutil.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range []*Trie{
+		NewTrieBuilder().AddStrings(patterns[:10000]).Build(),
+		NewTrieBuilder().AddString("og").Build(),
+		NewTrieBuilder().Build(),
+	} {
+		ms := tr.Match(ibsen)
+		if got := tr.Count(ibsen); got != len(ms) {
+			t.Errorf("Count: expected %d, got %d", len(ms), got)
+		}
+		if got := tr.EstimateMatches(ibsen); got < len(ms) {
+			t.Errorf("EstimateMatches: %d is below the %d matches", got, len(ms))
+		}
+		tr.ReleaseMatches(ms)
+	}
+}
+
+func TestNumStatesNumPatterns(t *testing.T) {
+	tb := NewTrieBuilder().
+		AddStrings([]string{"he", "she", "his", "hers", "he", ""}).
+		AddPatternWithID([]byte("x"), 99)
+	trie := tb.Build()
+	// nil, root, h, he, s, sh, she, hi, his, her, hers, x
+	if n := trie.NumStates(); n != 12 {
+		t.Errorf("NumStates = %d, want 12", n)
+	}
+	if n := trie.NumPatterns(); n != 5 {
+		t.Errorf("NumPatterns = %d, want 5", n)
+	}
+	if n := len(trie.PatternIDs()); n != 5 {
+		t.Errorf("PatternIDs has %d ids, want 5", n)
+	}
+	data, err := EncodeBytes(trie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.NumStates() != 12 || decoded.NumPatterns() != 5 {
+		t.Errorf("decoded: NumStates = %d, NumPatterns = %d", decoded.NumStates(), decoded.NumPatterns())
+	}
+	if n := tb.BuildMinimized().NumPatterns(); n != 5 {
+		t.Errorf("minimized: NumPatterns = %d, want 5", n)
+	}
+}
+
+func TestFeatureVector(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "hers", "his"}).Build()
+	if got := tr.PatternIDs(); !reflect.DeepEqual(got, []uint32{0, 1, 2, 3}) {
+		t.Fatalf("PatternIDs: expected [0 1 2 3], got %v", got)
+	}
+	got := tr.FeatureVector([]byte("ushers say she is his"))
+	if want := []uint32{2, 2, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FeatureVector: expected %v, got %v", want, got)
+	}
+	if got := NewTrieBuilder().Build().FeatureVector([]byte("he")); len(got) != 0 {
+		t.Errorf("FeatureVector without patterns: expected empty, got %v", got)
+	}
+
+	// Sparse ids are indexed densely, and decoding keeps them.
+	tr = NewTrieBuilder().
+		AddPatternWithID([]byte("x"), 9).
+		AddPatternWithID([]byte("y"), math.MaxUint32).
+		AddPatternWithID([]byte("z"), 1e9).
+		Build()
+	var buf bytes.Buffer
+	if err := Encode(&buf, tr); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dec.PatternIDs(), []uint32{9, 1e9, math.MaxUint32}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PatternIDs: expected %v, got %v", want, got)
+	}
+	if got, want := dec.FeatureVector([]byte("xxyz")), []uint32{2, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FeatureVector with sparse ids: expected %v, got %v", want, got)
+	}
+}
+
+func TestIsASCII(t *testing.T) {
+	if !NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build().IsASCII() {
+		t.Error("ASCII dictionary: expected IsASCII")
+	}
+	if NewTrieBuilder().AddStrings([]string{"he", "caf\u00e9"}).Build().IsASCII() {
+		t.Error("UTF-8 pattern: expected not IsASCII")
+	}
+	// A transform mapping a high byte onto a pattern byte moves on it.
+	tr := NewTrieBuilder().SetByteTransform(func(b byte) byte {
+		if b == 0xe9 {
+			return 'e'
+		}
+		return b
+	}).AddString("e").Build()
+	if tr.IsASCII() {
+		t.Error("transform onto ASCII: expected not IsASCII")
+	}
+}
+
+func TestIsCompact(t *testing.T) {
+	patterns := []string{"he", "she", "hers"}
+	small := NewTrieBuilder().AddStrings(patterns).Build()
+	if !small.IsCompact() || small.failTrans16 == nil {
+		t.Error("small ASCII trie: expected compact, on the half-width table")
+	}
+	full := fullTable(NewTrieBuilder().AddStrings(patterns).Build())
+	if small.tableBytes() >= full.tableBytes() {
+		t.Errorf("compact trie retains %d bytes, the full table %d", small.tableBytes(), full.tableBytes())
+	}
+	for name, tr := range map[string]*Trie{
+		"UTF-8 pattern": NewTrieBuilder().AddStrings([]string{"he", "caf\u00e9"}).Build(),
+		"transform onto ASCII": NewTrieBuilder().SetByteTransform(func(b byte) byte {
+			if b == 0xe9 {
+				return 'e'
+			}
+			return b
+		}).AddString("e").Build(),
+		"zero": new(Trie),
+	} {
+		if tr.IsCompact() {
+			t.Errorf("%s: expected a full table", name)
+		}
+	}
+
+	// Decoding and minimizing, which work on the full table, leave an
+	// ASCII trie compact too.
+	data, err := EncodeBytes(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minimized := NewTrieBuilder().AddStrings(patterns).BuildMinimized()
+	for name, tr := range map[string]*Trie{"decoded": decoded, "minimized": minimized} {
+		if !tr.IsCompact() {
+			t.Errorf("%s: expected compact", name)
+		}
+		if got, want := tr.MatchString("ushers"), full.MatchString("ushers"); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: matches %v, want %v", name, got, want)
+		}
+	}
+	if !decoded.Equal(full) || !full.Equal(decoded) || decoded.Fingerprint() != full.Fingerprint() {
+		t.Error("decoded compact trie differs from the full table")
+	}
+}
+
+// TestCompactClassTable checks ASCII tries past failTrans16's reach,
+// which keep the byte-class table alone, against tries of the same
+// patterns plus one with high bytes, which the ASCII input never
+// matches, built with the full table.
+func TestCompactClassTable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fixtures build about 50000 states each")
+	}
+	rng := rand.New(rand.NewSource(3))
+	words := func(prefix string, alpha byte) []string {
+		ws := make([]string, 12000)
+		for i := range ws {
+			w := []byte(prefix)
+			for len(w) < 6+len(prefix) {
+				w = append(w, 'a'+byte(rng.Intn(int(alpha))))
+			}
+			ws[i] = string(w)
+		}
+		return ws
+	}
+	for _, tc := range []struct {
+		name     string
+		patterns []string
+		opts     []Option
+	}{
+		{"multi-stop", words("", 20), nil},
+		{"single-stop", words("q", 20), nil},
+		{"case-insensitive", words("", 26), []Option{WithCaseInsensitive()}},
+	} {
+		bs := make([][]byte, len(tc.patterns))
+		for i, p := range tc.patterns {
+			bs[i] = []byte(p)
+		}
+		var input []byte
+		for len(input) < 200000 {
+			w := tc.patterns[rng.Intn(len(tc.patterns))]
+			if rng.Intn(2) == 0 {
+				w = strings.ToUpper(w[:3]) + w[3:]
+			}
+			input = append(input, w[:2+rng.Intn(len(w)-1)]...)
+			input = append(input, " qj.\n"[rng.Intn(5)])
+		}
+		tr, err := Compile(bs, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tr.IsCompact() || tr.failTrans16 != nil || tr.failTransC == nil {
+			t.Fatalf("%s: expected a compact trie on the class table, %d states", tc.name, tr.NumStates())
+		}
+		ref, err := Compile(append(bs, []byte("\xff\xfe")), tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ref.IsCompact() {
+			t.Fatalf("%s: reference trie is compact", tc.name)
+		}
+
+		want := triplesFromMatches(ref.Match(input))
+		if i := diffTriples(triplesFromMatches(tr.Match(input)), want); i >= 0 {
+			t.Errorf("%s: Match differs from the full table at %d", tc.name, i)
+		}
+		var buf matchBuf
+		tr.matchSeq(input, &buf)
+		if got := len(buf.raw) / 2; got != len(want) {
+			t.Errorf("%s: sequential scan found %d matches, want %d", tc.name, got, len(want))
+		}
+		var walked [][3]uint32
+		tr.Walk(input, func(end, n, pattern uint32) bool {
+			walked = append(walked, [3]uint32{end + 1 - n, pattern, n})
+			return true
+		})
+		if i := diffTriples(walked, want); i >= 0 {
+			t.Errorf("%s: Walk differs from the full table at %d", tc.name, i)
+		}
+		if len(want) == 0 {
+			t.Fatalf("%s: input has no matches", tc.name)
+		}
+		if got, want := tr.MatchFirst(input), ref.MatchFirst(input); got == nil || !MatchEqual(got, want) {
+			t.Errorf("%s: MatchFirst = %v, want %v", tc.name, got, want)
+		}
+
+		data, err := EncodeBytes(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.IsCompact() || !decoded.Equal(tr) {
+			t.Errorf("%s: decoded trie is not the same compact trie", tc.name)
+		}
+	}
+
+	// With all 128 ASCII bytes in use, class rows would be as wide as
+	// half a full row, so the trie keeps the full table.
+	var all []string
+	for len(all) < 12000 {
+		w := make([]byte, 5)
+		for i := range w {
+			w[i] = byte(rng.Intn(0x80))
+		}
+		all = append(all, string(w))
+	}
+	if tr := NewTrieBuilder().AddStrings(all).Build(); tr.IsCompact() || !tr.IsASCII() || tr.NumStates() <= failTrans16MaxStates {
+		t.Errorf("every ASCII byte: IsCompact = %v, IsASCII = %v, %d states; want a full ASCII table", tr.IsCompact(), tr.IsASCII(), tr.NumStates())
+	}
+}
+
+func TestRootSelfLoop(t *testing.T) {
+	for _, tr := range []*Trie{
+		NewTrieBuilder().AddStrings([]string{"he", "she"}).Build(),
+		NewTrieBuilder().AddStrings([]string{"he", "she"}).SetAlphabet([]byte("hes")).Build(),
+	} {
+		// State 0 is a placeholder that behaves like the root.
+		if tr.dict[nilState] != 0 || tr.dictLink[nilState] != nilState {
+			t.Error("state 0 carries a pattern or link")
+		}
+		var row [256]uint32
+		for b, v := range tr.row(nilState, &row) {
+			if v != rootState {
+				t.Errorf("state 0 on byte %d goes to %d, want the root", b, v)
+			}
+		}
+		for _, b := range []byte("xyz\x00\xff") {
+			if v := tr.next(rootState, b); v != rootState {
+				t.Errorf("root on unmatched byte %q goes to %d, want the root", b, v)
+			}
+		}
+
+		// Unmatched bytes keep the automaton at the root without a
+		// match, and a pattern after them still fires.
+		noise := []byte("xyz\x00\xff!!")
+		s, _ := tr.walkState(noise, rootState, 0, func(end, n, pattern uint32) bool {
+			t.Errorf("unexpected match ending at %d", end)
+			return true
+		})
+		if s != rootState {
+			t.Errorf("after unmatched bytes: in state %d, want the root", s)
+		}
+		checkMatches(t, "after noise", tr.MatchString("xyz\x00\xff!!she"), []*Match{
+			newMatchString(7, 1, "she"),
+			newMatchString(8, 0, "he"),
+		})
+	}
+}
+
+func TestMatchStats(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "hers"}).Build()
+	input := []byte("ushers and she")
+	ms, st := tr.MatchStats(input)
+	if st.Bytes != len(input) || st.Matches != 5 || len(ms) != 5 || st.Duration < 0 {
+		t.Errorf("MatchStats: got %d matches and %+v", len(ms), st)
+	}
+	tr.ReleaseMatches(ms)
+
+	calls := 0
+	st = tr.WalkStats(input, func(end, n, pattern uint32) bool {
+		calls++
+		return calls < 2
+	})
+	if st.Bytes != len(input) || st.Matches != 2 || calls != 2 {
+		t.Errorf("WalkStats: %d calls, got %+v", calls, st)
+	}
+}
+
+func TestMatchedCoverage(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"he", "she", "hers", "a", "and"}).Build()
+	for _, tc := range []struct {
+		input string
+		want  uint32
+	}{
+		// "she", "he", and "hers" cover "shers" once: 5 bytes, not 9.
+		{"ushers", 5},
+		{"ushers and she", 5 + 3 + 3},
+		// Spans that touch merge without double counting.
+		{"hehe", 4},
+		{"xyz", 0},
+		{"", 0},
+	} {
+		if got := tr.MatchedCoverage([]byte(tc.input)); got != tc.want {
+			t.Errorf("%q: got %d, want %d", tc.input, got, tc.want)
+		}
+	}
+}
+
+// TestConcurrentMatching backs the read-only guarantee: run under -race,
+// any write to shared state outside the pool and MatchSkip's once-built
+// table is reported.
+func TestConcurrentMatching(t *testing.T) {
+	patterns, err := readPatterns("test_data/NSF-ordlisten.cleaned.uniq.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibsen, err := ioutil.ReadFile("test_data/Ibsen.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := ibsen[:32<<10]
+	tr := NewTrieBuilder().AddStrings(patterns[:5000]).Build()
+	if !tr.IsReadOnly() {
+		t.Fatal("built trie is not read-only")
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, tr); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.IsReadOnly() || new(Trie).IsReadOnly() {
+		t.Error("expected decoded tries read-only and zero tries not")
+	}
+
+	want := triplesFromMatches(tr.Match(input))
+	var wg sync.WaitGroup
+	errs := make(chan string, 16*5*4) // room for every check to fail
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				ms := tr.Match(input)
+				if diffTriples(triplesFromMatches(ms), want) >= 0 {
+					errs <- "Match"
+				}
+				tr.ReleaseMatches(ms)
+				if diffTriples(tr.triplesFromWalk(input), want) >= 0 {
+					errs <- "Walk"
+				}
+				ms = tr.MatchSkip(input)
+				if len(ms) != len(want) {
+					errs <- "MatchSkip"
+				}
+				tr.ReleaseMatches(ms)
+				if len(tr.MatchIndices(input)) != len(want) {
+					errs <- "MatchIndices"
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for name := range errs {
+		t.Errorf("%s: concurrent result differs", name)
+	}
+}
+
+func TestValueAs(t *testing.T) {
+	type category string
+	const (
+		secret category = "secret"
+		pii    category = "pii"
+	)
+	trie := NewTrieBuilder().
+		AddPatternWithValue([]byte("AKIA"), secret).
+		AddPatternWithValue([]byte("ssn"), pii).
+		AddPatternWithValue([]byte("token"), "not a category").
+		AddString("plain").
+		Build()
+	matches := trie.MatchString("ssn AKIA token plain")
+	want := []struct {
+		cat category
+		ok  bool
+	}{{pii, true}, {secret, true}, {"", false}, {"", false}}
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d", len(matches), len(want))
+	}
+	for i, m := range matches {
+		if cat, ok := ValueAs[category](trie, m.Pattern()); cat != want[i].cat || ok != want[i].ok {
+			t.Errorf("%q: got %q, %v; want %q, %v", m.Match(), cat, ok, want[i].cat, want[i].ok)
+		}
+	}
+}
+
+func TestWalkLongestFirst(t *testing.T) {
+	// Every suffix of "aabab" is a pattern, so matches pile up at each end,
+	// added shortest first to rule out insertion order.
+	trie := NewTrieBuilder().AddStrings([]string{"b", "ab", "bab", "abab", "aabab", "a", "aa"}).Build()
+	lastEnd, lastLen := uint32(0), uint32(0)
+	count := 0
+	trie.Walk([]byte("aababaabab"), func(end, n, pattern uint32) bool {
+		if count > 0 && end == lastEnd && n >= lastLen {
+			t.Errorf("at end %d: length %d after %d", end, n, lastLen)
+		}
+		if end < lastEnd {
+			t.Errorf("end %d after %d", end, lastEnd)
+		}
+		lastEnd, lastLen = end, n
+		count++
+		return true
+	})
+	if count != len(trie.Match([]byte("aababaabab"))) || count < 15 {
+		t.Errorf("Walk reported %d matches", count)
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	const a, b, c = 0, 1, 2
+	tr := NewTrieBuilder().AddStrings([]string{"alpha", "beta", "gamma"}).Build()
+	rule := [][]uint32{{a, b}, {c}} // (A or B) and C
+	for _, tc := range []struct {
+		input string
+		want  bool
+	}{
+		{"beta then gamma", true},
+		{"gamma, alpha", true},
+		{"alpha beta", false},
+		{"gamma", false},
+	} {
+		if got := tr.Satisfies([]byte(tc.input), rule); got != tc.want {
+			t.Errorf("%q: got %v, want %v", tc.input, got, tc.want)
+		}
+	}
+	if !tr.Satisfies([]byte("nothing"), nil) {
+		t.Error("no groups: want true")
+	}
+	if tr.Satisfies([]byte("alpha"), [][]uint32{{a}, {}}) {
+		t.Error("an empty group: want false")
+	}
+}
@@ -0,0 +1,94 @@
+package ahocorasick
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 reports invalid UTF-8 input under InvalidUTF8Error.
+var ErrInvalidUTF8 = errors.New("ahocorasick: invalid UTF-8")
+
+// InvalidUTF8Policy says how MatchUTF8 treats bytes of input that are
+// not valid UTF-8 (see TrieBuilder.SetInvalidUTF8Policy).
+type InvalidUTF8Policy int
+
+const (
+	// InvalidUTF8Bytes matches invalid bytes like any others. It is the
+	// default, and how every other matching method treats all input.
+	InvalidUTF8Bytes InvalidUTF8Policy = iota
+	// InvalidUTF8Skip drops invalid bytes, so a pattern matches across
+	// them.
+	InvalidUTF8Skip
+	// InvalidUTF8Replace reads each invalid byte as U+FFFD, so it
+	// matches patterns containing the replacement character.
+	InvalidUTF8Replace
+	// InvalidUTF8Error fails the call with ErrInvalidUTF8.
+	InvalidUTF8Error
+)
+
+// SetInvalidUTF8Policy sets how the built Trie's MatchUTF8 treats
+// invalid UTF-8 input. Matching is byte-wise throughout: MatchString,
+// like Match, compares bytes and takes invalid UTF-8 as it comes, which
+// InvalidUTF8Bytes keeps. Like priorities, the policy is not
+// serialized.
+func (tb *TrieBuilder) SetInvalidUTF8Policy(policy InvalidUTF8Policy) *TrieBuilder {
+	tb.utf8Policy = policy
+	return tb
+}
+
+// MatchUTF8 is Match for input expected to be UTF-8, handling invalid
+// bytes by the Trie's InvalidUTF8Policy. Reported positions and matched
+// bytes are those of input; a match that takes in a skipped or replaced
+// byte covers it in full. The only error is one wrapping ErrInvalidUTF8,
+// under InvalidUTF8Error, naming the first invalid byte's offset. Valid
+// input costs one validation pass on top of Match. Release the result
+// with ReleaseMatches.
+func (tr *Trie) MatchUTF8(input []byte) ([]*Match, error) {
+	if tr.utf8Policy == InvalidUTF8Bytes || utf8.Valid(input) {
+		return tr.Match(input), nil
+	}
+	if tr.utf8Policy == InvalidUTF8Error {
+		for i := 0; i < len(input); {
+			r, n := utf8.DecodeRune(input[i:])
+			if r == utf8.RuneError && n == 1 {
+				return nil, fmt.Errorf("%w at byte %d", ErrInvalidUTF8, i)
+			}
+			i += n
+		}
+	}
+	norm, src := sanitizeUTF8(input, tr.utf8Policy == InvalidUTF8Replace)
+	var spans []span
+	tr.Walk(norm, func(end, n, pattern uint32) bool {
+		spans = append(spans, span{start: src[end+1-n], end: src[end] + 1, pattern: pattern})
+		return true
+	})
+	return tr.pooledMatches(input, spans), nil
+}
+
+// MatchUTF8String is MatchUTF8 on a string input.
+func (tr *Trie) MatchUTF8String(input string) ([]*Match, error) {
+	return tr.MatchUTF8([]byte(input))
+}
+
+// sanitizeUTF8 returns input with its invalid bytes dropped, or replaced
+// by U+FFFD if replace is set, and for each byte of the result the
+// offset of the input byte it came from.
+func sanitizeUTF8(input []byte, replace bool) (norm []byte, src []uint32) {
+	norm = make([]byte, 0, len(input))
+	src = make([]uint32, 0, len(input))
+	for i := 0; i < len(input); {
+		r, n := utf8.DecodeRune(input[i:])
+		if r != utf8.RuneError || n != 1 {
+			norm = append(norm, input[i:i+n]...)
+			for j := i; j < i+n; j++ {
+				src = append(src, uint32(j))
+			}
+		} else if replace {
+			norm = utf8.AppendRune(norm, utf8.RuneError)
+			src = append(src, uint32(i), uint32(i), uint32(i))
+		}
+		i += n
+	}
+	return norm, src
+}
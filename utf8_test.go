@@ -0,0 +1,39 @@
+package ahocorasick
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestInvalidUTF8Policy(t *testing.T) {
+	input := []byte("caf\xffé \xfe\xff")
+	for _, tc := range []struct {
+		policy InvalidUTF8Policy
+		want   string
+		err    error
+	}{
+		{InvalidUTF8Bytes, `[{3 1 "\xff"} {8 1 "\xff"}]`, nil},
+		{InvalidUTF8Skip, `[{0 0 "caf\xffé"}]`, nil},
+		{InvalidUTF8Replace, `[{3 2 "\xff"} {7 2 "\xfe"} {8 2 "\xff"}]`, nil},
+		{InvalidUTF8Error, "[]", ErrInvalidUTF8},
+	} {
+		trie := NewTrieBuilder().
+			AddStrings([]string{"café", "\xff", "�"}).
+			SetInvalidUTF8Policy(tc.policy).
+			Build()
+		matches, err := trie.MatchUTF8(input)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("policy %d: got error %v, want %v", tc.policy, err, tc.err)
+		}
+		if got := fmt.Sprint(matches); got != tc.want {
+			t.Errorf("policy %d: got %s, want %s", tc.policy, got, tc.want)
+		}
+		trie.ReleaseMatches(matches)
+
+		// Valid input is matched as is under every policy.
+		if matches, err := trie.MatchUTF8String("café �"); err != nil || len(matches) != 2 {
+			t.Errorf("policy %d, valid input: got %v, %v", tc.policy, matches, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package ahocorasick
+
+import (
+	"cmp"
+	"slices"
+)
+
+// MatchWindows reports which patterns occur in each window of input: the
+// windows are window bytes long and start at 0, step, 2*step, and so on,
+// for every start below len(input); the last ones may be cut short by
+// the end of input. A match belongs to the window its start falls in,
+// even if it runs past the window's end, and to every window that start
+// falls in when windows overlap. fn is called for each window in order
+// with its start and the sorted, distinct ids of the patterns found in
+// it, which may be none; ids is reused once fn returns. Returning false
+// from fn stops early. A window or step of 0 reports nothing.
+//
+// Input is scanned once, however much the windows overlap.
+func (tr *Trie) MatchWindows(input []byte, window, step uint32, fn func(windowStart uint32, ids []uint32) bool) {
+	if window == 0 || step == 0 {
+		return
+	}
+	type hit struct{ start, pattern uint32 }
+	var hits []hit
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		hits = append(hits, hit{end + 1 - n, pattern})
+		return true
+	})
+	slices.SortFunc(hits, func(a, b hit) int { return cmp.Compare(a.start, b.start) })
+
+	var ids []uint32
+	first := 0 // index of the first hit at or after the window's start
+	for ws := uint64(0); ws < uint64(len(input)); ws += uint64(step) {
+		for first < len(hits) && uint64(hits[first].start) < ws {
+			first++
+		}
+		ids = ids[:0]
+		for _, h := range hits[first:] {
+			if uint64(h.start) >= ws+uint64(window) {
+				break
+			}
+			ids = append(ids, h.pattern)
+		}
+		slices.Sort(ids)
+		if !fn(uint32(ws), slices.Compact(ids)) {
+			return
+		}
+	}
+}
+
+// MatchRange is Match over input[start:end] alone, with positions
+// reported relative to input as a whole: only matches lying entirely
+// inside the range are found, so a pattern straddling either boundary
+// is not. The range's edges count as the ends of the input for
+// whole-word and end-anchored patterns. Like slicing, it panics unless
+// start <= end <= len(input). Release the result with ReleaseMatches.
+func (tr *Trie) MatchRange(input []byte, start, end uint32) []*Match {
+	var spans []span
+	tr.Walk(input[start:end], func(last, n, pattern uint32) bool {
+		spans = append(spans, span{start: start + last + 1 - n, end: start + last + 1, pattern: pattern})
+		return true
+	})
+	return tr.pooledMatches(input, spans)
+}
+
+// MatchPrefix is Match over the first n bytes of input alone, for quick
+// triage of huge inputs: the scan stops at byte n, and a pattern that
+// would extend past it is not reported, even though the rest of input
+// completes it. n past the end scans all of input, and n <= 0 nothing.
+// As with MatchRange, byte n counts as the end of the input for
+// whole-word and end-anchored patterns. Release the result with
+// ReleaseMatches.
+func (tr *Trie) MatchPrefix(input []byte, n int) []*Match {
+	if n <= 0 {
+		return nil
+	}
+	return tr.Match(input[:min(n, len(input))])
+}
+
+// MatchAt returns the matches starting exactly at pos, shortest first,
+// for filter-then-verify pipelines that have a candidate position and
+// want the patterns there. It follows goto edges from the root along
+// input[pos:], reporting each pattern state it passes, and stops where
+// no pattern continues: at most the longest pattern's length in steps,
+// and no scan of the rest of input. Matches whose dictionary links
+// would report start after pos and so are never candidates. Whole-word
+// and end-anchored patterns are judged against the whole of input.
+// Tries that collapse white space, and minimized tries, whose goto
+// edges are lost (see Descend), filter a full Walk instead. It panics if
+// pos > len(input). Release the result with ReleaseMatches.
+func (tr *Trie) MatchAt(input []byte, pos uint32) []*Match {
+	rest := input[pos:]
+	var spans []span
+	if tr.collapseSpace || tr.minimized {
+		tr.Walk(input, func(end, n, pattern uint32) bool {
+			if end+1-n == pos {
+				spans = append(spans, span{start: pos, end: end + 1, pattern: pattern})
+			}
+			return true
+		})
+		return tr.pooledMatches(input, spans)
+	}
+	depth := tr.depths()
+	s := rootState
+	for i, c := range rest {
+		s = tr.next(s, c) & stateMask
+		if depth[s] != uint32(i+1) {
+			break
+		}
+		if tr.dict[s] == 0 {
+			continue
+		}
+		end := pos + uint32(i) + 1
+		if tr.wholeWord && !isWord(input, pos, end) ||
+			tr.endAnchored != nil && tr.endAnchored[s] && int(end) != len(input) {
+			continue
+		}
+		spans = append(spans, span{start: pos, end: end, pattern: tr.pattern[s]})
+	}
+	return tr.pooledMatches(input, spans)
+}
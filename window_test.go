@@ -0,0 +1,110 @@
+package ahocorasick
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatchWindows(t *testing.T) {
+	tr := NewTrieBuilder().AddStrings([]string{"a", "bc", "cd"}).Build()
+	input := []byte("abcdxxa-bc")
+
+	var got []string
+	tr.MatchWindows(input, 4, 3, func(ws uint32, ids []uint32) bool {
+		got = append(got, fmt.Sprint(ws, ids))
+		return true
+	})
+	// Windows [0,4) [3,7) [6,10) [9,10); "cd" starts at 2, so it belongs
+	// to the first window only, though it ends in the second.
+	want := []string{"0 [0 1 2]", "3 [0]", "6 [0 1]", "9 []"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	got = got[:0]
+	tr.MatchWindows(input, 2, 2, func(ws uint32, ids []uint32) bool {
+		got = append(got, fmt.Sprint(ws, ids))
+		return len(got) < 2
+	})
+	if want := []string{"0 [0 1]", "2 [2]"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("early stop: expected %v, got %v", want, got)
+	}
+
+	tr.MatchWindows(input, 0, 1, func(uint32, []uint32) bool {
+		t.Error("zero window reported a window")
+		return true
+	})
+}
+
+func TestMatchRange(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"abc", "cd", "d"}).Build()
+	input := []byte("xxabcdxx")
+	for _, tc := range []struct {
+		start, end uint32
+		want       string
+	}{
+		{0, 8, "[{2 0 \"abc\"} {4 1 \"cd\"} {5 2 \"d\"}]"},
+		{3, 8, "[{4 1 \"cd\"} {5 2 \"d\"}]"}, // "abc" straddles the start
+		{0, 5, "[{2 0 \"abc\"}]"},            // "cd" and "d" straddle the end
+		{5, 6, "[{5 2 \"d\"}]"},
+		{4, 4, "[]"},
+	} {
+		matches := trie.MatchRange(input, tc.start, tc.end)
+		if got := fmt.Sprint(matches); got != tc.want {
+			t.Errorf("MatchRange(%d, %d) = %s, want %s", tc.start, tc.end, got, tc.want)
+		}
+		trie.ReleaseMatches(matches)
+	}
+}
+
+func TestMatchPrefix(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"abc", "cd", "d"}).Build()
+	input := []byte("xxabcdxx")
+	for _, tc := range []struct {
+		n    int
+		want string
+	}{
+		{5, "[{2 0 \"abc\"}]"}, // "cd" straddles the cutoff
+		{6, "[{2 0 \"abc\"} {4 1 \"cd\"} {5 2 \"d\"}]"},
+		{100, "[{2 0 \"abc\"} {4 1 \"cd\"} {5 2 \"d\"}]"},
+		{4, "[]"},
+		{0, "[]"},
+		{-1, "[]"},
+	} {
+		matches := trie.MatchPrefix(input, tc.n)
+		if got := fmt.Sprint(matches); got != tc.want {
+			t.Errorf("MatchPrefix(%d) = %s, want %s", tc.n, got, tc.want)
+		}
+		trie.ReleaseMatches(matches)
+	}
+}
+
+func TestMatchAt(t *testing.T) {
+	trie := NewTrieBuilder().AddStrings([]string{"he", "her", "hers", "ers", "s"}).Build()
+	input := []byte("ushers")
+	for _, tc := range []struct {
+		pos  uint32
+		want string
+	}{
+		{2, `[{2 0 "he"} {2 1 "her"} {2 2 "hers"}]`}, // nested patterns at one start
+		{3, `[{3 3 "ers"}]`},                         // "s" ends inside but starts later
+		{5, `[{5 4 "s"}]`},
+		{0, `[]`},
+		{6, `[]`},
+	} {
+		matches := trie.MatchAt(input, tc.pos)
+		if got := fmt.Sprint(matches); got != tc.want {
+			t.Errorf("MatchAt(%d) = %s, want %s", tc.pos, got, tc.want)
+		}
+		trie.ReleaseMatches(matches)
+	}
+
+	words := NewTrieBuilder().AddStrings([]string{"he", "her"}).SetWholeWord(true).Build()
+	if got := fmt.Sprint(words.MatchAt([]byte("a her"), 2)); got != `[{2 1 "her"}]` {
+		t.Errorf("whole word: got %s", got)
+	}
+	minimized := NewTrieBuilder().AddStrings([]string{"he", "her", "hers"}).BuildMinimized()
+	if got := fmt.Sprint(minimized.MatchAt(input, 2)); got != `[{2 0 "he"} {2 1 "her"} {2 2 "hers"}]` {
+		t.Errorf("minimized: got %s", got)
+	}
+}
@@ -0,0 +1,53 @@
+package ahocorasick
+
+// isWordByte reports whether c is a word byte for whole-word matching:
+// an ASCII letter, digit, or underscore, as in regexp's \w.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c|0x20 >= 'a' && c|0x20 <= 'z'
+}
+
+// isWord reports whether input[start:end] is a whole word: neither
+// preceded nor followed by a word byte. It reads the input's own bytes,
+// so a byte transform plays no part in where words end.
+func isWord(input []byte, start, end uint32) bool {
+	return (start == 0 || !isWordByte(input[start-1])) &&
+		(int(end) == len(input) || !isWordByte(input[end]))
+}
+
+// keep reports whether a match of input[start:end] is reported: always,
+// unless the Trie was built with SetWholeWord and the match is not a
+// whole word.
+func (tr *Trie) keep(input []byte, start, end uint32) bool {
+	return !tr.wholeWord || isWord(input, start, end)
+}
+
+// wordFilter wraps fn to see only whole-word matches in input.
+func wordFilter(input []byte, fn WalkFn) WalkFn {
+	return func(end, n, pattern uint32) bool {
+		if !isWord(input, end+1-n, end+1) {
+			return true
+		}
+		return fn(end, n, pattern)
+	}
+}
+
+// matchWalk is Match for whole-word, white-space-collapsing, and
+// end-anchored tries: the fast paths know nothing of word boundaries,
+// collapsed input, or anchors, so matches are collected through Walk,
+// which handles all three.
+func (tr *Trie) matchWalk(input []byte) []*Match {
+	var spans []span
+	tr.Walk(input, func(end, n, pattern uint32) bool {
+		spans = append(spans, span{start: end + 1 - n, end: end + 1, pattern: pattern})
+		return true
+	})
+	return tr.pooledMatches(input, spans)
+}
+
+// foldASCII maps ASCII upper case letters to lower case.
+func foldASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
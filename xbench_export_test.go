@@ -156,7 +156,7 @@ func TestXBenchExport(t *testing.T) {
 		}
 		tr := NewTrieBuilder().AddStrings(raw).Build()
 		tries[name] = tr
-		d.States = len(tr.failTrans)
+		d.States = tr.NumStates()
 		d.StopBytes = countStop(tr)
 		d.FT16 = tr.failTrans16 != nil
 		d.FTC = tr.failTransC != nil